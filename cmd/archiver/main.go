@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/archive"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/database"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+)
+
+func main() {
+	cfg := config.DefaultArchiver()
+	config.MustLoad(cfg)
+
+	// Setup observability
+	logger := observability.NewLogger("archiver", cfg.Level())
+	metrics := observability.GetCollector()
+	health := observability.NewHealthChecker()
+
+	logger.Info("Starting Archiver service")
+
+	// Context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		logger.Info("Shutdown signal received")
+		cancel()
+	}()
+
+	// Connect to TimescaleDB
+	logger.Info("Connecting to TimescaleDB")
+	db, err := database.NewPostgresPool(ctx, cfg.Database.URL)
+	if err != nil {
+		logger.Fatal("Failed to connect to TimescaleDB", err)
+	}
+	defer db.Close()
+
+	// Refuse to run against a schema this build was not written for
+	if err := database.CheckSchema(ctx, db); err != nil {
+		logger.Fatal("Incompatible database schema", err)
+	}
+
+	health.AddCheck("postgres", func(ctx context.Context) error {
+		return db.Ping(ctx)
+	})
+
+	store, err := archive.NewStore(ctx, cfg.Archive)
+	if err != nil {
+		logger.Fatal("Failed to open archive", err)
+	}
+
+	// Start metrics server
+	metricsPort := strconv.Itoa(cfg.MetricsPort)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metrics.Handler())
+	mux.HandleFunc("/health/live", health.LivenessHandler())
+	mux.HandleFunc("/health/ready", health.ReadinessHandler())
+
+	metricsServer := &http.Server{
+		Addr:    ":" + metricsPort,
+		Handler: mux,
+	}
+
+	go func() {
+		logger.Infof("Metrics server listening on :%s", metricsPort)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server error", err)
+		}
+	}()
+	defer metricsServer.Shutdown(context.Background())
+
+	logger.WithField("interval", cfg.Interval.String()).Info("Archiver service started")
+
+	// Archive closed days until shutdown
+	archive.NewArchiver(db, store, logger.Zerolog()).Run(ctx, cfg.Interval)
+
+	logger.Info("Archiver service stopped")
+}
@@ -6,18 +6,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/bl8ckfz/crypto-screener-backend/internal/binance"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
 	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
 	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/redis/go-redis/v9"
 )
 
 func main() {
+	cfg := config.DefaultDataCollector()
+	config.MustLoad(cfg)
+
 	// Setup observability
-	logger := observability.NewLogger("data-collector", observability.LevelInfo)
+	logger := observability.NewLogger("data-collector", cfg.Level())
 	metrics := observability.GetCollector()
 	health := observability.NewHealthChecker()
 
@@ -27,6 +32,13 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Setup tracing
+	shutdownTracing, err := observability.InitTracing(ctx, "data-collector")
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -37,18 +49,13 @@ func main() {
 		cancel()
 	}()
 
-	// Get NATS URL from environment (default to localhost)
-	natsURL := os.Getenv("NATS_URL")
-	if natsURL == "" {
-		natsURL = "nats://localhost:4222"
-	}
+	natsURL := cfg.NATS.URL
 
 	// Optional Redis for ticker cache
-	redisURL := os.Getenv("REDIS_URL")
 	var rdb *redis.Client
-	if redisURL != "" && redisURL != "disabled" {
-		logger.WithField("url", redisURL).Info("Connecting to Redis")
-		opt, err := redis.ParseURL(redisURL)
+	if cfg.Redis.Enabled() {
+		logger.Info("Connecting to Redis")
+		opt, err := cfg.Redis.Options()
 		if err != nil {
 			logger.WithField("error", err.Error()).Warn("Failed to parse REDIS_URL, ticker cache disabled")
 		} else {
@@ -85,14 +92,14 @@ func main() {
 		return nil
 	})
 
-	// Create JetStream context
-	js, err := messaging.NewJetStream(nc)
+	bus, err := messaging.NewJetStreamBus(nc)
 	if err != nil {
 		logger.Fatal("Failed to create JetStream context", err)
 	}
+	defer bus.Close()
 
 	// Ensure CANDLES stream exists
-	if err := messaging.CreateStream(js, "CANDLES", []string{"candles.>"}, 1*time.Hour); err != nil {
+	if err := bus.CreateStream(ctx, messaging.CandlesStream); err != nil {
 		logger.Fatal("Failed to create CANDLES stream", err)
 	}
 
@@ -101,7 +108,7 @@ func main() {
 
 	// Fetch active symbols
 	logger.Info("Fetching active symbols from Binance")
-	symbols, err := client.GetActiveSymbols(ctx)
+	symbols, err := client.GetActiveSymbols(ctx, cfg.SymbolLimit)
 	if err != nil {
 		logger.Fatal("Failed to fetch active symbols", err)
 	}
@@ -112,13 +119,10 @@ func main() {
 	metrics.Gauge(observability.MetricWSConnections).Set(float64(len(symbols)))
 
 	// Create WebSocket connection manager
-	wsManager := binance.NewConnectionManager(symbols, js, logger.Zerolog())
+	wsManager := binance.NewConnectionManager(symbols, bus, cfg.Collector, logger.Zerolog())
 
 	// Start metrics server
-	metricsPort := os.Getenv("METRICS_PORT")
-	if metricsPort == "" {
-		metricsPort = "9090"
-	}
+	metricsPort := strconv.Itoa(cfg.MetricsPort)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/metrics", metrics.Handler())
 	mux.HandleFunc("/health/live", health.LivenessHandler())
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+)
+
+// streams the services create. ALERTS was a work queue before gateway clients
+// replayed it; services refuse to start while a stream's retention differs.
+var streams = []messaging.StreamConfig{
+	messaging.CandlesStream,
+	messaging.MetricsStream,
+	messaging.AlertsStream,
+	messaging.RulesStream,
+}
+
+// migrate-streams recreates the streams whose retention policy changed,
+// deleting their messages and consumers. Run it once after upgrading, before
+// starting the services.
+func main() {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	nc, err := messaging.NewNATSConn(messaging.Config{URL: natsURL, MaxReconnects: 1, EnableJetStream: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer messaging.Close(nc)
+
+	bus, err := messaging.NewJetStreamBus(nc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, s := range streams {
+		replaced, err := bus.RecreateStream(ctx, s)
+		if err != nil {
+			log.Fatalf("%s: %v", s.Name, err)
+		}
+		if replaced {
+			log.Printf("%s: recreated", s.Name)
+		} else {
+			log.Printf("%s: retention unchanged", s.Name)
+		}
+	}
+}
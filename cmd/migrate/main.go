@@ -2,52 +2,112 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/database"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const usage = `usage: migrate <command> [arg]
+
+commands:
+  up [version]   apply pending migrations, up to version if given
+  down [steps]   roll back the latest applied migrations (default 1)
+  status         list migrations and whether they are applied
+  verify         fail unless exactly this build's migrations are applied
+
+The database is TIMESCALEDB_URL (or DATABASE_URL), or database.url in the
+YAML file named by CONFIG_FILE.
+`
+
 func main() {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+	if len(os.Args) < 2 || len(os.Args) > 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	arg := 0
+	if len(os.Args) == 3 {
+		n, err := strconv.Atoi(os.Args[2])
+		if err != nil || n < 1 {
+			log.Fatalf("%s: argument must be a positive number", command)
+		}
+		arg = n
 	}
 
-	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, dbURL)
+	cfg := config.DefaultMigrate()
+	// DATABASE_URL is what earlier releases of this tool read
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		cfg.Database.URL = url
+	}
+	if err := config.LoadFile(os.Getenv("CONFIG_FILE"), cfg); err != nil {
+		log.Fatalf("configuration error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, cfg.Database.URL)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatalf("connect to database: %v", err)
 	}
 	defer pool.Close()
 
-	log.Println("Connected to database, running migrations...")
-
-	migrations := []string{
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS price_change DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS volume_ratio DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS bb_upper DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS bb_middle DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS bb_lower DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_r3 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_r2 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_r1 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_pivot DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_s1 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_s2 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS fib_s3 DOUBLE PRECISION",
-		"ALTER TABLE metrics_calculated ADD COLUMN IF NOT EXISTS rsi_14 DOUBLE PRECISION",
+	migrator, err := database.NewMigrator(pool)
+	if err != nil {
+		log.Fatalf("load migrations: %v", err)
 	}
 
-	for _, migration := range migrations {
-		log.Printf("Running: %s", migration)
-		_, err := pool.Exec(ctx, migration)
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, arg)
+		for _, m := range applied {
+			log.Printf("applied %04d_%s", m.Version, m.Name)
+		}
 		if err != nil {
-			log.Printf("WARNING: Migration failed: %v", err)
-		} else {
-			log.Println("✓ Success")
+			log.Fatal(err)
 		}
+		if len(applied) == 0 {
+			log.Println("schema is up to date")
+		}
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		rolledBack, err := migrator.Down(ctx, arg)
+		for _, m := range rolledBack {
+			log.Printf("rolled back %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := ""
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+		}
+		w.Flush()
+	case "verify":
+		if err := migrator.Verify(ctx); err != nil {
+			log.Fatalf("schema does not match this build:\n%v", err)
+		}
+		log.Println("schema matches this build")
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
-
-	log.Println("All migrations completed")
 }
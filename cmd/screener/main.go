@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+	"github.com/bl8ckfz/crypto-screener-backend/internal/archive"
+	"github.com/bl8ckfz/crypto-screener-backend/internal/binance"
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+	"github.com/bl8ckfz/crypto-screener-backend/internal/gateway"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/database"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// screener runs the data collector, metrics calculator, alert engine and API
+// gateway in one process on a shared bus, database pool and HTTP server
+func main() {
+	cfg := config.DefaultScreener()
+	config.MustLoad(cfg)
+
+	// Setup observability
+	logger := observability.NewLogger("screener", cfg.Level())
+	metrics := observability.GetCollector()
+	health := observability.NewHealthChecker()
+
+	logger.WithField("bus", cfg.Bus).Info("Starting screener")
+
+	// Context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Setup tracing
+	shutdownTracing, err := observability.InitTracing(ctx, "screener")
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		logger.Info("Shutdown signal received")
+		cancel()
+	}()
+
+	// Connect to TimescaleDB
+	logger.Info("Connecting to TimescaleDB")
+	db, err := database.NewPostgresPool(ctx, cfg.Database.URL)
+	if err != nil {
+		logger.Fatal("Failed to connect to TimescaleDB", err)
+	}
+	defer db.Close()
+
+	// Refuse to run against a schema this build was not written for
+	if err := database.CheckSchema(ctx, db); err != nil {
+		logger.Fatal("Incompatible database schema", err)
+	}
+
+	// Add database health check
+	health.AddCheck("timescaledb", func(ctx context.Context) error {
+		return db.Ping(ctx)
+	})
+
+	// Track connection pool size
+	metrics.Gauge(observability.MetricDBConnectionPool).Set(float64(db.Stat().TotalConns()))
+
+	// Optional Redis for the ticker cache and alert deduplication
+	var rdb *redis.Client
+	if cfg.Redis.Enabled() {
+		logger.Info("Connecting to Redis")
+		opt, err := cfg.Redis.Options()
+		if err != nil {
+			logger.Fatal("Failed to parse Redis URL", err)
+		}
+		rdb = redis.NewClient(opt)
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			logger.WithField("error", err.Error()).Warn("Failed to connect to Redis, ticker cache and shared deduplication disabled")
+			rdb.Close()
+			rdb = nil
+		} else {
+			defer rdb.Close()
+			health.AddCheck("redis", func(ctx context.Context) error {
+				return rdb.Ping(ctx).Err()
+			})
+			logger.Info("Connected to Redis")
+		}
+	}
+
+	bus, nc, stopBus := openBus(cfg, logger)
+	defer stopBus()
+	if nc != nil {
+		health.AddCheck("nats", func(ctx context.Context) error {
+			if nc.IsClosed() {
+				return fmt.Errorf("NATS connection closed")
+			}
+			return nil
+		})
+	}
+
+	// Data collector: Binance klines onto the CANDLES stream
+	if err := bus.CreateStream(ctx, messaging.CandlesStream); err != nil {
+		logger.Fatal("Failed to create CANDLES stream", err)
+	}
+
+	client := binance.NewClient(logger.Zerolog())
+	logger.Info("Fetching active symbols from Binance")
+	symbols, err := client.GetActiveSymbols(ctx, cfg.Collector.SymbolLimit)
+	if err != nil {
+		logger.Fatal("Failed to fetch active symbols", err)
+	}
+	logger.WithField("count", len(symbols)).Info("Fetched active symbols")
+	metrics.Gauge(observability.MetricWSConnections).Set(float64(len(symbols)))
+
+	wsManager := binance.NewConnectionManager(symbols, bus, cfg.Collector, logger.Zerolog())
+
+	// Metrics calculator: candles to metrics
+	calc := calculator.NewMetricsCalculator(logger.Zerolog(), db)
+	metricsPersister := calculator.NewMetricsPersister(db, cfg.Calculator, logger.Zerolog())
+	defer metricsPersister.Close()
+
+	var snapshots calculator.SnapshotStore
+	switch {
+	case cfg.Calculator.SnapshotDir != "":
+		files, err := calculator.NewFileSnapshots(cfg.Calculator.SnapshotDir)
+		if err != nil {
+			logger.Fatal("Failed to open snapshot directory", err)
+		}
+		snapshots = files
+	case rdb != nil:
+		snapshots = calculator.NewRedisSnapshots(rdb)
+	}
+
+	calcService := calculator.NewService(calc, metricsPersister, snapshots, bus, cfg.Calculator, logger.Zerolog())
+	if err := calcService.Start(ctx); err != nil {
+		logger.Fatal("Failed to start calculator", err)
+	}
+	defer calcService.Stop()
+
+	// Alert engine: metrics to alerts
+	engine := alerts.NewEngine(db, rdb, logger.Zerolog())
+	logger.Info("Loading alert rules")
+	if err := engine.LoadRules(ctx); err != nil {
+		logger.Fatal("Failed to load alert rules", err)
+	}
+
+	notifier := alerts.NewNotifier(cfg.Engine.WebhookURLs, logger.Zerolog())
+	logger.WithField("webhooks", len(cfg.Engine.WebhookURLs)).Info("Initialized notifier")
+
+	alertPersister := alerts.NewAlertPersister(db, logger.Zerolog(), cfg.Engine.PersistBatchSize, cfg.Engine.PersistFlushInterval)
+	defer alertPersister.Close()
+
+	alertService := alerts.NewService(engine, db, alertPersister, notifier, bus, cfg.Engine, logger.Zerolog())
+	if err := alertService.Start(ctx); err != nil {
+		logger.Fatal("Failed to start alert evaluation", err)
+	}
+	defer alertService.Stop()
+
+	// API gateway, which also serves /metrics and the health endpoints
+	srv, err := gateway.New(ctx, cfg.Gateway, gateway.Deps{DB: db, Redis: rdb, Bus: bus, NATS: nc, Health: health}, logger)
+	if err != nil {
+		logger.Fatal("Failed to start API gateway", err)
+	}
+	defer srv.Shutdown()
+
+	httpServer := &http.Server{
+		Addr:         cfg.Gateway.HTTPAddr,
+		Handler:      srv.Routes(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		logger.Infof("API Gateway listening on %s", cfg.Gateway.HTTPAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("HTTP server error", err)
+		}
+	}()
+
+	// Archive closed days if an archive location is configured
+	if cfg.Archive.Enabled() {
+		store, err := archive.NewStore(ctx, cfg.Archive)
+		if err != nil {
+			logger.Fatal("Failed to open archive", err)
+		}
+		go archive.NewArchiver(db, store, logger.Zerolog()).Run(ctx, cfg.Archive.Interval)
+	}
+
+	// Start Binance ticker stream to populate Redis cache
+	if rdb != nil {
+		go binance.StartTickerStream(ctx, rdb, logger.Zerolog())
+	}
+
+	// Start collecting once every consumer is subscribed
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- wsManager.Start(ctx)
+	}()
+
+	logger.Info("Screener started")
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			logger.Error("Connection manager error", err)
+		}
+		cancel()
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Graceful shutdown failed", err)
+	}
+
+	// Give time for final messages to process
+	time.Sleep(1 * time.Second)
+
+	logger.Info("Screener stopped")
+}
+
+// openBus creates the bus selected by cfg.Bus. The NATS connection is nil for
+// the in-memory bus. stop closes the bus and everything it runs on.
+func openBus(cfg *config.Screener, logger *observability.Logger) (bus messaging.Bus, nc *nats.Conn, stop func()) {
+	if cfg.Bus == config.BusMemory {
+		logger.Info("Using in-memory bus")
+		mem := messaging.NewMemoryBus()
+		return mem, nil, func() { mem.Close() }
+	}
+
+	natsCfg := messaging.Config{
+		URL:             cfg.NATS.URL,
+		MaxReconnects:   -1,
+		ReconnectWait:   2 * time.Second,
+		EnableJetStream: true,
+	}
+	stopServer := func() {}
+	if cfg.Bus == config.BusEmbedded {
+		ns, err := messaging.StartEmbeddedServer(cfg.NATSStoreDir)
+		if err != nil {
+			logger.Fatal("Failed to start embedded NATS server", err)
+		}
+		natsCfg.InProcess = ns
+		stopServer = func() {
+			ns.Shutdown()
+			ns.WaitForShutdown()
+		}
+	} else {
+		logger.Infof("Connecting to NATS: %s", cfg.NATS.URL)
+	}
+
+	nc, err := messaging.NewNATSConn(natsCfg)
+	if err != nil {
+		stopServer()
+		logger.Fatal("Failed to connect to NATS", err)
+	}
+
+	js, err := messaging.NewJetStreamBus(nc)
+	if err != nil {
+		nc.Close()
+		stopServer()
+		logger.Fatal("Failed to create JetStream context", err)
+	}
+
+	return js, nc, func() {
+		js.Close()
+		nc.Close()
+		stopServer()
+	}
+}
@@ -0,0 +1,161 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AlertsSubject is where triggered alerts are published for the API Gateway
+const AlertsSubject = "alerts.triggered"
+
+// delivery persists, notifies and publishes triggered alerts, and records the
+// pipeline latency of each one
+type delivery struct {
+	persister  *AlertPersister
+	notifier   *Notifier
+	publisher  messaging.Publisher
+	metrics    *observability.MetricsCollector
+	logger     zerolog.Logger
+	staleAfter time.Duration // lag after which an alert is flagged stale; 0 disables
+	ledger     *ledger       // deduplicates redelivered streamed alerts; nil delivers every time
+}
+
+// deliverOnce delivers an alert triggered by a streamed metrics message unless
+// it was delivered already, recording the delivery under key. It reports
+// false if the alert could not be handled now and the message must be left
+// for redelivery.
+func (d *delivery) deliverOnce(ctx context.Context, key string, alert *Alert, parent nats.Header, evaluated time.Time) bool {
+	if d.ledger == nil {
+		d.deliver(ctx, alert, parent, evaluated)
+		return true
+	}
+
+	sent, err := d.ledger.delivered(ctx, key)
+	if err != nil {
+		d.logger.Warn().Err(err).Str("key", key).Msg("failed to check alert delivery")
+		return false
+	}
+	if sent {
+		d.metrics.CounterWith(observability.MetricAlertsDuplicated, observability.Labels{"rule_type": alert.RuleType}).Inc()
+		d.logger.Debug().Str("symbol", alert.Symbol).Str("rule", alert.RuleType).Msg("alert already delivered")
+		return true
+	}
+
+	claimed, err := d.ledger.claim(ctx, key)
+	if err != nil {
+		d.logger.Warn().Err(err).Str("key", key).Msg("failed to claim alert delivery")
+		return false
+	}
+	if !claimed {
+		d.logger.Debug().Str("symbol", alert.Symbol).Str("rule", alert.RuleType).Msg("alert being delivered by another replica")
+		return false
+	}
+
+	d.deliver(ctx, alert, parent, evaluated)
+
+	// The message is acked even if this fails: redelivering it would repeat
+	// the webhooks just sent
+	if err := d.ledger.markSent(ctx, key); err != nil {
+		d.logger.Warn().Err(err).Str("key", key).Msg("failed to record alert delivery")
+	}
+	return true
+}
+
+// alertMsgID identifies an alert by symbol, rule and the minute of the metrics
+// that triggered it. Periodic evaluation re-triggers an alert every interval
+// until the metrics move on; the ALERTS stream keeps one per window.
+func alertMsgID(alert *Alert) string {
+	return fmt.Sprintf("alert.%s.%s.%d", alert.Symbol, alert.RuleType, alert.Timestamp.Truncate(time.Minute).UnixMilli())
+}
+
+// deliver handles one triggered alert. parent carries the pipeline stamps of
+// the metrics message the alert was evaluated from; it is nil for periodic
+// evaluation, which reads metrics from the database.
+func (d *delivery) deliver(ctx context.Context, alert *Alert, parent nats.Header, evaluated time.Time) {
+	ctx, span := tracer.Start(ctx, "engine.deliver", trace.WithAttributes(
+		attribute.String("symbol", alert.Symbol),
+		attribute.String("rule_type", alert.RuleType),
+		attribute.String("alert.id", alert.ID),
+	))
+	defer span.End()
+
+	// Shadow hits are only recorded, never notified or published
+	if alert.Shadow {
+		span.SetAttributes(attribute.Bool("alert.shadow", true))
+		d.persister.SaveAlert(ctx, alert)
+		return
+	}
+
+	ruleLabels := observability.Labels{"rule_type": alert.RuleType}
+
+	eventTime, hasOrigin := messaging.Timestamp(parent, messaging.HeaderBinanceEventTime)
+	if hasOrigin {
+		if lag := evaluated.Sub(eventTime); d.staleAfter > 0 && lag > d.staleAfter {
+			if alert.Metadata == nil {
+				alert.Metadata = make(map[string]interface{})
+			}
+			alert.Metadata["stale"] = true
+			span.SetAttributes(attribute.Bool("alert.stale", true))
+			alert.Metadata["pipeline_lag_ms"] = float64(lag.Milliseconds())
+			d.metrics.CounterWith(observability.MetricAlertsStale, ruleLabels).Inc()
+			d.logger.Warn().
+				Str("symbol", alert.Symbol).
+				Str("rule", alert.RuleType).
+				Dur("lag", lag).
+				Msg("stale alert")
+		}
+	}
+	if calculated, ok := messaging.Timestamp(parent, messaging.HeaderCalculatorPublished); ok {
+		d.metrics.RecordStage(observability.StageEngine, evaluated.Sub(calculated))
+	}
+
+	// Persist to database
+	d.persister.SaveAlert(ctx, alert)
+
+	out := messaging.NewMsg(AlertsSubject, nil, parent)
+	messaging.SetMsgID(out, alertMsgID(alert))
+	messaging.SetTimestamp(out.Header, messaging.HeaderEnginePublished, evaluated)
+	messaging.InjectTrace(ctx, out)
+
+	// Send webhook notifications
+	if err := d.notifier.SendAlert(ctx, alert); err != nil {
+		d.logger.Error().Err(err).Str("symbol", alert.Symbol).Msg("failed to send webhook")
+		d.metrics.CounterWith(observability.MetricWebhooksFailed, ruleLabels).Inc()
+	} else {
+		d.metrics.CounterWith(observability.MetricWebhooksSent, ruleLabels).Inc()
+		if d.notifier.Enabled() {
+			delivered := time.Now()
+			messaging.SetTimestamp(out.Header, messaging.HeaderWebhookDelivered, delivered)
+			d.metrics.RecordStage(observability.StageWebhook, delivered.Sub(evaluated))
+			if hasOrigin {
+				d.metrics.RecordStage(observability.StageEndToEnd, delivered.Sub(eventTime))
+			}
+		}
+	}
+
+	// Publish to NATS for API Gateway
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to marshal alert")
+		return
+	}
+	out.Data = payload
+
+	if err := d.publisher.Publish(ctx, out); err != nil {
+		d.logger.Error().Err(err).Msg("failed to publish alert")
+		span.RecordError(err)
+		d.metrics.Counter(observability.MetricNATSPublishErrors).Inc()
+		return
+	}
+
+	d.metrics.Counter(observability.MetricNATSMessagesPublished).Inc()
+}
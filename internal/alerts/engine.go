@@ -4,35 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = observability.Tracer("github.com/bl8ckfz/crypto-screener-backend/internal/alerts")
+
 // Engine evaluates metrics against alert rules
 type Engine struct {
-	db     *pgxpool.Pool
-	redis  *redis.Client
-	rules  map[string]*AlertRule
-	logger zerolog.Logger
+	db      *pgxpool.Pool
+	redis   *redis.Client
+	mu      sync.RWMutex
+	rules   map[string]*AlertRule
+	logger  zerolog.Logger
+	metrics *observability.MetricsCollector
 }
 
 // NewEngine creates a new alert engine
 func NewEngine(db *pgxpool.Pool, redis *redis.Client, logger zerolog.Logger) *Engine {
 	return &Engine{
-		db:     db,
-		redis:  redis,
-		rules:  make(map[string]*AlertRule),
-		logger: logger.With().Str("component", "alert-engine").Logger(),
+		db:      db,
+		redis:   redis,
+		rules:   make(map[string]*AlertRule),
+		logger:  logger.With().Str("component", "alert-engine").Logger(),
+		metrics: observability.GetCollector(),
 	}
 }
 
-// LoadRules loads alert rules from PostgreSQL
+// LoadRules loads the enabled alert rules from PostgreSQL, replacing the
+// loaded ones once all are read
 func (e *Engine) LoadRules(ctx context.Context) error {
-	query := `SELECT rule_type, config, description FROM alert_rules`
+	query := `SELECT rule_type, config, COALESCE(description, ''), version FROM alert_rules WHERE enabled IS NOT FALSE`
 
 	rows, err := e.db.Query(ctx, query)
 	if err != nil {
@@ -40,12 +50,12 @@ func (e *Engine) LoadRules(ctx context.Context) error {
 	}
 	defer rows.Close()
 
-	count := 0
+	rules := make(map[string]*AlertRule)
 	for rows.Next() {
-		var rule AlertRule
+		rule := AlertRule{Enabled: true}
 		var configJSON []byte
 
-		if err := rows.Scan(&rule.RuleType, &configJSON, &rule.Description); err != nil {
+		if err := rows.Scan(&rule.RuleType, &configJSON, &rule.Description, &rule.Version); err != nil {
 			return fmt.Errorf("scan rule: %w", err)
 		}
 
@@ -53,21 +63,45 @@ func (e *Engine) LoadRules(ctx context.Context) error {
 			return fmt.Errorf("unmarshal config: %w", err)
 		}
 
-		e.rules[rule.RuleType] = &rule
-		count++
+		rules[rule.RuleType] = &rule
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read rules: %w", err)
 	}
 
-	e.logger.Info().Int("count", count).Msg("loaded alert rules")
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+
+	e.logger.Info().Int("count", len(rules)).Msg("loaded alert rules")
 	return nil
 }
 
+// loadedRules returns the rules of the latest load
+func (e *Engine) loadedRules() map[string]*AlertRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rules
+}
+
 // Evaluate checks if metrics trigger any alert rules
 func (e *Engine) Evaluate(ctx context.Context, metrics *Metrics) ([]*Alert, error) {
+	// A reload swaps the map rather than changing it, so this one stays intact
+	rules := e.loadedRules()
+	ctx, span := tracer.Start(ctx, "alerts.Evaluate", trace.WithAttributes(
+		attribute.String("symbol", metrics.Symbol),
+		attribute.Int("rules", len(rules)),
+	))
+	defer span.End()
+
 	var alerts []*Alert
 
-	for ruleType, rule := range e.rules {
+	for ruleType, rule := range rules {
+		ruleLabels := observability.Labels{"rule_type": ruleType}
+
 		// Check deduplication first
 		if e.isDuplicate(ctx, metrics.Symbol, ruleType, metrics.Timestamp) {
+			e.metrics.CounterWith(observability.MetricAlertsDuplicated, ruleLabels).Inc()
 			continue
 		}
 
@@ -79,11 +113,23 @@ func (e *Engine) Evaluate(ctx context.Context, metrics *Metrics) ([]*Alert, erro
 		}
 
 		// Evaluate rule
-		if e.evaluateRule(ruleType, criteria, metrics) {
+		start := time.Now()
+		triggered := e.evaluateRule(rule.EvaluatorType(), criteria, metrics)
+		e.metrics.HistogramWith(observability.MetricEvaluationDuration, ruleLabels).Observe(time.Since(start).Seconds())
+
+		if triggered {
+			if rule.Shadow() {
+				e.metrics.CounterWith(observability.MetricShadowHits, ruleLabels).Inc()
+			} else {
+				e.metrics.CounterWith(observability.MetricAlertsTriggered, ruleLabels).Inc()
+			}
+
 			alert := &Alert{
 				ID:          uuid.New().String(),
 				Symbol:      metrics.Symbol,
 				RuleType:    ruleType,
+				RuleVersion: rule.Version,
+				Shadow:      rule.Shadow(),
 				Description: rule.Description,
 				Timestamp:   metrics.Timestamp,
 				Price:       metrics.LastPrice,
@@ -106,6 +152,7 @@ func (e *Engine) Evaluate(ctx context.Context, metrics *Metrics) ([]*Alert, erro
 			}
 
 			alerts = append(alerts, alert)
+			span.AddEvent("alert.triggered", trace.WithAttributes(attribute.String("rule_type", ruleType)))
 
 			// Set deduplication key scoped to this candle/window
 			e.setDeduplicationKey(ctx, metrics.Symbol, ruleType, metrics.Timestamp)
@@ -113,15 +160,19 @@ func (e *Engine) Evaluate(ctx context.Context, metrics *Metrics) ([]*Alert, erro
 			e.logger.Info().
 				Str("symbol", metrics.Symbol).
 				Str("rule", ruleType).
+				Bool("shadow", alert.Shadow).
 				Float64("price", metrics.LastPrice).
 				Msg("alert triggered")
 		}
 	}
 
+	span.SetAttributes(attribute.Int("alerts.triggered", len(alerts)))
 	return alerts, nil
 }
 
-// evaluateRule evaluates a specific rule against metrics
+// evaluateRule evaluates metrics with the evaluator of ruleType. The numbers
+// in the evaluators' "Frontend logic" comments are built-in thresholds; the
+// criteria of a rule config override them.
 func (e *Engine) evaluateRule(ruleType string, criteria *AlertCriteria, metrics *Metrics) bool {
 	// Market cap filter (if we had market cap data, we'd check it here)
 	// For now, assuming all symbols pass market cap filter
@@ -157,12 +208,12 @@ func (e *Engine) evaluateRule(ruleType string, criteria *AlertCriteria, metrics
 // change_1d > change_8h && volume_1h > 500_000 && volume_8h > 5_000_000 &&
 // 6 * volume_1h > volume_8h && 16 * volume_1h > volume_1d
 func (e *Engine) evaluateBigBull60(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange1h > 1.6 &&
-		m.PriceChange1d < 15 &&
+	return m.PriceChange1h > threshold(c.Change1hMin, 1.6) &&
+		m.PriceChange1d < threshold(c.Change1dMax, 15) &&
 		m.PriceChange8h > m.PriceChange1h &&
 		m.PriceChange1d > m.PriceChange8h &&
-		m.Candle1h.Volume > 500_000 &&
-		m.Candle8h.Volume > 5_000_000 &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 500_000) &&
+		m.Candle8h.Volume > threshold(c.Volume8hMin, 5_000_000) &&
 		6*m.Candle1h.Volume > m.Candle8h.Volume &&
 		16*m.Candle1h.Volume > m.Candle1d.Volume
 }
@@ -172,12 +223,12 @@ func (e *Engine) evaluateBigBull60(c *AlertCriteria, m *Metrics) bool {
 // change_1d < change_8h && volume_1h > 500_000 && volume_8h > 5_000_000 &&
 // 6 * volume_1h > volume_8h && 16 * volume_1h > volume_1d
 func (e *Engine) evaluateBigBear60(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange1h < -1.6 &&
-		m.PriceChange1d > -15 &&
+	return m.PriceChange1h < threshold(c.Change1hMax, -1.6) &&
+		m.PriceChange1d > threshold(c.Change1dMin, -15) &&
 		m.PriceChange8h < m.PriceChange1h &&
 		m.PriceChange1d < m.PriceChange8h &&
-		m.Candle1h.Volume > 500_000 &&
-		m.Candle8h.Volume > 5_000_000 &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 500_000) &&
+		m.Candle8h.Volume > threshold(c.Volume8hMin, 5_000_000) &&
 		6*m.Candle1h.Volume > m.Candle8h.Volume &&
 		16*m.Candle1h.Volume > m.Candle1d.Volume
 }
@@ -185,8 +236,9 @@ func (e *Engine) evaluateBigBear60(c *AlertCriteria, m *Metrics) bool {
 // evaluatePioneerBull: Early bullish momentum detection
 // Frontend logic: change_5m > 1 && change_15m > 1 && 3 * change_5m > change_15m && 2 * volume_5m > volume_15m
 func (e *Engine) evaluatePioneerBull(c *AlertCriteria, m *Metrics) bool {
-	result := m.PriceChange5m > 1 &&
-		m.PriceChange15m > 1 &&
+	min5m, min15m := threshold(c.Change5mMin, 1), threshold(c.Change15mMin, 1)
+	result := m.PriceChange5m > min5m &&
+		m.PriceChange15m > min15m &&
 		3*m.PriceChange5m > m.PriceChange15m &&
 		2*m.Candle5m.Volume > m.Candle15m.Volume
 	
@@ -198,8 +250,8 @@ func (e *Engine) evaluatePioneerBull(c *AlertCriteria, m *Metrics) bool {
 			Float64("change_15m", m.PriceChange15m).
 			Float64("volume_5m", m.Candle5m.Volume).
 			Float64("volume_15m", m.Candle15m.Volume).
-			Bool("cond1_change_5m>1", m.PriceChange5m > 1).
-			Bool("cond2_change_15m>1", m.PriceChange15m > 1).
+			Bool("cond1_change_5m>min", m.PriceChange5m > min5m).
+			Bool("cond2_change_15m>min", m.PriceChange15m > min15m).
 			Bool("cond3_3x5m>15m", 3*m.PriceChange5m > m.PriceChange15m).
 			Bool("cond4_2xvol5m>vol15m", 2*m.Candle5m.Volume > m.Candle15m.Volume).
 			Msg("Pioneer Bull FAILED - close to triggering")
@@ -217,8 +269,8 @@ func (e *Engine) evaluatePioneerBull(c *AlertCriteria, m *Metrics) bool {
 // evaluatePioneerBear: Early bearish momentum detection
 // Frontend logic: change_5m < -1 && change_15m < -1 && 3 * change_5m < change_15m && 2 * volume_5m > volume_15m
 func (e *Engine) evaluatePioneerBear(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange5m < -1 &&
-		m.PriceChange15m < -1 &&
+	return m.PriceChange5m < threshold(c.Change5mMax, -1) &&
+		m.PriceChange15m < threshold(c.Change15mMax, -1) &&
 		3*m.PriceChange5m < m.PriceChange15m &&
 		2*m.Candle5m.Volume > m.Candle15m.Volume
 }
@@ -228,12 +280,12 @@ func (e *Engine) evaluatePioneerBear(c *AlertCriteria, m *Metrics) bool {
 // volume_5m > 100_000 && volume_1h > 1_000_000 && volume_5m > volume_15m / 3 &&
 // volume_5m > volume_1h / 6 && volume_5m > volume_8h / 66
 func (e *Engine) evaluate5BigBull(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange5m > 0.6 &&
-		m.PriceChange1d < 15 &&
+	return m.PriceChange5m > threshold(c.Change5mMin, 0.6) &&
+		m.PriceChange1d < threshold(c.Change1dMax, 15) &&
 		m.PriceChange15m > m.PriceChange5m &&
 		m.PriceChange1h > m.PriceChange15m &&
-		m.Candle5m.Volume > 100_000 &&
-		m.Candle1h.Volume > 1_000_000 &&
+		m.Candle5m.Volume > threshold(c.Volume5mMin, 100_000) &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 1_000_000) &&
 		m.Candle5m.Volume > m.Candle15m.Volume/3 &&
 		m.Candle5m.Volume > m.Candle1h.Volume/6 &&
 		m.Candle5m.Volume > m.Candle8h.Volume/66
@@ -244,12 +296,12 @@ func (e *Engine) evaluate5BigBull(c *AlertCriteria, m *Metrics) bool {
 // volume_5m > 100_000 && volume_1h > 1_000_000 && volume_5m > volume_15m / 3 &&
 // volume_5m > volume_1h / 6 && volume_5m > volume_8h / 66
 func (e *Engine) evaluate5BigBear(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange5m < -0.6 &&
-		m.PriceChange1d > -15 &&
+	return m.PriceChange5m < threshold(c.Change5mMax, -0.6) &&
+		m.PriceChange1d > threshold(c.Change1dMin, -15) &&
 		m.PriceChange15m < m.PriceChange5m &&
 		m.PriceChange1h < m.PriceChange15m &&
-		m.Candle5m.Volume > 100_000 &&
-		m.Candle1h.Volume > 1_000_000 &&
+		m.Candle5m.Volume > threshold(c.Volume5mMin, 100_000) &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 1_000_000) &&
 		m.Candle5m.Volume > m.Candle15m.Volume/3 &&
 		m.Candle5m.Volume > m.Candle1h.Volume/6 &&
 		m.Candle5m.Volume > m.Candle8h.Volume/66
@@ -259,12 +311,12 @@ func (e *Engine) evaluate5BigBear(c *AlertCriteria, m *Metrics) bool {
 // Frontend logic: change_15m > 1 && change_1d < 15 && change_1h > change_15m && change_8h > change_1h &&
 // volume_15m > 400_000 && volume_1h > 1_000_000 && volume_15m > volume_1h / 3 && volume_15m > volume_8h / 26
 func (e *Engine) evaluate15BigBull(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange15m > 1 &&
-		m.PriceChange1d < 15 &&
+	return m.PriceChange15m > threshold(c.Change15mMin, 1) &&
+		m.PriceChange1d < threshold(c.Change1dMax, 15) &&
 		m.PriceChange1h > m.PriceChange15m &&
 		m.PriceChange8h > m.PriceChange1h &&
-		m.Candle15m.Volume > 400_000 &&
-		m.Candle1h.Volume > 1_000_000 &&
+		m.Candle15m.Volume > threshold(c.Volume15mMin, 400_000) &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 1_000_000) &&
 		m.Candle15m.Volume > m.Candle1h.Volume/3 &&
 		m.Candle15m.Volume > m.Candle8h.Volume/26
 }
@@ -273,12 +325,12 @@ func (e *Engine) evaluate15BigBull(c *AlertCriteria, m *Metrics) bool {
 // Frontend logic: change_15m < -1 && change_1d > -15 && change_1h < change_15m && change_8h < change_1h &&
 // volume_15m > 400_000 && volume_1h > 1_000_000 && volume_15m > volume_1h / 3 && volume_15m > volume_8h / 26
 func (e *Engine) evaluate15BigBear(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange15m < -1 &&
-		m.PriceChange1d > -15 &&
+	return m.PriceChange15m < threshold(c.Change15mMax, -1) &&
+		m.PriceChange1d > threshold(c.Change1dMin, -15) &&
 		m.PriceChange1h < m.PriceChange15m &&
 		m.PriceChange8h < m.PriceChange1h &&
-		m.Candle15m.Volume > 400_000 &&
-		m.Candle1h.Volume > 1_000_000 &&
+		m.Candle15m.Volume > threshold(c.Volume15mMin, 400_000) &&
+		m.Candle1h.Volume > threshold(c.Volume1hMin, 1_000_000) &&
 		m.Candle15m.Volume > m.Candle1h.Volume/3 &&
 		m.Candle15m.Volume > m.Candle8h.Volume/26
 }
@@ -287,9 +339,9 @@ func (e *Engine) evaluate15BigBear(c *AlertCriteria, m *Metrics) bool {
 // Frontend logic: change_1h < -0.7 && change_15m < -0.6 && change_5m > 0.5 &&
 // volume_5m > volume_15m / 2 && volume_5m > volume_1h / 8
 func (e *Engine) evaluateBottomHunter(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange1h < -0.7 &&
-		m.PriceChange15m < -0.6 &&
-		m.PriceChange5m > 0.5 &&
+	return m.PriceChange1h < threshold(c.Change1hMax, -0.7) &&
+		m.PriceChange15m < threshold(c.Change15mMax, -0.6) &&
+		m.PriceChange5m > threshold(c.Change5mMin, 0.5) &&
 		m.Candle5m.Volume > m.Candle15m.Volume/2 &&
 		m.Candle5m.Volume > m.Candle1h.Volume/8
 }
@@ -298,14 +350,24 @@ func (e *Engine) evaluateBottomHunter(c *AlertCriteria, m *Metrics) bool {
 // Frontend logic: change_1h > 0.7 && change_15m > 0.6 && change_5m < -0.5 &&
 // volume_5m > volume_15m / 2 && volume_5m > volume_1h / 8
 func (e *Engine) evaluateTopHunter(c *AlertCriteria, m *Metrics) bool {
-	return m.PriceChange1h > 0.7 &&
-		m.PriceChange15m > 0.6 &&
-		m.PriceChange5m < -0.5 &&
+	return m.PriceChange1h > threshold(c.Change1hMin, 0.7) &&
+		m.PriceChange15m > threshold(c.Change15mMin, 0.6) &&
+		m.PriceChange5m < threshold(c.Change5mMax, -0.5) &&
 		m.Candle5m.Volume > m.Candle15m.Volume/2 &&
 		m.Candle5m.Volume > m.Candle1h.Volume/8
 }
 
 // Helper functions
+
+// threshold returns the configured criterion, or the rule's built-in value
+// when the rule config does not set it
+func threshold(configured *float64, builtIn float64) float64 {
+	if configured != nil {
+		return *configured
+	}
+	return builtIn
+}
+
 func (e *Engine) checkVolumeRatios5m(c *AlertCriteria, m *Metrics) bool {
 	// VolumeRatio5m is already calculated as current 5m volume / previous 5m volume
 	// For 5m alerts, we just check if the ratio meets the threshold
@@ -0,0 +1,110 @@
+package alerts
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// candles sets the 5m, 15m, 1h, 8h and 1d volumes of m
+func candles(m *Metrics, v5m, v15m, v1h, v8h, v1d float64) *Metrics {
+	m.Candle5m.Volume = v5m
+	m.Candle15m.Volume = v15m
+	m.Candle1h.Volume = v1h
+	m.Candle8h.Volume = v8h
+	m.Candle1d.Volume = v1d
+	return m
+}
+
+// evaluatorCases are metrics that trigger each evaluator, and a change to
+// them that misses only the built-in threshold under test
+var evaluatorCases = []struct {
+	ruleType string
+	metrics  func() *Metrics
+	miss     func(*Metrics)
+}{
+	{"futures_big_bull_60",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange1h: 1.7, PriceChange8h: 3, PriceChange1d: 5}, 0, 0, 1_000_000, 5_500_000, 10_000_000)
+		},
+		func(m *Metrics) { m.PriceChange1h = 1.5 }},
+	{"futures_big_bear_60",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange1h: -1.7, PriceChange8h: -3, PriceChange1d: -5}, 0, 0, 1_000_000, 5_500_000, 10_000_000)
+		},
+		func(m *Metrics) { m.PriceChange1h = -1.5 }},
+	{"futures_pioneer_bull",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: 1.1, PriceChange15m: 1.2}, 100, 150, 0, 0, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = 0.9 }},
+	{"futures_pioneer_bear",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: -1.1, PriceChange15m: -1.2}, 100, 150, 0, 0, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = -0.9 }},
+	{"futures_5_big_bull",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: 0.7, PriceChange15m: 1, PriceChange1h: 2, PriceChange1d: 5}, 300_000, 600_000, 1_500_000, 10_000_000, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = 0.5 }},
+	{"futures_5_big_bear",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: -0.7, PriceChange15m: -1, PriceChange1h: -2, PriceChange1d: -5}, 300_000, 600_000, 1_500_000, 10_000_000, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = -0.5 }},
+	{"futures_15_big_bull",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange15m: 1.1, PriceChange1h: 2, PriceChange8h: 3, PriceChange1d: 5}, 0, 600_000, 1_500_000, 10_000_000, 0)
+		},
+		func(m *Metrics) { m.PriceChange15m = 0.9 }},
+	{"futures_15_big_bear",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange15m: -1.1, PriceChange1h: -2, PriceChange8h: -3, PriceChange1d: -5}, 0, 600_000, 1_500_000, 10_000_000, 0)
+		},
+		func(m *Metrics) { m.PriceChange15m = -0.9 }},
+	{"futures_bottom_hunter",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: 0.6, PriceChange15m: -0.7, PriceChange1h: -0.8}, 300_000, 400_000, 1_500_000, 0, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = 0.4 }},
+	{"futures_top_hunter",
+		func() *Metrics {
+			return candles(&Metrics{PriceChange5m: -0.6, PriceChange15m: 0.7, PriceChange1h: 0.8}, 300_000, 400_000, 1_500_000, 0, 0)
+		},
+		func(m *Metrics) { m.PriceChange5m = -0.4 }},
+}
+
+func TestEvaluatorsUseBuiltInThresholdsWithoutCriteria(t *testing.T) {
+	e := &Engine{logger: zerolog.Nop()}
+	criteria, err := e.extractCriteria(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range evaluatorCases {
+		t.Run(tc.ruleType, func(t *testing.T) {
+			if !e.evaluateRule(tc.ruleType, criteria, tc.metrics()) {
+				t.Fatal("did not trigger above the built-in threshold")
+			}
+			m := tc.metrics()
+			tc.miss(m)
+			if e.evaluateRule(tc.ruleType, criteria, m) {
+				t.Fatal("triggered below the built-in threshold")
+			}
+		})
+	}
+}
+
+func TestEvaluatorCriteriaOverrideBuiltInThresholds(t *testing.T) {
+	e := &Engine{logger: zerolog.Nop()}
+	m := candles(&Metrics{PriceChange5m: 0.9, PriceChange15m: 1.2}, 100, 150, 0, 0, 0)
+
+	if e.evaluateRule("futures_pioneer_bull", &AlertCriteria{}, m) {
+		t.Fatal("triggered below the built-in 1% minimum")
+	}
+	lower := 0.8
+	if !e.evaluateRule("futures_pioneer_bull", &AlertCriteria{Change5mMin: &lower}, m) {
+		t.Fatal("did not trigger above the configured 0.8% minimum")
+	}
+}
@@ -0,0 +1,48 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+)
+
+// ledger records the delivery of alerts triggered by streamed metrics, so a
+// metrics message redelivered after a replica dies neither notifies twice nor
+// gets lost. A replica claims an alert before delivering it and marks it sent
+// afterwards. Claims expire, so an alert whose replica died mid-delivery is
+// delivered by the next replica the message reaches.
+//
+// An alert is still notified twice if its replica dies after the webhooks
+// succeeded but before it marked the alert sent.
+type ledger struct {
+	claims messaging.Leases // alerts being delivered
+	sent   messaging.Leases // alerts delivered, kept while their message may be redelivered
+	owner  string
+}
+
+// alertKey identifies the alert of ruleType triggered by the metrics message
+// at stream sequence seq
+func alertKey(seq uint64, ruleType string) string {
+	return fmt.Sprintf("m%d.%s", seq, ruleType)
+}
+
+// delivered reports whether the alert was delivered already
+func (l *ledger) delivered(ctx context.Context, key string) (bool, error) {
+	_, sent, err := l.sent.Holder(ctx, key)
+	return sent, err
+}
+
+// claim reserves the delivery of the alert for this replica. It reports false
+// while another replica is delivering it.
+func (l *ledger) claim(ctx context.Context, key string) (bool, error) {
+	return l.claims.Acquire(ctx, key, l.owner)
+}
+
+// markSent records the alert as delivered and drops the claim
+func (l *ledger) markSent(ctx context.Context, key string) error {
+	if _, err := l.sent.Acquire(ctx, key, l.owner); err != nil {
+		return err
+	}
+	return l.claims.Release(ctx, key, l.owner)
+}
@@ -2,12 +2,16 @@ package alerts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Notifier handles sending alert notifications to external services
@@ -30,14 +34,26 @@ func NewNotifier(webhookURLs []string, logger zerolog.Logger) *Notifier {
 	}
 }
 
+// Enabled reports whether any webhooks are configured
+func (n *Notifier) Enabled() bool {
+	return n.enabled
+}
+
 // SendAlert sends an alert to all configured webhooks
-func (n *Notifier) SendAlert(alert *Alert) error {
+func (n *Notifier) SendAlert(ctx context.Context, alert *Alert) error {
 	if !n.enabled {
 		return nil
 	}
 
+	ctx, span := tracer.Start(ctx, "alerts.SendAlert", trace.WithAttributes(
+		attribute.String("symbol", alert.Symbol),
+		attribute.String("rule_type", alert.RuleType),
+		attribute.Int("webhooks", len(n.webhookURLs)),
+	))
+	defer span.End()
+
 	for _, webhookURL := range n.webhookURLs {
-		if err := n.sendWebhook(webhookURL, alert); err != nil {
+		if err := n.sendWebhook(ctx, webhookURL, alert); err != nil {
 			n.logger.Error().
 				Err(err).
 				Str("webhook", webhookURL).
@@ -58,7 +74,11 @@ func (n *Notifier) SendAlert(alert *Alert) error {
 }
 
 // sendWebhook sends alert to a specific webhook URL
-func (n *Notifier) sendWebhook(webhookURL string, alert *Alert) error {
+func (n *Notifier) sendWebhook(ctx context.Context, webhookURL string, alert *Alert) (err error) {
+	// Webhook URLs embed secrets, so the span only records the host
+	ctx, span := tracer.Start(ctx, "alerts.sendWebhook", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { observability.EndSpan(span, err) }()
+
 	// Format the alert for Discord/Telegram
 	payload := n.formatPayload(alert)
 
@@ -67,10 +87,11 @@ func (n *Notifier) sendWebhook(webhookURL string, alert *Alert) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	span.SetAttributes(attribute.String("server.address", req.URL.Host))
 
 	req.Header.Set("Content-Type", "application/json")
 
@@ -80,6 +101,7 @@ func (n *Notifier) sendWebhook(webhookURL string, alert *Alert) error {
 	}
 	defer resp.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode >= 400 {
 		return fmt.Errorf("webhook returned error status: %d", resp.StatusCode)
 	}
@@ -159,6 +181,15 @@ func (n *Notifier) formatPayload(alert *Alert) map[string]interface{} {
 				"inline": true,
 			})
 		}
+
+		if stale, _ := alert.Metadata["stale"].(bool); stale {
+			lag, _ := alert.Metadata["pipeline_lag_ms"].(float64)
+			fields = append(fields, map[string]interface{}{
+				"name":   "⚠️ Delayed",
+				"value":  fmt.Sprintf("%.0fs after candle close", lag/1000),
+				"inline": false,
+			})
+		}
 	}
 
 	// Discord embed format (also works for many Telegram bots)
@@ -180,12 +211,10 @@ func (n *Notifier) formatPayload(alert *Alert) map[string]interface{} {
 
 // getAlertColor returns embed color based on alert type
 func (n *Notifier) getAlertColor(ruleType string) int {
-	switch ruleType {
-	case "futures_big_bull_60", "futures_pioneer_bull", "futures_5_big_bull",
-		"futures_15_big_bull", "futures_bottom_hunter":
+	switch RuleDirection(ruleType) {
+	case DirectionBullish:
 		return 0x00FF00 // Green for bullish
-	case "futures_big_bear_60", "futures_pioneer_bear", "futures_5_big_bear",
-		"futures_15_big_bear", "futures_top_hunter":
+	case DirectionBearish:
 		return 0xFF0000 // Red for bearish
 	default:
 		return 0x0099FF // Blue for others
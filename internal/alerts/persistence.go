@@ -7,15 +7,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
-)
-
-const (
-	// batchSize is the maximum number of alerts to batch before flushing
-	batchSize = 50
-	// flushInterval is how often to flush alerts to the database
-	flushInterval = 5 * time.Second
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // AlertPersister handles batched writing of alerts to TimescaleDB
@@ -23,18 +19,22 @@ type AlertPersister struct {
 	db     *pgxpool.Pool
 	logger zerolog.Logger
 	queue  []*Alert
+	links  []trace.Link // span contexts of the queued alerts
+	max    int          // queue length that triggers an immediate flush
 	mu     sync.Mutex
 	ticker *time.Ticker
 	done   chan struct{}
 	wg     sync.WaitGroup
 }
 
-// NewAlertPersister creates a new alert persister
-func NewAlertPersister(db *pgxpool.Pool, logger zerolog.Logger) *AlertPersister {
+// NewAlertPersister creates a new alert persister that writes batches of
+// batchSize, or whatever is queued every flushInterval
+func NewAlertPersister(db *pgxpool.Pool, logger zerolog.Logger, batchSize int, flushInterval time.Duration) *AlertPersister {
 	p := &AlertPersister{
 		db:     db,
 		logger: logger,
 		queue:  make([]*Alert, 0, batchSize),
+		max:    batchSize,
 		ticker: time.NewTicker(flushInterval),
 		done:   make(chan struct{}),
 	}
@@ -46,15 +46,19 @@ func NewAlertPersister(db *pgxpool.Pool, logger zerolog.Logger) *AlertPersister
 	return p
 }
 
-// SaveAlert adds an alert to the batch queue
-func (p *AlertPersister) SaveAlert(alert *Alert) {
+// SaveAlert adds an alert to the batch queue. The span in ctx is linked from
+// the span of the batch write that persists the alert.
+func (p *AlertPersister) SaveAlert(ctx context.Context, alert *Alert) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.queue = append(p.queue, alert)
+	if link := trace.LinkFromContext(ctx); link.SpanContext.IsValid() {
+		p.links = append(p.links, link)
+	}
 
 	// Flush if batch is full
-	if len(p.queue) >= batchSize {
+	if len(p.queue) >= p.max {
 		p.flushLocked()
 	}
 }
@@ -97,8 +101,16 @@ func (p *AlertPersister) flushLocked() {
 	copy(alerts, p.queue)
 	p.queue = p.queue[:0]
 
+	ctx, span := tracer.Start(ctx, "alerts.persistBatch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(p.links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(alerts))))
+	p.links = nil
+
 	// Write to database
-	if err := p.writeAlerts(ctx, alerts); err != nil {
+	err := p.writeAlerts(ctx, alerts)
+	observability.EndSpan(span, err)
+	if err != nil {
 		p.logger.Error().Err(err).Int("count", len(alerts)).Msg("Failed to persist alerts")
 		return
 	}
@@ -106,19 +118,38 @@ func (p *AlertPersister) flushLocked() {
 	p.logger.Debug().Int("count", len(alerts)).Msg("Persisted alerts to database")
 }
 
-// writeAlerts writes a batch of alerts to TimescaleDB
+// writeAlerts writes a batch of alerts to TimescaleDB: production alerts to
+// alert_history under the ID clients received them with, and shadow hits to
+// alert_shadow, where periodic evaluation re-triggering on the same metrics
+// adds nothing
 func (p *AlertPersister) writeAlerts(ctx context.Context, alerts []*Alert) error {
 	query := `
 		INSERT INTO alert_history (
-			time,
+			created_at,
+			symbol,
+			rule_type,
+			message,
+			price,
+			metadata,
+			rule_version,
+			alert_id
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, NULLIF($7::INTEGER, 0), COALESCE(NULLIF($8::TEXT, '')::UUID, gen_random_uuid())
+		)
+	`
+	shadowQuery := `
+		INSERT INTO alert_shadow (
+			created_at,
 			symbol,
 			rule_type,
-			description,
+			message,
 			price,
-			metadata
+			metadata,
+			rule_version
 		) VALUES (
-			$1, $2, $3, $4, $5, $6
+			$1, $2, $3, $4, $5, $6, NULLIF($7::INTEGER, 0)
 		)
+		ON CONFLICT (rule_type, symbol, created_at) DO NOTHING
 	`
 
 	batch := &pgxBatch{
@@ -134,14 +165,20 @@ func (p *AlertPersister) writeAlerts(ctx context.Context, alerts []*Alert) error
 			continue
 		}
 
-		batch.Queue(query,
+		args := []interface{}{
 			alert.Timestamp,
 			alert.Symbol,
 			alert.RuleType,
 			alert.Description,
 			alert.Price,
 			metadataJSON,
-		)
+			alert.RuleVersion,
+		}
+		if alert.Shadow {
+			batch.Queue(shadowQuery, args...)
+		} else {
+			batch.Queue(query, append(args, alert.ID)...)
+		}
 	}
 
 	return batch.SendBatch()
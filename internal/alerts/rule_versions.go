@@ -0,0 +1,172 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RuleVersion is an immutable record of one change to a rule: the rule as it
+// was after the change, or before it for a deletion
+type RuleVersion struct {
+	RuleType     string                 `json:"rule_type"`
+	Version      int                    `json:"version"`
+	Action       string                 `json:"action"`
+	Enabled      bool                   `json:"enabled"`
+	Config       map[string]interface{} `json:"config"`
+	Description  string                 `json:"description"`
+	Diff         map[string]FieldChange `json:"diff"`
+	Author       string                 `json:"author"`
+	Reason       string                 `json:"reason"`
+	RolledBackTo *int                   `json:"rolled_back_to,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// FieldChange is the old and new value of one changed field. Config fields
+// are keyed by their dotted path, such as "config.criteria.change_5m_min".
+// A nil value means the field was absent.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+const versionColumns = `rule_type, version, action, enabled, config, description, diff,
+	author, reason, rolled_back_to, created_at`
+
+func scanVersion(row pgx.Row) (*RuleVersion, error) {
+	var v RuleVersion
+	var configJSON, diffJSON []byte
+	err := row.Scan(&v.RuleType, &v.Version, &v.Action, &v.Enabled, &configJSON, &v.Description, &diffJSON,
+		&v.Author, &v.Reason, &v.RolledBackTo, &v.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(configJSON, &v.Config); err != nil {
+		return nil, fmt.Errorf("unmarshal config of %s v%d: %w", v.RuleType, v.Version, err)
+	}
+	if err := json.Unmarshal(diffJSON, &v.Diff); err != nil {
+		return nil, fmt.Errorf("unmarshal diff of %s v%d: %w", v.RuleType, v.Version, err)
+	}
+	return &v, nil
+}
+
+// History returns every version of the rule of ruleType, newest first,
+// including those of a deleted rule
+func (s *RuleStore) History(ctx context.Context, ruleType string) ([]*RuleVersion, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+versionColumns+` FROM alert_rule_versions
+		WHERE rule_type = $1
+		ORDER BY version DESC`, ruleType)
+	if err != nil {
+		return nil, fmt.Errorf("query rule versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*RuleVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan rule version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrRuleNotFound
+	}
+	return versions, nil
+}
+
+// insertVersion records rule as version rule.Version
+func insertVersion(ctx context.Context, tx pgx.Tx, rule *AlertRule, action string, diff map[string]FieldChange, rev Revision) error {
+	configJSON, err := marshalConfig(rule.Config)
+	if err != nil {
+		return err
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	var rolledBackTo *int
+	if rev.rolledBackTo > 0 {
+		rolledBackTo = &rev.rolledBackTo
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO alert_rule_versions
+			(rule_type, version, action, enabled, config, description, diff, author, reason, rolled_back_to)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		rule.RuleType, rule.Version, action, rule.Enabled, configJSON, rule.Description, diffJSON,
+		rev.Author, rev.Reason, rolledBackTo)
+	if err != nil {
+		return fmt.Errorf("record version %d of %s: %w", rule.Version, rule.RuleType, err)
+	}
+	return nil
+}
+
+// ruleDiff returns the fields that differ between two states of a rule,
+// either of which may be nil
+func ruleDiff(from, to *AlertRule) map[string]FieldChange {
+	before, after := ruleFields(from), ruleFields(to)
+	diff := make(map[string]FieldChange)
+	for key, old := range before {
+		if now, ok := after[key]; !ok || !reflect.DeepEqual(old, now) {
+			diff[key] = FieldChange{From: old, To: after[key]}
+		}
+	}
+	for key, now := range after {
+		if _, ok := before[key]; !ok {
+			diff[key] = FieldChange{To: now}
+		}
+	}
+	return diff
+}
+
+// ruleFields flattens the versioned fields of a rule into dotted paths
+func ruleFields(rule *AlertRule) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if rule == nil {
+		return fields
+	}
+	fields["enabled"] = rule.Enabled
+	fields["description"] = rule.Description
+	flatten("config", normalizeJSON(rule.Config), fields)
+	return fields
+}
+
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		out[prefix] = value
+		return
+	}
+	for key, v := range m {
+		flatten(prefix+"."+key, v, out)
+	}
+}
+
+// normalizeJSON round-trips v through JSON, so values compare the same
+// whether they came from a request or the database
+func normalizeJSON(v map[string]interface{}) interface{} {
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRuleDiff(t *testing.T) {
+	// The stored config comes back from JSONB, the new one from a request
+	var stored map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"criteria":{"change_5m_min":1,"volume_5m_min":100000}}`), &stored); err != nil {
+		t.Fatal(err)
+	}
+	before := &AlertRule{RuleType: "futures_pioneer_bull", Enabled: true, Description: "Pioneer Bull", Config: stored}
+	after := &AlertRule{RuleType: "futures_pioneer_bull", Enabled: true, Description: "Pioneer Bull",
+		Config: map[string]interface{}{"criteria": map[string]interface{}{"change_5m_min": 0.8, "change_15m_min": 1}}}
+
+	want := map[string]FieldChange{
+		"config.criteria.change_5m_min":  {From: 1.0, To: 0.8},
+		"config.criteria.volume_5m_min":  {From: 100000.0},
+		"config.criteria.change_15m_min": {To: 1.0},
+	}
+	if got := ruleDiff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %v, want %v", got, want)
+	}
+
+	if got := ruleDiff(before, before); len(got) != 0 {
+		t.Errorf("diff of unchanged rule = %v", got)
+	}
+	if got := ruleDiff(&AlertRule{Enabled: true}, &AlertRule{Enabled: true, Config: map[string]interface{}{}}); len(got) != 0 {
+		t.Errorf("nil and empty config differ: %v", got)
+	}
+
+	created := ruleDiff(nil, before)
+	if created["enabled"] != (FieldChange{To: true}) || created["config.criteria.change_5m_min"] != (FieldChange{To: 1.0}) {
+		t.Errorf("diff of created rule = %v", created)
+	}
+	deleted := ruleDiff(before, nil)
+	if deleted["description"] != (FieldChange{From: "Pioneer Bull"}) || len(deleted) != 4 {
+		t.Errorf("diff of deleted rule = %v", deleted)
+	}
+}
+
+func TestRevisionRequiresAuthorAndReason(t *testing.T) {
+	for _, rev := range []Revision{{Reason: "tighten"}, {Author: "ops@example.com"}, {Author: "ops@example.com", Reason: "  "}} {
+		if err := rev.validate(); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("validate(%+v) = %v, want ErrInvalidRule", rev, err)
+		}
+	}
+	if err := (Revision{Author: "ops@example.com", Reason: "tighten"}).validate(); err != nil {
+		t.Errorf("valid revision rejected: %v", err)
+	}
+}
@@ -0,0 +1,415 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RulesChangedSubject carries a RuleChange after each change to alert_rules.
+// Alert engines reload their rules when they see one.
+const RulesChangedSubject = "rules.changed"
+
+// Rule change actions
+const (
+	RuleCreated    = "created"
+	RuleUpdated    = "updated"
+	RuleEnabled    = "enabled"
+	RuleDisabled   = "disabled"
+	RuleDeleted    = "deleted"
+	RuleRolledBack = "rolled_back"
+)
+
+// RuleChange is the payload of a RulesChangedSubject message
+type RuleChange struct {
+	RuleType string `json:"rule_type"`
+	Action   string `json:"action"`
+}
+
+var (
+	// ErrInvalidRule wraps the problems ValidateRule finds
+	ErrInvalidRule = errors.New("invalid alert rule")
+	// ErrRuleNotFound is returned for a rule type that is not in alert_rules
+	ErrRuleNotFound = errors.New("alert rule not found")
+	// ErrRuleExists is returned when creating a rule type that is already stored
+	ErrRuleExists = errors.New("alert rule already exists")
+	// ErrRuleInUse is returned when deleting a rule users are subscribed to
+	ErrRuleInUse = errors.New("alert rule has user subscriptions")
+	// ErrVersionNotFound is returned for a rule version that was never stored
+	ErrVersionNotFound = errors.New("alert rule version not found")
+)
+
+// ruleConfig is the schema of alert_rules.config
+type ruleConfig struct {
+	Mode      string         `json:"mode,omitempty"`
+	Evaluator string         `json:"evaluator,omitempty"`
+	Criteria  *AlertCriteria `json:"criteria,omitempty"`
+}
+
+// shadowRuleType is the form of rule types other than the evaluators'
+var shadowRuleType = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ValidateRule checks that the engine has an evaluator for the rule and that
+// the config matches its schema: mode production or shadow, no unknown keys,
+// each minimum at most its maximum, no negative volumes and positive ratios.
+// A rule type without an evaluator of its own must be a shadow rule naming
+// the evaluator it runs.
+func ValidateRule(rule *AlertRule) error {
+	var problems []string
+	cfg, err := decodeConfig(rule.Config)
+	if err != nil {
+		problems = append(problems, "config: "+err.Error())
+	} else {
+		problems = append(problems, checkMode(rule.RuleType, cfg)...)
+		if cfg.Criteria != nil {
+			problems = append(problems, checkCriteria(cfg.Criteria)...)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidRule, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// decodeConfig decodes config strictly, so a misspelt threshold is an
+// error rather than a silently ignored key
+func decodeConfig(config map[string]interface{}) (*ruleConfig, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var cfg ruleConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func checkMode(ruleType string, cfg *ruleConfig) []string {
+	var problems []string
+	if cfg.Mode != "" && cfg.Mode != RuleModeProduction && cfg.Mode != RuleModeShadow {
+		problems = append(problems, fmt.Sprintf("config.mode: must be %s or %s", RuleModeProduction, RuleModeShadow))
+	}
+	if cfg.Evaluator != "" && RuleDirection(cfg.Evaluator) == "" {
+		problems = append(problems, fmt.Sprintf("config.evaluator: unknown rule type %q", cfg.Evaluator))
+	}
+
+	if RuleDirection(ruleType) != "" {
+		if cfg.Evaluator != "" && cfg.Evaluator != ruleType {
+			problems = append(problems, "config.evaluator: only shadow rules of another name may set it")
+		}
+		return problems
+	}
+	switch {
+	case !shadowRuleType.MatchString(ruleType):
+		problems = append(problems, "rule_type: must be lowercase letters, digits and underscores")
+	case cfg.Mode != RuleModeShadow || cfg.Evaluator == "":
+		problems = append(problems, fmt.Sprintf("rule_type: %q has no evaluator; set config.mode shadow and config.evaluator", ruleType))
+	}
+	return problems
+}
+
+func checkCriteria(c *AlertCriteria) []string {
+	var problems []string
+	bounds := []struct {
+		name     string
+		min, max *float64
+	}{
+		{"change_5m", c.Change5mMin, c.Change5mMax},
+		{"change_15m", c.Change15mMin, c.Change15mMax},
+		{"change_1h", c.Change1hMin, c.Change1hMax},
+		{"change_8h", c.Change8hMin, c.Change8hMax},
+		{"change_1d", c.Change1dMin, c.Change1dMax},
+		{"market_cap", c.MarketCapMin, c.MarketCapMax},
+	}
+	for _, b := range bounds {
+		if b.min != nil && b.max != nil && *b.min > *b.max {
+			problems = append(problems, fmt.Sprintf("criteria.%s_min: must not exceed %s_max", b.name, b.name))
+		}
+	}
+
+	type threshold struct {
+		name  string
+		value *float64
+	}
+	nonNegative := []threshold{
+		{"volume_5m_min", c.Volume5mMin},
+		{"volume_15m_min", c.Volume15mMin},
+		{"volume_1h_min", c.Volume1hMin},
+		{"volume_8h_min", c.Volume8hMin},
+		{"market_cap_min", c.MarketCapMin},
+	}
+	positive := []threshold{
+		{"volume_ratio_5m_15m", c.VolumeRatio5m15m},
+		{"volume_ratio_5m_1h", c.VolumeRatio5m1h},
+		{"volume_ratio_5m_8h", c.VolumeRatio5m8h},
+		{"volume_ratio_15m_1h", c.VolumeRatio15m1h},
+		{"volume_ratio_15m_8h", c.VolumeRatio15m8h},
+		{"volume_ratio_1h_8h", c.VolumeRatio1h8h},
+		{"volume_ratio_1h_1d", c.VolumeRatio1h1d},
+		{"change_acceleration", c.ChangeAcceleration},
+	}
+	for _, t := range nonNegative {
+		if t.value != nil && *t.value < 0 {
+			problems = append(problems, "criteria."+t.name+": must not be negative")
+		}
+	}
+	for _, t := range positive {
+		if t.value != nil && *t.value <= 0 {
+			problems = append(problems, "criteria."+t.name+": must be positive")
+		}
+	}
+	return problems
+}
+
+// Revision says who changes a rule and why. Each change is stored as a new
+// version of the rule with its revision.
+type Revision struct {
+	Author string
+	Reason string
+
+	rolledBackTo int // set by Rollback
+}
+
+func (r Revision) validate() error {
+	if strings.TrimSpace(r.Author) == "" {
+		return fmt.Errorf("%w: author is required", ErrInvalidRule)
+	}
+	if strings.TrimSpace(r.Reason) == "" {
+		return fmt.Errorf("%w: reason is required", ErrInvalidRule)
+	}
+	return nil
+}
+
+// RuleStore reads and changes alert_rules, recording every change in
+// alert_rule_versions
+type RuleStore struct {
+	db *pgxpool.Pool
+}
+
+// NewRuleStore creates a rule store on db
+func NewRuleStore(db *pgxpool.Pool) *RuleStore {
+	return &RuleStore{db: db}
+}
+
+const ruleColumns = `rule_type, COALESCE(enabled, true), config, COALESCE(description, ''), version,
+	COALESCE(created_at, NOW()), COALESCE(updated_at, NOW())`
+
+func scanRule(row pgx.Row) (*AlertRule, error) {
+	var rule AlertRule
+	var configJSON []byte
+	if err := row.Scan(&rule.RuleType, &rule.Enabled, &configJSON, &rule.Description, &rule.Version, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRuleNotFound
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(configJSON, &rule.Config); err != nil {
+		return nil, fmt.Errorf("unmarshal config of %s: %w", rule.RuleType, err)
+	}
+	return &rule, nil
+}
+
+// List returns every rule, enabled or not, ordered by rule type
+func (s *RuleStore) List(ctx context.Context) ([]*AlertRule, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+ruleColumns+` FROM alert_rules ORDER BY rule_type`)
+	if err != nil {
+		return nil, fmt.Errorf("query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*AlertRule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// Get returns the rule of ruleType
+func (s *RuleStore) Get(ctx context.Context, ruleType string) (*AlertRule, error) {
+	return scanRule(s.db.QueryRow(ctx, `SELECT `+ruleColumns+` FROM alert_rules WHERE rule_type = $1`, ruleType))
+}
+
+// Create validates and stores a new rule. A rule type that was deleted
+// continues its version numbers.
+func (s *RuleStore) Create(ctx context.Context, rule *AlertRule, rev Revision) (*AlertRule, error) {
+	return s.apply(ctx, rule.RuleType, RuleCreated, rev, func(current *AlertRule) (*AlertRule, error) {
+		if current != nil {
+			return nil, ErrRuleExists
+		}
+		return rule, nil
+	})
+}
+
+// Update validates rule and replaces the config and description of the
+// stored rule of the same type
+func (s *RuleStore) Update(ctx context.Context, rule *AlertRule, rev Revision) (*AlertRule, error) {
+	return s.apply(ctx, rule.RuleType, RuleUpdated, rev, func(current *AlertRule) (*AlertRule, error) {
+		if current == nil {
+			return nil, ErrRuleNotFound
+		}
+		next := *current
+		next.Config = rule.Config
+		next.Description = rule.Description
+		return &next, nil
+	})
+}
+
+// SetEnabled enables or disables the rule of ruleType
+func (s *RuleStore) SetEnabled(ctx context.Context, ruleType string, enabled bool, rev Revision) (*AlertRule, error) {
+	action := RuleDisabled
+	if enabled {
+		action = RuleEnabled
+	}
+	return s.apply(ctx, ruleType, action, rev, func(current *AlertRule) (*AlertRule, error) {
+		if current == nil {
+			return nil, ErrRuleNotFound
+		}
+		next := *current
+		next.Enabled = enabled
+		return &next, nil
+	})
+}
+
+// Rollback restores the config, description and enabled flag of a previous
+// version as a new version. A deleted rule is re-created.
+func (s *RuleStore) Rollback(ctx context.Context, ruleType string, version int, rev Revision) (*AlertRule, error) {
+	target, err := scanVersion(s.db.QueryRow(ctx,
+		`SELECT `+versionColumns+` FROM alert_rule_versions WHERE rule_type = $1 AND version = $2`, ruleType, version))
+	if err != nil {
+		return nil, err
+	}
+	if target.Action == RuleDeleted {
+		return nil, fmt.Errorf("%w: version %d deleted the rule; roll back to an earlier one", ErrInvalidRule, version)
+	}
+	rev.rolledBackTo = version
+	return s.apply(ctx, ruleType, RuleRolledBack, rev, func(current *AlertRule) (*AlertRule, error) {
+		return &AlertRule{RuleType: ruleType, Enabled: target.Enabled, Config: target.Config, Description: target.Description}, nil
+	})
+}
+
+// Delete removes the rule of ruleType, keeping its history. A rule users
+// are subscribed to can only be disabled.
+func (s *RuleStore) Delete(ctx context.Context, ruleType string, rev Revision) error {
+	if err := rev.validate(); err != nil {
+		return err
+	}
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockRule(ctx, tx, ruleType)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return ErrRuleNotFound
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM alert_rules WHERE rule_type = $1`, ruleType); err != nil {
+			return err
+		}
+		deleted := *current
+		deleted.Version++
+		return insertVersion(ctx, tx, &deleted, RuleDeleted, ruleDiff(current, nil), rev)
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrRuleInUse
+	}
+	return err
+}
+
+// apply stores the rule next returns for the current state of ruleType, nil
+// if it is not stored, as a new version. Rows are locked until the version is
+// recorded, so concurrent changes get consecutive versions. A change that
+// alters nothing stores no version.
+func (s *RuleStore) apply(ctx context.Context, ruleType, action string, rev Revision, next func(current *AlertRule) (*AlertRule, error)) (*AlertRule, error) {
+	if err := rev.validate(); err != nil {
+		return nil, err
+	}
+	var stored *AlertRule
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockRule(ctx, tx, ruleType)
+		if err != nil {
+			return err
+		}
+		rule, err := next(current)
+		if err != nil {
+			return err
+		}
+		if err := ValidateRule(rule); err != nil {
+			return err
+		}
+		configJSON, err := marshalConfig(rule.Config)
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			stored, err = scanRule(tx.QueryRow(ctx, `
+				INSERT INTO alert_rules (rule_type, enabled, config, description, version)
+				VALUES ($1, $2, $3, $4,
+					(SELECT COALESCE(MAX(version), 0) + 1 FROM alert_rule_versions WHERE rule_type = $1))
+				RETURNING `+ruleColumns,
+				ruleType, rule.Enabled, configJSON, rule.Description))
+			if err != nil {
+				return err
+			}
+			return insertVersion(ctx, tx, stored, action, ruleDiff(nil, stored), rev)
+		}
+
+		diff := ruleDiff(current, rule)
+		if len(diff) == 0 {
+			stored = current
+			return nil
+		}
+		stored, err = scanRule(tx.QueryRow(ctx, `
+			UPDATE alert_rules SET enabled = $2, config = $3, description = $4,
+				version = version + 1, updated_at = NOW()
+			WHERE rule_type = $1
+			RETURNING `+ruleColumns,
+			ruleType, rule.Enabled, configJSON, rule.Description))
+		if err != nil {
+			return err
+		}
+		return insertVersion(ctx, tx, stored, action, diff, rev)
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// A concurrent create won the race for the rule type
+		return nil, ErrRuleExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// lockRule returns the stored rule of ruleType locked for the transaction,
+// or nil if there is none
+func lockRule(ctx context.Context, tx pgx.Tx, ruleType string) (*AlertRule, error) {
+	rule, err := scanRule(tx.QueryRow(ctx, `SELECT `+ruleColumns+` FROM alert_rules WHERE rule_type = $1 FOR UPDATE`, ruleType))
+	if errors.Is(err, ErrRuleNotFound) {
+		return nil, nil
+	}
+	return rule, err
+}
+
+func marshalConfig(config map[string]interface{}) ([]byte, error) {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	return json.Marshal(config)
+}
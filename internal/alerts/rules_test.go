@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		problem string // empty for a valid rule
+	}{
+		{"empty config", AlertRule{RuleType: "futures_pioneer_bull"}, ""},
+		{"criteria", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"change_5m_min": 0.8, "change_5m_max": 5, "volume_ratio_5m_15m": 0.5},
+		}}, ""},
+		{"unknown rule type", AlertRule{RuleType: "futures_moon"}, "has no evaluator"},
+		{"shadow rule", AlertRule{RuleType: "pioneer_bull_080", Config: map[string]interface{}{
+			"mode": "shadow", "evaluator": "futures_pioneer_bull", "criteria": map[string]interface{}{"change_5m_min": 0.8},
+		}}, ""},
+		{"shadow production rule", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"mode": "shadow",
+		}}, ""},
+		{"production rule of another name", AlertRule{RuleType: "pioneer_bull_080", Config: map[string]interface{}{
+			"evaluator": "futures_pioneer_bull",
+		}}, "has no evaluator"},
+		{"unknown evaluator", AlertRule{RuleType: "pioneer_moon", Config: map[string]interface{}{
+			"mode": "shadow", "evaluator": "futures_moon",
+		}}, `config.evaluator: unknown rule type "futures_moon"`},
+		{"evaluator of another rule", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"evaluator": "futures_pioneer_bear",
+		}}, "only shadow rules of another name"},
+		{"unknown mode", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"mode": "dry-run",
+		}}, "config.mode"},
+		{"rule type in path form", AlertRule{RuleType: "Pioneer/080", Config: map[string]interface{}{
+			"mode": "shadow", "evaluator": "futures_pioneer_bull",
+		}}, "lowercase letters"},
+		{"unknown config key", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"threshold": 1,
+		}}, `unknown field "threshold"`},
+		{"misspelt criterion", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"change_5m_minimum": 0.8},
+		}}, `unknown field "change_5m_minimum"`},
+		{"wrong type", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"change_5m_min": "high"},
+		}}, "change_5m_min"},
+		{"min above max", AlertRule{RuleType: "futures_pioneer_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"change_1h_min": 3, "change_1h_max": 2},
+		}}, "change_1h_min: must not exceed change_1h_max"},
+		{"negative volume", AlertRule{RuleType: "futures_5_big_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"volume_5m_min": -1},
+		}}, "volume_5m_min: must not be negative"},
+		{"zero ratio", AlertRule{RuleType: "futures_5_big_bull", Config: map[string]interface{}{
+			"criteria": map[string]interface{}{"volume_ratio_5m_1h": 0},
+		}}, "volume_ratio_5m_1h: must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRule(&tt.rule)
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidRule) || !strings.Contains(err.Error(), tt.problem) {
+				t.Fatalf("error = %v, want ErrInvalidRule mentioning %q", err, tt.problem)
+			}
+		})
+	}
+}
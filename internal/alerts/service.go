@@ -0,0 +1,495 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MetricsSubject is the subject of the metrics the service evaluates
+	MetricsSubject = "metrics.calculated"
+
+	// consumerName is the durable consumer of metrics.calculated. Replicas
+	// share it, so each metrics message is handled by one of them.
+	consumerName = "alert-engine"
+
+	// leaderBucket holds the lease of the replica running periodic evaluation
+	leaderBucket = "alert-engine-leader"
+	leaderKey    = "leader"
+
+	// claimBucket and sentBucket hold the delivery ledger of streamed alerts
+	claimBucket = "alert-engine-claims"
+	sentBucket  = "alert-engine-sent"
+)
+
+// Service evaluates every metrics message from the bus against the loaded
+// rules, re-evaluates the latest stored metrics every interval to catch
+// intra-minute spikes, and delivers the alerts that trigger.
+//
+// Any number of replicas may run. Metrics messages are shared between them
+// and acked only once their alerts are delivered, so a message a replica dies
+// with is redelivered to another; the delivery ledger keeps its alerts from
+// being notified twice. Periodic evaluation runs on the replica holding the
+// leader lease only.
+type Service struct {
+	engine   *Engine
+	bus      messaging.Bus
+	delivery *delivery
+	interval time.Duration
+	leaseTTL time.Duration
+	ackWait  time.Duration
+	owner    string
+	lease    messaging.Leases
+	leader   atomic.Bool
+	metrics  *observability.MetricsCollector
+	logger   zerolog.Logger
+	sub      messaging.Subscription
+	rulesSub messaging.Subscription
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	// latest returns the latest stored metrics of every symbol
+	latest func(ctx context.Context) ([]*Metrics, error)
+}
+
+// NewService creates an alert service. Alerts whose metrics lag the Binance
+// event by more than cfg.StaleAlertThreshold are flagged stale; 0 disables
+// the check.
+func NewService(engine *Engine, db *pgxpool.Pool, persister *AlertPersister, notifier *Notifier, bus messaging.Bus, cfg config.Engine, logger zerolog.Logger) *Service {
+	metrics := observability.GetCollector()
+	logger = logger.With().Str("component", "alert-service").Logger()
+	return &Service{
+		engine: engine,
+		bus:    bus,
+		delivery: &delivery{
+			persister:  persister,
+			notifier:   notifier,
+			publisher:  bus,
+			metrics:    metrics,
+			logger:     logger,
+			staleAfter: cfg.StaleAlertThreshold,
+		},
+		interval: cfg.EvaluationInterval,
+		leaseTTL: cfg.LeaderLeaseTTL,
+		ackWait:  messaging.DefaultAckWait,
+		owner:    messaging.InstanceID(),
+		metrics:  metrics,
+		logger:   logger,
+		latest: func(ctx context.Context) ([]*Metrics, error) {
+			return queryLatestMetrics(ctx, db)
+		},
+	}
+}
+
+// Start ensures the ALERTS stream exists, subscribes to metrics.calculated,
+// follows rule changes and starts periodic evaluation. All run until ctx is
+// done or Stop is called.
+func (s *Service) Start(ctx context.Context) error {
+	if err := s.bus.CreateStream(ctx, messaging.AlertsStream); err != nil {
+		return fmt.Errorf("create ALERTS stream: %w", err)
+	}
+
+	lease, err := s.bus.Leases(ctx, leaderBucket, s.leaseTTL)
+	if err != nil {
+		return fmt.Errorf("open leader lease: %w", err)
+	}
+	s.lease = lease
+
+	// A claim outlives the handling of its message; a delivery is remembered
+	// for as long as the message can be redelivered
+	claims, err := s.bus.Leases(ctx, claimBucket, s.ackWait)
+	if err != nil {
+		return fmt.Errorf("open delivery claims: %w", err)
+	}
+	sent, err := s.bus.Leases(ctx, sentBucket, messaging.MetricsStream.MaxAge)
+	if err != nil {
+		return fmt.Errorf("open delivery ledger: %w", err)
+	}
+	s.delivery.ledger = &ledger{claims: claims, sent: sent, owner: s.owner}
+
+	s.logger.Info().Str("instance", s.owner).Msg("subscribing to " + MetricsSubject)
+	sub, err := s.bus.Subscribe(ctx, MetricsSubject, messaging.ConsumerConfig{Durable: consumerName, AckWait: s.ackWait}, s.handleMetrics)
+	if err != nil {
+		return fmt.Errorf("subscribe to metrics: %w", err)
+	}
+	s.sub = sub
+
+	// Every replica reloads its rules after a change made through the API
+	rulesSub, err := s.bus.Listen(ctx, RulesChangedSubject, s.handleRulesChanged)
+	if err != nil {
+		sub.Unsubscribe()
+		return fmt.Errorf("listen for rule changes: %w", err)
+	}
+	s.rulesSub = rulesSub
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	s.logger.Info().Dur("interval", s.interval).Msg("starting periodic evaluation")
+	go func() {
+		defer close(s.done)
+		s.runPeriodicEvaluation(ctx)
+	}()
+	return nil
+}
+
+// Stop unsubscribes and stops periodic evaluation, waiting for the
+// evaluation in progress, and hands leadership to a standby replica
+func (s *Service) Stop() {
+	if s.sub != nil {
+		if err := s.sub.Unsubscribe(); err != nil {
+			s.logger.Error().Err(err).Msg("failed to unsubscribe")
+		}
+	}
+	if s.rulesSub != nil {
+		s.rulesSub.Unsubscribe()
+	}
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	if s.leader.Swap(false) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.lease.Release(ctx, leaderKey, s.owner); err != nil {
+			s.logger.Warn().Err(err).Msg("failed to release leader lease")
+		}
+		s.metrics.Gauge(observability.MetricEngineLeader).Set(0)
+	}
+}
+
+// Leader reports whether this replica runs periodic evaluation
+func (s *Service) Leader() bool {
+	return s.leader.Load()
+}
+
+func (s *Service) handleRulesChanged(ctx context.Context, msg *messaging.Msg) {
+	var change RuleChange
+	if err := json.Unmarshal(msg.Data, &change); err != nil {
+		s.logger.Warn().Err(err).Msg("failed to unmarshal rule change")
+	}
+	s.logger.Info().Str("rule", change.RuleType).Str("action", change.Action).Msg("reloading rules")
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := s.engine.LoadRules(ctx); err != nil {
+		s.logger.Error().Err(err).Msg("failed to reload rules, keeping the loaded ones")
+	}
+}
+
+// convertCandle converts calculator.TimeframeCandle to TimeframeCandle
+func convertCandle(c calculator.TimeframeCandle) TimeframeCandle {
+	return TimeframeCandle{
+		Open:   c.Open,
+		High:   c.High,
+		Low:    c.Low,
+		Close:  c.Close,
+		Volume: c.Volume,
+	}
+}
+
+func (s *Service) handleMetrics(ctx context.Context, msg *messaging.Msg) {
+	// The message is acked unless an alert has to wait for redelivery
+	handled := true
+	defer func() {
+		if handled {
+			msg.Ack()
+		}
+	}()
+
+	// Continue the trace of the candle these metrics were calculated from
+	msgCtx, span := tracer.Start(messaging.ExtractTrace(ctx, msg.Header), "engine.handleMetrics",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.subject", msg.Subject)))
+	defer span.End()
+
+	var metricsData calculator.SymbolMetrics
+	if err := json.Unmarshal(msg.Data, &metricsData); err != nil {
+		s.logger.Error().Err(err).Msg("failed to unmarshal metrics")
+		span.RecordError(err)
+		return
+	}
+
+	alertMetrics := &Metrics{
+		Symbol:         metricsData.Symbol,
+		Timestamp:      metricsData.Timestamp,
+		LastPrice:      metricsData.LastPrice,
+		Candle1m:       convertCandle(metricsData.Candle1m),
+		Candle5m:       convertCandle(metricsData.Candle5m),
+		Candle15m:      convertCandle(metricsData.Candle15m),
+		Candle1h:       convertCandle(metricsData.Candle1h),
+		Candle8h:       convertCandle(metricsData.Candle8h),
+		Candle1d:       convertCandle(metricsData.Candle1d),
+		PriceChange5m:  metricsData.PriceChange5m,
+		PriceChange15m: metricsData.PriceChange15m,
+		PriceChange1h:  metricsData.PriceChange1h,
+		PriceChange8h:  metricsData.PriceChange8h,
+		PriceChange1d:  metricsData.PriceChange1d,
+		VolumeRatio5m:  metricsData.VolumeRatio5m,
+		VolumeRatio15m: metricsData.VolumeRatio15m,
+		VolumeRatio1h:  metricsData.VolumeRatio1h,
+		VolumeRatio8h:  metricsData.VolumeRatio8h,
+		VCP:            metricsData.VCP,
+		RSI:            metricsData.RSI,
+	}
+
+	s.logger.Debug().
+		Str("symbol", alertMetrics.Symbol).
+		Float64("price", alertMetrics.LastPrice).
+		Float64("change_5m", alertMetrics.PriceChange5m).
+		Float64("change_15m", alertMetrics.PriceChange15m).
+		Float64("change_1h", alertMetrics.PriceChange1h).
+		Float64("change_8h", alertMetrics.PriceChange8h).
+		Float64("change_1d", alertMetrics.PriceChange1d).
+		Float64("volume_5m", alertMetrics.Candle5m.Volume).
+		Float64("volume_15m", alertMetrics.Candle15m.Volume).
+		Float64("volume_1h", alertMetrics.Candle1h.Volume).
+		Float64("vcp", alertMetrics.VCP).
+		Msg("received metrics for evaluation")
+
+	s.metrics.Counter(observability.MetricNATSMessagesReceived).Inc()
+
+	// Evaluate all rules (the engine records per-rule evaluation time)
+	triggered, err := s.engine.Evaluate(msgCtx, alertMetrics)
+	if err != nil {
+		s.logger.Error().Err(err).Str("symbol", alertMetrics.Symbol).Msg("failed to evaluate rules")
+		return
+	}
+
+	s.metrics.CounterWith(observability.MetricAlertsEvaluated, observability.Labels{"source": "stream"}).Inc()
+
+	evaluated := time.Now()
+	for _, alert := range triggered {
+		if !s.delivery.deliverOnce(msgCtx, alertKey(msg.Sequence, alert.RuleType), alert, msg.Header, evaluated) {
+			handled = false
+		}
+	}
+}
+
+// runPeriodicEvaluation evaluates the latest stored metrics every interval
+// while this replica is leader. This catches intra-minute price spikes that
+// the stream evaluation might miss.
+func (s *Service) runPeriodicEvaluation(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.lead(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			if s.lead(ctx) {
+				s.evaluateLatest(ctx)
+			}
+
+		case <-ctx.Done():
+			s.logger.Info().Msg("stopping periodic evaluation")
+			return
+		}
+	}
+}
+
+// lead takes or renews the leader lease and reports whether this replica
+// leads. A leader that cannot renew stops evaluating at once, well before a
+// standby can take the expired lease over.
+func (s *Service) lead(ctx context.Context) bool {
+	ok, err := s.lease.Acquire(ctx, leaderKey, s.owner)
+	if err != nil && ctx.Err() == nil {
+		s.logger.Warn().Err(err).Msg("failed to renew leader lease")
+	}
+	leading := ok && err == nil
+
+	if s.leader.Swap(leading) != leading {
+		if leading {
+			s.logger.Info().Str("instance", s.owner).Msg("became leader, running periodic evaluation")
+			s.metrics.Gauge(observability.MetricEngineLeader).Set(1)
+		} else {
+			s.logger.Info().Str("instance", s.owner).Msg("lost leadership, standing by")
+			s.metrics.Gauge(observability.MetricEngineLeader).Set(0)
+		}
+	}
+	return leading
+}
+
+// evaluateLatest runs one periodic evaluation pass over the latest metrics
+// of every symbol
+func (s *Service) evaluateLatest(ctx context.Context) {
+	metricsSlice, err := s.latest(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to query latest metrics")
+		return
+	}
+
+	// Each pass starts its own trace; alerts it triggers are not tied to a candle
+	passCtx, span := tracer.Start(ctx, "engine.periodicEvaluation",
+		trace.WithAttributes(attribute.Int("symbols", len(metricsSlice))))
+	defer span.End()
+
+	evaluationCount := 0
+	alertCount := 0
+	for _, m := range metricsSlice {
+		triggered, err := s.engine.Evaluate(passCtx, m)
+		if err != nil {
+			continue
+		}
+
+		evaluationCount++
+		s.metrics.CounterWith(observability.MetricAlertsEvaluated, observability.Labels{"source": "periodic"}).Inc()
+
+		evaluated := time.Now()
+		for _, alert := range triggered {
+			alertCount++
+			s.delivery.deliver(passCtx, alert, nil, evaluated)
+		}
+	}
+	span.SetAttributes(attribute.Int("alerts.triggered", alertCount))
+
+	if alertCount > 0 {
+		s.logger.Info().
+			Int("symbols_evaluated", evaluationCount).
+			Int("alerts_triggered", alertCount).
+			Msg("periodic evaluation completed")
+	}
+}
+
+// queryLatestMetrics retrieves the latest metrics for all symbols from the database
+// This is used by periodic evaluation to get fresh data every 5 seconds
+// NOTE: Each timeframe is stored as a separate row in metrics_calculated
+func queryLatestMetrics(ctx context.Context, db *pgxpool.Pool) ([]*Metrics, error) {
+	// Query to get latest metrics for each symbol across all timeframes
+	// We pivot the timeframe rows into columns using MAX and CASE
+	query := `
+		WITH latest_metrics AS (
+			SELECT DISTINCT ON (symbol, timeframe)
+				symbol,
+				timeframe,
+				time,
+				open, high, low, close, volume,
+				price_change,
+				volume_ratio,
+				vcp,
+				rsi_14
+			FROM metrics_calculated
+			WHERE time > NOW() - INTERVAL '5 minutes'
+			ORDER BY symbol, timeframe, time DESC
+		)
+		SELECT
+			symbol,
+			MAX(CASE WHEN timeframe = '5m' THEN time END) as time_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN open END) as open_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN high END) as high_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN low END) as low_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN close END) as close_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN volume END) as volume_5m,
+			MAX(CASE WHEN timeframe = '5m' THEN price_change END) as price_change_5m,
+			MAX(CASE WHEN timeframe = '15m' THEN open END) as open_15m,
+			MAX(CASE WHEN timeframe = '15m' THEN high END) as high_15m,
+			MAX(CASE WHEN timeframe = '15m' THEN low END) as low_15m,
+			MAX(CASE WHEN timeframe = '15m' THEN close END) as close_15m,
+			MAX(CASE WHEN timeframe = '15m' THEN volume END) as volume_15m,
+			MAX(CASE WHEN timeframe = '15m' THEN price_change END) as price_change_15m,
+			MAX(CASE WHEN timeframe = '1h' THEN open END) as open_1h,
+			MAX(CASE WHEN timeframe = '1h' THEN high END) as high_1h,
+			MAX(CASE WHEN timeframe = '1h' THEN low END) as low_1h,
+			MAX(CASE WHEN timeframe = '1h' THEN close END) as close_1h,
+			MAX(CASE WHEN timeframe = '1h' THEN volume END) as volume_1h,
+			MAX(CASE WHEN timeframe = '1h' THEN price_change END) as price_change_1h,
+			MAX(CASE WHEN timeframe = '8h' THEN open END) as open_8h,
+			MAX(CASE WHEN timeframe = '8h' THEN high END) as high_8h,
+			MAX(CASE WHEN timeframe = '8h' THEN low END) as low_8h,
+			MAX(CASE WHEN timeframe = '8h' THEN close END) as close_8h,
+			MAX(CASE WHEN timeframe = '8h' THEN volume END) as volume_8h,
+			MAX(CASE WHEN timeframe = '8h' THEN price_change END) as price_change_8h,
+			MAX(CASE WHEN timeframe = '1d' THEN open END) as open_1d,
+			MAX(CASE WHEN timeframe = '1d' THEN high END) as high_1d,
+			MAX(CASE WHEN timeframe = '1d' THEN low END) as low_1d,
+			MAX(CASE WHEN timeframe = '1d' THEN close END) as close_1d,
+			MAX(CASE WHEN timeframe = '1d' THEN volume END) as volume_1d,
+			MAX(CASE WHEN timeframe = '1d' THEN price_change END) as price_change_1d,
+			MAX(CASE WHEN timeframe = '5m' THEN vcp END) as vcp,
+			MAX(CASE WHEN timeframe = '5m' THEN rsi_14 END) as rsi
+		FROM latest_metrics
+		GROUP BY symbol
+		HAVING MAX(CASE WHEN timeframe = '5m' THEN close END) IS NOT NULL
+	`
+
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metricsSlice []*Metrics
+	for rows.Next() {
+		var m Metrics
+		var c5m, c15m, c1h, c8h, c1d TimeframeCandle
+		var time5m time.Time
+		var priceChange5m, priceChange15m, priceChange1h, priceChange8h, priceChange1d *float64
+		var vcp, rsi *float64
+
+		err := rows.Scan(
+			&m.Symbol,
+			&time5m,
+			&c5m.Open, &c5m.High, &c5m.Low, &c5m.Close, &c5m.Volume,
+			&priceChange5m,
+			&c15m.Open, &c15m.High, &c15m.Low, &c15m.Close, &c15m.Volume,
+			&priceChange15m,
+			&c1h.Open, &c1h.High, &c1h.Low, &c1h.Close, &c1h.Volume,
+			&priceChange1h,
+			&c8h.Open, &c8h.High, &c8h.Low, &c8h.Close, &c8h.Volume,
+			&priceChange8h,
+			&c1d.Open, &c1d.High, &c1d.Low, &c1d.Close, &c1d.Volume,
+			&priceChange1d,
+			&vcp,
+			&rsi,
+		)
+		if err != nil {
+			continue
+		}
+
+		// Convert nullable floats
+		if priceChange5m != nil {
+			m.PriceChange5m = *priceChange5m
+		}
+		if priceChange15m != nil {
+			m.PriceChange15m = *priceChange15m
+		}
+		if priceChange1h != nil {
+			m.PriceChange1h = *priceChange1h
+		}
+		if priceChange8h != nil {
+			m.PriceChange8h = *priceChange8h
+		}
+		if priceChange1d != nil {
+			m.PriceChange1d = *priceChange1d
+		}
+		if vcp != nil {
+			m.VCP = *vcp
+		}
+		if rsi != nil {
+			m.RSI = *rsi
+		}
+
+		m.Timestamp = time5m
+		m.LastPrice = c5m.Close
+		m.Candle5m = c5m
+		m.Candle15m = c15m
+		m.Candle1h = c1h
+		m.Candle8h = c8h
+		m.Candle1d = c1d
+
+		metricsSlice = append(metricsSlice, &m)
+	}
+
+	return metricsSlice, rows.Err()
+}
@@ -0,0 +1,225 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+var (
+	symbolPattern = regexp.MustCompile(`SYM\d+USDT`)
+	rulePattern   = regexp.MustCompile(`futures_\w+`)
+)
+
+// webhookRecorder counts the notifications of each symbol and rule. The blocked
+// request of a path is held until released and fails without being counted.
+type webhookRecorder struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	paths   map[string]int
+	blockAt map[string]int // path -> request number to hold
+	blocked chan string
+	release chan struct{}
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	alert := string(symbolPattern.Find(body)) + "/" + string(rulePattern.Find(body))
+
+	w.mu.Lock()
+	w.paths[r.URL.Path]++
+	hold := w.paths[r.URL.Path] == w.blockAt[r.URL.Path]
+	w.mu.Unlock()
+
+	if hold {
+		w.blocked <- alert
+		<-w.release
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.mu.Lock()
+	w.counts[alert]++
+	w.mu.Unlock()
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (w *webhookRecorder) snapshot() map[string]int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	counts := make(map[string]int, len(w.counts))
+	for alert, n := range w.counts {
+		counts[alert] = n
+	}
+	return counts
+}
+
+// replica is an alert service on its own NATS connection, so closing the
+// connection cuts it off like a crashed process
+type replica struct {
+	svc    *Service
+	nc     *nats.Conn
+	passes atomic.Int64 // periodic evaluations run
+}
+
+func startAlertReplica(t *testing.T, ns messaging.Config, webhook string) *replica {
+	t.Helper()
+	nc, err := messaging.NewNATSConn(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	bus, err := messaging.NewJetStreamBus(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+
+	engine := NewEngine(nil, nil, zerolog.Nop())
+	for _, rule := range []string{"futures_big_bull_60", "futures_pioneer_bull"} {
+		engine.rules[rule] = &AlertRule{RuleType: rule, Config: map[string]interface{}{}, Description: rule}
+	}
+
+	// Batches are never full and the flush interval never passes, so nothing
+	// reaches the missing database
+	persister := NewAlertPersister(nil, zerolog.Nop(), 1000, time.Hour)
+
+	cfg := config.Engine{EvaluationInterval: 100 * time.Millisecond, LeaderLeaseTTL: time.Second}
+	r := &replica{nc: nc}
+	r.svc = NewService(engine, nil, persister, NewNotifier([]string{webhook}, zerolog.Nop()), bus, cfg, zerolog.Nop())
+	r.svc.ackWait = time.Second
+	r.svc.latest = func(ctx context.Context) ([]*Metrics, error) {
+		r.passes.Add(1)
+		return nil, nil
+	}
+	if err := r.svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.svc.Stop)
+	return r
+}
+
+// bullMetrics triggers futures_big_bull_60 and futures_pioneer_bull
+func bullMetrics(symbol string) calculator.SymbolMetrics {
+	return calculator.SymbolMetrics{
+		Symbol:         symbol,
+		Timestamp:      time.Now(),
+		LastPrice:      1,
+		PriceChange5m:  1.5,
+		PriceChange15m: 1.8,
+		PriceChange1h:  2,
+		PriceChange8h:  5,
+		PriceChange1d:  10,
+		Candle5m:       calculator.TimeframeCandle{Volume: 600_000},
+		Candle15m:      calculator.TimeframeCandle{Volume: 1_000_000},
+		Candle1h:       calculator.TimeframeCandle{Volume: 1_000_000},
+		Candle8h:       calculator.TimeframeCandle{Volume: 5_500_000},
+		Candle1d:       calculator.TimeframeCandle{Volume: 10_000_000},
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLeaderKilledMidStream(t *testing.T) {
+	ns, err := messaging.StartEmbeddedServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ns.Shutdown)
+	natsCfg := messaging.Config{InProcess: ns, EnableJetStream: true}
+
+	// The calculator creates the METRICS stream
+	nc, err := messaging.NewNATSConn(natsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	pub, err := messaging.NewJetStreamBus(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.CreateStream(context.Background(), messaging.MetricsStream); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := &webhookRecorder{
+		counts:  make(map[string]int),
+		paths:   make(map[string]int),
+		blockAt: map[string]int{"/leader": 4},
+		blocked: make(chan string),
+		release: make(chan struct{}),
+	}
+	server := httptest.NewServer(hooks)
+	t.Cleanup(server.Close)
+
+	leader := startAlertReplica(t, natsCfg, server.URL+"/leader")
+	eventually(t, "a leader", leader.svc.Leader)
+
+	// The leader is alone on the stream, so it takes every message
+	const symbols = 20
+	for i := 0; i < symbols; i++ {
+		payload, _ := json.Marshal(bullMetrics(fmt.Sprintf("SYM%dUSDT", i)))
+		if err := pub.Publish(context.Background(), messaging.NewMsg(MetricsSubject, payload, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A standby joins while the leader is stuck on the second alert of its
+	// second message, having notified the first
+	var inFlight string
+	select {
+	case inFlight = <-hooks.blocked:
+	case <-time.After(10 * time.Second):
+		t.Fatal("leader never delivered its fourth alert")
+	}
+	standby := startAlertReplica(t, natsCfg, server.URL+"/standby")
+	time.Sleep(300 * time.Millisecond)
+	if standby.svc.Leader() || standby.passes.Load() != 0 {
+		t.Fatal("standby evaluating while the leader is alive")
+	}
+
+	// Kill the leader: it can neither ack, record deliveries nor renew its lease
+	leader.nc.Close()
+	close(hooks.release)
+
+	eventually(t, "standby takeover", standby.svc.Leader)
+	eventually(t, "periodic evaluation on the new leader", func() bool { return standby.passes.Load() > 0 })
+	if leader.svc.Leader() {
+		t.Fatal("killed replica still leader")
+	}
+
+	// Every alert is notified exactly once, including the one in flight
+	eventually(t, "every alert", func() bool { return len(hooks.snapshot()) == 2*symbols })
+	time.Sleep(3 * time.Second) // several AckWaits, for any redelivery to show up
+	for alert, n := range hooks.snapshot() {
+		if n != 1 {
+			t.Errorf("%s notified %d times", alert, n)
+		}
+	}
+	if hooks.snapshot()[inFlight] != 1 {
+		t.Errorf("alert in flight at the kill (%s) not notified", inFlight)
+	}
+}
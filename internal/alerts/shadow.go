@@ -0,0 +1,203 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// forwardHorizons are the horizons of the forward returns in a shadow report
+var forwardHorizons = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"15m", 15 * time.Minute},
+	{"1h", time.Hour},
+	{"4h", 4 * time.Hour},
+}
+
+// ShadowReport compares the hits of a shadow rule with the production
+// alerts of the rule type whose evaluator it runs
+type ShadowReport struct {
+	RuleType   string      `json:"rule_type"`
+	Evaluator  string      `json:"evaluator"`
+	Since      time.Time   `json:"since"`
+	Until      time.Time   `json:"until"`
+	Shadow     SignalStats `json:"shadow"`
+	Production SignalStats `json:"production"`
+	Overlap    Overlap     `json:"overlap"`
+}
+
+// SignalStats summarizes the signals of one rule. A signal is a symbol
+// triggering in a minute, however often it was evaluated in that minute.
+type SignalStats struct {
+	Hits           int                    `json:"hits"`
+	Symbols        int                    `json:"symbols"`
+	ForwardReturns map[string]ReturnStats `json:"forward_returns"`
+}
+
+// ReturnStats is the price change from signals to a horizon after them
+type ReturnStats struct {
+	Samples int     `json:"samples"`
+	AvgPct  float64 `json:"avg_pct"`
+	// WinRate is the share of samples that moved in the rule's direction
+	WinRate float64 `json:"win_rate"`
+}
+
+// Overlap counts the signals both rules had and those only one had
+type Overlap struct {
+	Both           int `json:"both"`
+	ShadowOnly     int `json:"shadow_only"`
+	ProductionOnly int `json:"production_only"`
+}
+
+// signal is one symbol triggering a rule in one minute, with the closes at
+// each forward horizon that has passed
+type signal struct {
+	Symbol  string
+	Minute  time.Time
+	Price   *float64
+	Forward []*float64 // by forwardHorizons
+}
+
+func (s signal) key() string {
+	return s.Symbol + "@" + s.Minute.UTC().Format(time.RFC3339)
+}
+
+// ShadowReport compares the hits of the rule of ruleType in [since, until)
+// with the production alerts of its evaluator
+func (s *RuleStore) ShadowReport(ctx context.Context, ruleType string, since, until time.Time) (*ShadowReport, error) {
+	rule, err := s.Get(ctx, ruleType)
+	if err != nil {
+		return nil, err
+	}
+	evaluator := rule.EvaluatorType()
+
+	shadow, err := querySignals(ctx, s.db, "alert_shadow", ruleType, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("query shadow hits: %w", err)
+	}
+	production, err := querySignals(ctx, s.db, "alert_history", evaluator, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("query production alerts: %w", err)
+	}
+
+	direction := RuleDirection(evaluator)
+	return &ShadowReport{
+		RuleType:   ruleType,
+		Evaluator:  evaluator,
+		Since:      since,
+		Until:      until,
+		Shadow:     summarize(shadow, direction),
+		Production: summarize(production, direction),
+		Overlap:    overlap(shadow, production),
+	}, nil
+}
+
+// querySignals reads the signals of ruleType from table, alert_shadow or
+// alert_history, with the 5m candle closes at each forward horizon
+func querySignals(ctx context.Context, db *pgxpool.Pool, table, ruleType string, since, until time.Time) ([]signal, error) {
+	// The close of the last 5m candle ending by each horizon
+	args := []interface{}{ruleType, since, until}
+	columns, joins := "", ""
+	for i, h := range forwardHorizons {
+		args = append(args, int64(h.Duration/time.Second))
+		columns += fmt.Sprintf(", f%d.close", i)
+		joins += fmt.Sprintf(`
+		LEFT JOIN LATERAL (
+			SELECT close FROM candles_5m c
+			WHERE c.symbol = h.symbol
+				AND c.time > h.minute + $%[1]d * INTERVAL '1 second' - INTERVAL '10 minutes'
+				AND c.time <= h.minute + $%[1]d * INTERVAL '1 second' - INTERVAL '5 minutes'
+			ORDER BY c.time DESC
+			LIMIT 1
+		) f%[2]d ON true`, len(args), i)
+	}
+
+	query := `
+		WITH hits AS (
+			SELECT DISTINCT ON (symbol, date_trunc('minute', created_at))
+				symbol, date_trunc('minute', created_at) AS minute, price
+			FROM ` + table + `
+			WHERE rule_type = $1 AND created_at >= $2 AND created_at < $3
+			ORDER BY symbol, date_trunc('minute', created_at), created_at
+		)
+		SELECT h.symbol, h.minute, h.price` + columns + `
+		FROM hits h` + joins + `
+		ORDER BY h.minute, h.symbol`
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var signals []signal
+	for rows.Next() {
+		sig := signal{Forward: make([]*float64, len(forwardHorizons))}
+		dest := []interface{}{&sig.Symbol, &sig.Minute, &sig.Price}
+		for i := range sig.Forward {
+			dest = append(dest, &sig.Forward[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		signals = append(signals, sig)
+	}
+	return signals, rows.Err()
+}
+
+// summarize counts signals and averages their forward returns. A return is
+// a win when it moves in direction; rules without one count rises.
+func summarize(signals []signal, direction string) SignalStats {
+	stats := SignalStats{Hits: len(signals), ForwardReturns: make(map[string]ReturnStats, len(forwardHorizons))}
+	symbols := make(map[string]bool)
+	for _, sig := range signals {
+		symbols[sig.Symbol] = true
+	}
+	stats.Symbols = len(symbols)
+
+	for i, h := range forwardHorizons {
+		var rs ReturnStats
+		var sum float64
+		wins := 0
+		for _, sig := range signals {
+			if sig.Price == nil || *sig.Price <= 0 || sig.Forward[i] == nil {
+				continue
+			}
+			pct := (*sig.Forward[i] - *sig.Price) / *sig.Price * 100
+			rs.Samples++
+			sum += pct
+			if (direction == DirectionBearish && pct < 0) || (direction != DirectionBearish && pct > 0) {
+				wins++
+			}
+		}
+		if rs.Samples > 0 {
+			rs.AvgPct = sum / float64(rs.Samples)
+			rs.WinRate = float64(wins) / float64(rs.Samples)
+		}
+		stats.ForwardReturns[h.Name] = rs
+	}
+	return stats
+}
+
+// overlap matches signals by symbol and minute
+func overlap(shadow, production []signal) Overlap {
+	inProduction := make(map[string]bool, len(production))
+	for _, sig := range production {
+		inProduction[sig.key()] = true
+	}
+	var o Overlap
+	for _, sig := range shadow {
+		if inProduction[sig.key()] {
+			o.Both++
+			delete(inProduction, sig.key())
+		} else {
+			o.ShadowOnly++
+		}
+	}
+	o.ProductionOnly = len(inProduction)
+	return o
+}
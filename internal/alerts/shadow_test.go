@@ -0,0 +1,102 @@
+package alerts
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// pioneerMetrics moves 0.9% in 5m and 15m: under the built-in Pioneer Bull
+// threshold of 1%, over a trial one of 0.8%
+func pioneerMetrics() *Metrics {
+	return &Metrics{
+		Symbol:         "BTCUSDT",
+		Timestamp:      time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		LastPrice:      100,
+		PriceChange5m:  0.9,
+		PriceChange15m: 0.9,
+		Candle5m:       TimeframeCandle{Volume: 600_000},
+		Candle15m:      TimeframeCandle{Volume: 1_000_000},
+	}
+}
+
+func TestEvaluateShadowRule(t *testing.T) {
+	engine := NewEngine(nil, nil, zerolog.Nop())
+	engine.rules = map[string]*AlertRule{
+		"futures_pioneer_bull": {RuleType: "futures_pioneer_bull", Config: map[string]interface{}{}, Version: 3},
+		"pioneer_bull_080": {RuleType: "pioneer_bull_080", Version: 1, Config: map[string]interface{}{
+			"mode":      RuleModeShadow,
+			"evaluator": "futures_pioneer_bull",
+			"criteria":  map[string]interface{}{"change_5m_min": 0.8, "change_15m_min": 0.8},
+		}},
+	}
+
+	alerts, err := engine.Evaluate(context.Background(), pioneerMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("alerts = %+v, want the shadow hit only", alerts)
+	}
+	if a := alerts[0]; a.RuleType != "pioneer_bull_080" || !a.Shadow || a.RuleVersion != 1 {
+		t.Fatalf("alert = %+v", a)
+	}
+
+	// Above the built-in threshold both fire, production not as shadow
+	m := pioneerMetrics()
+	m.PriceChange5m, m.PriceChange15m = 1.2, 1.5
+	alerts, err = engine.Evaluate(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow := map[string]bool{}
+	for _, a := range alerts {
+		shadow[a.RuleType] = a.Shadow
+	}
+	if len(shadow) != 2 || shadow["futures_pioneer_bull"] || !shadow["pioneer_bull_080"] {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+}
+
+func TestShadowSummary(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	f := func(v float64) *float64 { return &v }
+	sig := func(symbol string, minute int, price float64, forward ...*float64) signal {
+		return signal{Symbol: symbol, Minute: at.Add(time.Duration(minute) * time.Minute), Price: f(price), Forward: forward}
+	}
+
+	shadow := []signal{
+		sig("BTCUSDT", 0, 100, f(101), f(102), nil),
+		sig("BTCUSDT", 1, 100, f(99), f(103), nil),
+		sig("ETHUSDT", 0, 10, f(10.2), nil, nil),
+	}
+	production := []signal{
+		sig("BTCUSDT", 1, 100, f(99), f(103), nil),
+		sig("SOLUSDT", 5, 50, nil, nil, nil),
+	}
+
+	stats := summarize(shadow, DirectionBullish)
+	if stats.Hits != 3 || stats.Symbols != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	r15 := stats.ForwardReturns["15m"]
+	if r15.Samples != 3 || math.Abs(r15.AvgPct-(1-1+2)/3.0) > 1e-9 || math.Abs(r15.WinRate-2/3.0) > 1e-9 {
+		t.Errorf("15m returns = %+v", r15)
+	}
+	if r1h := stats.ForwardReturns["1h"]; r1h.Samples != 2 || r1h.WinRate != 1 {
+		t.Errorf("1h returns = %+v", r1h)
+	}
+	if r4h := stats.ForwardReturns["4h"]; r4h.Samples != 0 {
+		t.Errorf("4h returns = %+v, want none before the horizon passed", r4h)
+	}
+	if bear := summarize(shadow, DirectionBearish).ForwardReturns["15m"]; math.Abs(bear.WinRate-1/3.0) > 1e-9 {
+		t.Errorf("bearish 15m win rate = %v", bear.WinRate)
+	}
+
+	if o := overlap(shadow, production); o != (Overlap{Both: 1, ShadowOnly: 2, ProductionOnly: 1}) {
+		t.Errorf("overlap = %+v", o)
+	}
+}
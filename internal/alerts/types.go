@@ -5,8 +5,35 @@ import "time"
 // AlertRule represents a rule configuration from the database
 type AlertRule struct {
 	RuleType    string                 `json:"rule_type"`
+	Enabled     bool                   `json:"enabled"`
 	Config      map[string]interface{} `json:"config"`
 	Description string                 `json:"description"`
+	Version     int                    `json:"version"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// Rule modes. Production rules notify; shadow rules only record their hits
+// in alert_shadow, to be compared with production before going live.
+const (
+	RuleModeProduction = "production"
+	RuleModeShadow     = "shadow"
+)
+
+// Shadow reports whether the rule config sets mode shadow
+func (r *AlertRule) Shadow() bool {
+	mode, _ := r.Config["mode"].(string)
+	return mode == RuleModeShadow
+}
+
+// EvaluatorType returns the rule type whose evaluator runs the rule: the
+// config's evaluator, which lets a shadow rule trial other thresholds for a
+// production rule, or else the rule's own type
+func (r *AlertRule) EvaluatorType() string {
+	if evaluator, _ := r.Config["evaluator"].(string); evaluator != "" {
+		return evaluator
+	}
+	return r.RuleType
 }
 
 // AlertCriteria contains the evaluation criteria from rule config
@@ -63,6 +90,8 @@ type Alert struct {
 	ID          string    `json:"id"`
 	Symbol      string    `json:"symbol"`
 	RuleType    string    `json:"rule_type"`
+	RuleVersion int       `json:"rule_version,omitempty"` // version of the rule that triggered
+	Shadow      bool      `json:"shadow,omitempty"`       // hit of a shadow rule, recorded only
 	Description string    `json:"description"`
 	Timestamp   time.Time `json:"timestamp"`
 	Price       float64   `json:"price"`
@@ -109,3 +138,43 @@ type Metrics struct {
 	VCP            float64         `json:"vcp"`
 	RSI            float64         `json:"rsi"`
 }
+
+// Alert directions used to group rule types for dashboards and notifications
+const (
+	DirectionBullish = "bullish"
+	DirectionBearish = "bearish"
+)
+
+// BullishRuleTypes lists rule types that signal upward moves
+var BullishRuleTypes = []string{
+	"futures_big_bull_60",
+	"futures_pioneer_bull",
+	"futures_5_big_bull",
+	"futures_15_big_bull",
+	"futures_bottom_hunter",
+}
+
+// BearishRuleTypes lists rule types that signal downward moves
+var BearishRuleTypes = []string{
+	"futures_big_bear_60",
+	"futures_pioneer_bear",
+	"futures_5_big_bear",
+	"futures_15_big_bear",
+	"futures_top_hunter",
+}
+
+// RuleDirection returns DirectionBullish or DirectionBearish for known rule
+// types, or an empty string when the rule has no direction
+func RuleDirection(ruleType string) string {
+	for _, rt := range BullishRuleTypes {
+		if rt == ruleType {
+			return DirectionBullish
+		}
+	}
+	for _, rt := range BearishRuleTypes {
+		if rt == ruleType {
+			return DirectionBearish
+		}
+	}
+	return ""
+}
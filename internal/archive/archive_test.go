@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestClosedDays(t *testing.T) {
+	first := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	// Feb 3 has ended, but not long enough ago for its last rows to be written
+	days := closedDays(first, time.Date(2026, 2, 4, 0, 5, 0, 0, time.UTC))
+	if len(days) != 2 || !days[1].Equal(time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("closed days = %v, want Feb 1 and 2", days)
+	}
+	days = closedDays(first, time.Date(2026, 2, 4, 0, 10, 0, 0, time.UTC))
+	if len(days) != 3 {
+		t.Fatalf("closed days = %v, want Feb 1 to 3", days)
+	}
+	if days := closedDays(first, first.Add(12*time.Hour)); len(days) != 0 {
+		t.Fatalf("closed days = %v, want none", days)
+	}
+}
+
+// storeDay writes rows as an archived day of table, like the archiver does
+func storeDay[T any](t *testing.T, store Store, m *Manifest, table string, day time.Time, rows []T) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	key := fileKey(table, day)
+	if err := store.Put(context.Background(), key, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	m.add(ManifestFile{Table: table, Date: day.Format(dateLayout), Key: key, Rows: int64(len(rows)), SHA256: hex.EncodeToString(sum[:])})
+	if err := m.save(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoaderReadsArchivedDays(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	candle := func(symbol string, at time.Time, close float64) Candle {
+		return Candle{Time: at, Symbol: symbol, Open: 1, High: 2, Low: 0.5, Close: close, Volume: 10, QuoteVolume: 15, Trades: 3}
+	}
+	m := &Manifest{}
+	storeDay(t, store, m, TableCandles, day1, []Candle{
+		candle("BTCUSDT", day1.Add(23*time.Hour+59*time.Minute), 1),
+		candle("ETHUSDT", day1.Add(23*time.Hour+59*time.Minute), 2),
+	})
+	storeDay(t, store, m, TableCandles, day2, []Candle{
+		candle("BTCUSDT", day2, 3),
+		candle("BTCUSDT", day2.Add(time.Minute), 4),
+		candle("ETHUSDT", day2, 5),
+	})
+	price := 42.0
+	alertID := "6f1c2a4e-8b7d-4c3e-9a51-2d0e7f3b9c18"
+	storeDay(t, store, m, TableAlerts, day2, []Alert{
+		{ID: 7, AlertID: alertID, CreatedAt: day2.Add(time.Hour), Symbol: "BTCUSDT", RuleType: "futures_5_big_bull", Price: &price},
+	})
+
+	loader, err := NewLoader(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := loader.Candles(ctx, day1.Add(12*time.Hour), day2.Add(time.Minute), "BTCUSDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || candles[0].Close != 1 || candles[1].Close != 3 {
+		t.Fatalf("candles = %+v, want the last of Feb 1 and the first of Feb 2", candles)
+	}
+	if !candles[1].OpenTime.Equal(day2) || !candles[1].CloseTime.Equal(day2.Add(time.Minute-time.Millisecond)) {
+		t.Errorf("candle times %s - %s", candles[1].OpenTime, candles[1].CloseTime)
+	}
+
+	all, err := loader.Candles(ctx, day1, day2.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closes []float64
+	for _, c := range all {
+		closes = append(closes, c.Close)
+	}
+	if want := []float64{1, 3, 4, 2, 5}; !slices.Equal(closes, want) {
+		t.Errorf("closes = %v, want %v (by symbol, then time)", closes, want)
+	}
+
+	alerts, err := loader.Alerts(ctx, day1, day2.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != 7 || alerts[0].AlertID != alertID || alerts[0].Price == nil || *alerts[0].Price != price || alerts[0].Message != nil {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+}
+
+func TestLoaderRejectsModifiedFile(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	storeDay(t, store, &Manifest{}, TableAlerts, day, []Alert{{ID: 1, CreatedAt: day, Symbol: "BTCUSDT"}})
+	if err := store.Put(ctx, fileKey(TableAlerts, day), []byte("not parquet")); err != nil {
+		t.Fatal(err)
+	}
+
+	loader, err := NewLoader(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.Alerts(ctx, day, day.Add(24*time.Hour)); err == nil {
+		t.Fatal("loaded a file that does not match the manifest")
+	}
+}
@@ -0,0 +1,181 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/parquet-go/parquet-go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// dayCloseDelay is how long after midnight a day counts as closed,
+	// leaving time for its last candles and metrics to be written
+	dayCloseDelay = 10 * time.Minute
+
+	// exportBatchSize is how many rows are buffered before being encoded
+	exportBatchSize = 10000
+)
+
+// Archiver exports each closed UTC day of candles_1m, metrics_calculated
+// and alert_history to one Parquet file per table and day, and records the
+// files in the store's manifest
+type Archiver struct {
+	pool   *pgxpool.Pool
+	store  Store
+	logger zerolog.Logger
+}
+
+// NewArchiver creates an archiver writing to store
+func NewArchiver(pool *pgxpool.Pool, store Store, logger zerolog.Logger) *Archiver {
+	return &Archiver{pool: pool, store: store, logger: logger}
+}
+
+// Run archives the closed days now and then every interval, until ctx is done
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.ArchiveClosedDays(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			a.logger.Error().Err(err).Msg("archive run failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveClosedDays exports every closed day after the latest archived one,
+// table by table. Before a table's first run it starts at its oldest row.
+func (a *Archiver) ArchiveClosedDays(ctx context.Context, now time.Time) error {
+	manifest, err := loadManifest(ctx, a.store)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range tables {
+		if err := a.archiveTable(ctx, manifest, t, now); err != nil {
+			observability.GetCollector().CounterWith(observability.MetricArchiveFailures, observability.Labels{"table": t.name}).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Archiver) archiveTable(ctx context.Context, manifest *Manifest, t table, now time.Time) error {
+	first, ok := manifest.lastDay(t.name)
+	if ok {
+		first = first.Add(24 * time.Hour)
+	} else {
+		var oldest *time.Time
+		query := fmt.Sprintf(`SELECT MIN(%s) FROM %s`, t.timeColumn, t.name)
+		if err := a.pool.QueryRow(ctx, query).Scan(&oldest); err != nil {
+			return err
+		}
+		if oldest == nil {
+			return nil
+		}
+		first = oldest.UTC().Truncate(24 * time.Hour)
+	}
+
+	for _, day := range closedDays(first, now) {
+		start := time.Now()
+		data, rows, err := t.export(ctx, a.pool, day)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", day.Format(dateLayout), err)
+		}
+		key := fileKey(t.name, day)
+		if err := a.store.Put(ctx, key, data); err != nil {
+			return fmt.Errorf("store %s: %w", key, err)
+		}
+
+		sum := sha256.Sum256(data)
+		file := ManifestFile{
+			Table:      t.name,
+			Date:       day.Format(dateLayout),
+			Key:        key,
+			Rows:       rows,
+			Bytes:      int64(len(data)),
+			SHA256:     hex.EncodeToString(sum[:]),
+			ExportedAt: now,
+			Partial:    t.retention > 0 && day.Before(now.Add(-t.retention)),
+		}
+		manifest.add(file)
+		if err := manifest.save(ctx, a.store); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+
+		observability.GetCollector().CounterWith(observability.MetricArchivedRows, observability.Labels{"table": t.name}).Add(float64(rows))
+		event := a.logger.Info()
+		if file.Partial {
+			event = a.logger.Warn()
+		}
+		event.Str("table", t.name).
+			Str("date", file.Date).
+			Int64("rows", rows).
+			Int64("bytes", file.Bytes).
+			Bool("partial", file.Partial).
+			Dur("duration", time.Since(start)).
+			Msg("archived day")
+	}
+	return nil
+}
+
+// closedDays returns the UTC days from first whose end lies at least
+// dayCloseDelay before now
+func closedDays(first, now time.Time) []time.Time {
+	var days []time.Time
+	for day := first; !day.Add(24*time.Hour + dayCloseDelay).After(now); day = day.Add(24 * time.Hour) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// exportDay encodes the rows query returns for [day, day+24h) as Parquet
+func exportDay[T any](ctx context.Context, pool *pgxpool.Pool, query string, day time.Time) ([]byte, int64, error) {
+	rows, err := pool.Query(ctx, query, day, day.Add(24*time.Hour))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[T](&buf, parquet.Compression(&parquet.Zstd))
+	batch := make([]T, 0, exportBatchSize)
+	var count int64
+	for rows.Next() {
+		row, err := pgx.RowToStructByName[T](rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		batch = append(batch, row)
+		if len(batch) == exportBatchSize {
+			if _, err := w.Write(batch); err != nil {
+				return nil, 0, err
+			}
+			count += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if _, err := w.Write(batch); err != nil {
+		return nil, 0, err
+	}
+	count += int64(len(batch))
+	if err := w.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), count, nil
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Loader reads archived rows back, for backtests over more history than the
+// database keeps
+type Loader struct {
+	store    Store
+	manifest *Manifest
+}
+
+// NewLoader reads the manifest of store. Files archived later are not seen.
+func NewLoader(ctx context.Context, store Store) (*Loader, error) {
+	manifest, err := loadManifest(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	return &Loader{store: store, manifest: manifest}, nil
+}
+
+// Files returns the archived files of a table for the days overlapping
+// [from, to), oldest first
+func (l *Loader) Files(table string, from, to time.Time) []ManifestFile {
+	return l.manifest.files(table, from, to)
+}
+
+// Candles returns the archived candles in [from, to) of the given symbols,
+// or of all symbols if none are given, ordered by symbol and time
+func (l *Loader) Candles(ctx context.Context, from, to time.Time, symbols ...string) ([]ringbuffer.Candle, error) {
+	keep := symbolFilter(symbols)
+	rows, err := loadRows(ctx, l, TableCandles, from, to, func(c Candle) bool {
+		return keep(c.Symbol) && inRange(c.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Symbol < rows[j].Symbol })
+	candles := make([]ringbuffer.Candle, len(rows))
+	for i, row := range rows {
+		candles[i] = row.RingBufferCandle()
+	}
+	return candles, nil
+}
+
+// Metrics returns the archived metrics of one timeframe in [from, to) of the
+// given symbols, or of all symbols if none are given, ordered by symbol and
+// time
+func (l *Loader) Metrics(ctx context.Context, timeframe string, from, to time.Time, symbols ...string) ([]Metrics, error) {
+	keep := symbolFilter(symbols)
+	rows, err := loadRows(ctx, l, TableMetrics, from, to, func(m Metrics) bool {
+		return m.Timeframe == timeframe && keep(m.Symbol) && inRange(m.Time, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Symbol < rows[j].Symbol })
+	return rows, nil
+}
+
+// Alerts returns the archived alerts in [from, to) of the given symbols, or
+// of all symbols if none are given, ordered by time
+func (l *Loader) Alerts(ctx context.Context, from, to time.Time, symbols ...string) ([]Alert, error) {
+	keep := symbolFilter(symbols)
+	return loadRows(ctx, l, TableAlerts, from, to, func(a Alert) bool {
+		return keep(a.Symbol) && inRange(a.CreatedAt, from, to)
+	})
+}
+
+// loadRows reads and checks each of table's files overlapping [from, to),
+// keeping the rows keep accepts, in file order. Candle and metrics files are
+// ordered by symbol and time within the day, so a stable sort by symbol
+// orders those rows across days.
+func loadRows[T any](ctx context.Context, l *Loader, table string, from, to time.Time, keep func(T) bool) ([]T, error) {
+	var out []T
+	for _, f := range l.manifest.files(table, from, to) {
+		data, err := l.store.Get(ctx, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Key, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("%s does not match its manifest checksum", f.Key)
+		}
+		rows, err := parquet.Read[T](bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", f.Key, err)
+		}
+		for _, row := range rows {
+			if keep(row) {
+				out = append(out, row)
+			}
+		}
+	}
+	return out, nil
+}
+
+func symbolFilter(symbols []string) func(string) bool {
+	if len(symbols) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(symbols))
+	for _, s := range symbols {
+		set[s] = true
+	}
+	return func(s string) bool { return set[s] }
+}
+
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
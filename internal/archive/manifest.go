@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// manifestKey is where the manifest lives, next to the table directories
+const manifestKey = "manifest.json"
+
+// dateLayout names the daily partitions
+const dateLayout = "2006-01-02"
+
+// Manifest lists every archived file. It is rewritten after each file is
+// stored, so a file missing from it is redone on the next run.
+type Manifest struct {
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes one table's rows of one UTC day
+type ManifestFile struct {
+	Table      string    `json:"table"`
+	Date       string    `json:"date"`
+	Key        string    `json:"key"`
+	Rows       int64     `json:"rows"`
+	Bytes      int64     `json:"bytes"`
+	SHA256     string    `json:"sha256"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Partial is set when retention had already deleted part of the day
+	Partial bool `json:"partial,omitempty"`
+}
+
+// fileKey returns the key of a table's file for a day, partitioned by table
+// and date in the Hive layout most query engines understand
+func fileKey(table string, day time.Time) string {
+	return fmt.Sprintf("%s/date=%s/%s.parquet", table, day.Format(dateLayout), table)
+}
+
+// loadManifest reads the manifest, or returns an empty one if none was stored
+func loadManifest(ctx context.Context, store Store) (*Manifest, error) {
+	data, err := store.Get(ctx, manifestKey)
+	if errors.Is(err, ErrNotFound) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func (m *Manifest) save(ctx context.Context, store Store) error {
+	sort.Slice(m.Files, func(i, j int) bool {
+		if m.Files[i].Table != m.Files[j].Table {
+			return m.Files[i].Table < m.Files[j].Table
+		}
+		return m.Files[i].Date < m.Files[j].Date
+	})
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, manifestKey, data)
+}
+
+// add records f, replacing an earlier file of the same table and day
+func (m *Manifest) add(f ManifestFile) {
+	for i := range m.Files {
+		if m.Files[i].Table == f.Table && m.Files[i].Date == f.Date {
+			m.Files[i] = f
+			return
+		}
+	}
+	m.Files = append(m.Files, f)
+}
+
+// lastDay returns the latest archived day of a table
+func (m *Manifest) lastDay(table string) (time.Time, bool) {
+	var last time.Time
+	for _, f := range m.Files {
+		if f.Table != table {
+			continue
+		}
+		day, err := time.Parse(dateLayout, f.Date)
+		if err == nil && day.After(last) {
+			last = day
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// files returns a table's files for the days overlapping [from, to)
+func (m *Manifest) files(table string, from, to time.Time) []ManifestFile {
+	var out []ManifestFile
+	for _, f := range m.Files {
+		day, err := time.Parse(dateLayout, f.Date)
+		if f.Table != table || err != nil {
+			continue
+		}
+		if day.Before(to) && day.Add(24*time.Hour).After(from) {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out
+}
@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Archived tables
+const (
+	TableCandles = "candles_1m"
+	TableMetrics = "metrics_calculated"
+	TableAlerts  = "alert_history"
+)
+
+// Candle is an archived candles_1m row
+type Candle struct {
+	Time        time.Time `db:"time" parquet:"time,timestamp(millisecond)"`
+	Symbol      string    `db:"symbol" parquet:"symbol,dict"`
+	Open        float64   `db:"open" parquet:"open"`
+	High        float64   `db:"high" parquet:"high"`
+	Low         float64   `db:"low" parquet:"low"`
+	Close       float64   `db:"close" parquet:"close"`
+	Volume      float64   `db:"volume" parquet:"volume"`
+	QuoteVolume float64   `db:"quote_volume" parquet:"quote_volume"`
+	Trades      int64     `db:"trades" parquet:"trades"`
+}
+
+// RingBufferCandle returns the candle as the calculator buffers it
+func (c Candle) RingBufferCandle() ringbuffer.Candle {
+	return ringbuffer.Candle{
+		Symbol:         c.Symbol,
+		OpenTime:       c.Time,
+		CloseTime:      c.Time.Add(time.Minute - time.Millisecond),
+		Open:           c.Open,
+		High:           c.High,
+		Low:            c.Low,
+		Close:          c.Close,
+		Volume:         c.Volume,
+		QuoteVolume:    c.QuoteVolume,
+		NumberOfTrades: c.Trades,
+	}
+}
+
+// Metrics is an archived metrics_calculated row
+type Metrics struct {
+	Time        time.Time `db:"time" parquet:"time,timestamp(millisecond)"`
+	Symbol      string    `db:"symbol" parquet:"symbol,dict"`
+	Timeframe   string    `db:"timeframe" parquet:"timeframe,dict"`
+	Open        float64   `db:"open" parquet:"open"`
+	High        float64   `db:"high" parquet:"high"`
+	Low         float64   `db:"low" parquet:"low"`
+	Close       float64   `db:"close" parquet:"close"`
+	Volume      float64   `db:"volume" parquet:"volume"`
+	PriceChange *float64  `db:"price_change" parquet:"price_change,optional"`
+	VolumeRatio *float64  `db:"volume_ratio" parquet:"volume_ratio,optional"`
+	VCP         *float64  `db:"vcp" parquet:"vcp,optional"`
+	RSI14       *float64  `db:"rsi_14" parquet:"rsi_14,optional"`
+	MACD        *float64  `db:"macd" parquet:"macd,optional"`
+	MACDSignal  *float64  `db:"macd_signal" parquet:"macd_signal,optional"`
+	BBUpper     *float64  `db:"bb_upper" parquet:"bb_upper,optional"`
+	BBMiddle    *float64  `db:"bb_middle" parquet:"bb_middle,optional"`
+	BBLower     *float64  `db:"bb_lower" parquet:"bb_lower,optional"`
+	FibR3       *float64  `db:"fib_r3" parquet:"fib_r3,optional"`
+	FibR2       *float64  `db:"fib_r2" parquet:"fib_r2,optional"`
+	FibR1       *float64  `db:"fib_r1" parquet:"fib_r1,optional"`
+	FibPivot    *float64  `db:"fib_pivot" parquet:"fib_pivot,optional"`
+	FibS1       *float64  `db:"fib_s1" parquet:"fib_s1,optional"`
+	FibS2       *float64  `db:"fib_s2" parquet:"fib_s2,optional"`
+	FibS3       *float64  `db:"fib_s3" parquet:"fib_s3,optional"`
+}
+
+// Alert is an archived alert_history row. Metadata is the JSON document as
+// stored.
+type Alert struct {
+	ID          int64     `db:"id" parquet:"id"`
+	AlertID     string    `db:"alert_id" parquet:"alert_id"` // the ID clients received the alert with
+	CreatedAt   time.Time `db:"created_at" parquet:"created_at,timestamp(millisecond)"`
+	Symbol      string    `db:"symbol" parquet:"symbol,dict"`
+	RuleType    string    `db:"rule_type" parquet:"rule_type,dict"`
+	RuleVersion *int32    `db:"rule_version" parquet:"rule_version,optional"` // nil before rules were versioned
+	Price       *float64  `db:"price" parquet:"price,optional"`
+	Message     *string   `db:"message" parquet:"message,optional"`
+	Metadata    *string   `db:"metadata" parquet:"metadata,optional"`
+}
+
+// table describes how one table is exported
+type table struct {
+	name       string
+	timeColumn string
+	// retention is how long the table keeps rows; 0 keeps them indefinitely
+	retention time.Duration
+	export    func(ctx context.Context, pool *pgxpool.Pool, day time.Time) ([]byte, int64, error)
+}
+
+var tables = []table{
+	{
+		name:       TableCandles,
+		timeColumn: "time",
+		retention:  48 * time.Hour,
+		export: func(ctx context.Context, pool *pgxpool.Pool, day time.Time) ([]byte, int64, error) {
+			return exportDay[Candle](ctx, pool, `
+				SELECT time, symbol, open, high, low, close, volume, quote_volume, trades::BIGINT AS trades
+				FROM candles_1m
+				WHERE time >= $1 AND time < $2
+				ORDER BY symbol, time`, day)
+		},
+	},
+	{
+		name:       TableMetrics,
+		timeColumn: "time",
+		retention:  48 * time.Hour,
+		export: func(ctx context.Context, pool *pgxpool.Pool, day time.Time) ([]byte, int64, error) {
+			return exportDay[Metrics](ctx, pool, `
+				SELECT time, symbol, timeframe, open, high, low, close, volume,
+					price_change, volume_ratio, vcp, rsi_14, macd, macd_signal,
+					bb_upper, bb_middle, bb_lower,
+					fib_r3, fib_r2, fib_r1, fib_pivot, fib_s1, fib_s2, fib_s3
+				FROM metrics_calculated
+				WHERE time >= $1 AND time < $2
+				ORDER BY symbol, timeframe, time`, day)
+		},
+	},
+	{
+		name:       TableAlerts,
+		timeColumn: "created_at",
+		export: func(ctx context.Context, pool *pgxpool.Pool, day time.Time) ([]byte, int64, error) {
+			return exportDay[Alert](ctx, pool, `
+				SELECT id::BIGINT AS id, alert_id::TEXT AS alert_id, created_at, symbol, rule_type, rule_version, price, message, metadata::TEXT AS metadata
+				FROM alert_history
+				WHERE created_at >= $1 AND created_at < $2
+				ORDER BY created_at, id`, day)
+		},
+	},
+}
@@ -48,8 +48,8 @@ func NewClient(logger zerolog.Logger) *Client {
 }
 
 // GetActiveSymbols fetches active USDT-margined perpetual futures pairs
-// Returns top 150 symbols sorted by 24-hour quote volume (USDT volume)
-func (c *Client) GetActiveSymbols(ctx context.Context) ([]string, error) {
+// Returns the top limit symbols sorted by 24-hour quote volume (USDT volume)
+func (c *Client) GetActiveSymbols(ctx context.Context, limit int) ([]string, error) {
 	// Step 1: Get exchange info to filter for active perpetual USDT futures
 	exchangeInfoURL := c.baseURL + ExchangeInfoEndpoint
 
@@ -147,13 +147,11 @@ func (c *Client) GetActiveSymbols(ctx context.Context) ([]string, error) {
 		})
 	}
 
-	// Step 4: Sort by volume (descending) and take top 150
+	// Step 4: Sort by volume (descending) and take the top symbols
 	sort.Slice(symbolVolumes, func(i, j int) bool {
 		return symbolVolumes[i].volume > symbolVolumes[j].volume
 	})
 
-	// Limit to top 150
-	limit := 150
 	if len(symbolVolumes) < limit {
 		limit = len(symbolVolumes)
 	}
@@ -0,0 +1,134 @@
+package binance
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+)
+
+// Reasons a candle is quarantined instead of published
+const (
+	ReasonNonPositivePrice = "non_positive_price"
+	ReasonInvalidRange     = "invalid_range" // high below low, or open or close outside them
+	ReasonWick             = "wick"
+	ReasonVolumeSpike      = "volume_spike"
+	ReasonDuplicate        = "duplicate_open_time"
+)
+
+const (
+	// volumeWindow is how many of a symbol's latest candles its volume
+	// statistics cover
+	volumeWindow = 60
+
+	// minVolumeSamples is how many candles a symbol needs before volume
+	// spikes are judged
+	minVolumeSamples = 30
+)
+
+// checkPrices returns why prices cannot belong to a real candle, or "" if
+// they can
+func checkPrices(open, high, low, close float64) string {
+	if open <= 0 || high <= 0 || low <= 0 || close <= 0 {
+		return ReasonNonPositivePrice
+	}
+	if high < low || open > high || open < low || close > high || close < low {
+		return ReasonInvalidRange
+	}
+	return ""
+}
+
+// CandleValidator holds back candles that would distort metrics: impossible
+// prices, wicks beyond MaxWick of the body, quote volume more than
+// VolumeSigma standard deviations above the symbol's recent mean, and open
+// times already seen. It is safe for concurrent use.
+type CandleValidator struct {
+	maxWick     float64
+	volumeSigma float64
+
+	mu      sync.Mutex
+	symbols map[string]*candleHistory
+}
+
+// candleHistory is what a symbol's next candle is judged against
+type candleHistory struct {
+	lastOpen time.Time
+	volumes  [volumeWindow]float64
+	count    int // volumes recorded, up to volumeWindow
+	next     int
+}
+
+// NewCandleValidator creates a validator with cfg's thresholds. A threshold
+// of zero turns its check off.
+func NewCandleValidator(cfg config.Collector) *CandleValidator {
+	return &CandleValidator{
+		maxWick:     cfg.QuarantineMaxWick,
+		volumeSigma: cfg.QuarantineVolumeSigma,
+		symbols:     make(map[string]*candleHistory),
+	}
+}
+
+// Check returns why candle should be quarantined, or "" if it can be
+// published. Candles with plausible prices count towards their symbol's
+// volume statistics even when quarantined as spikes, so a lasting change in
+// volume is soon accepted.
+func (v *CandleValidator) Check(candle *Candle) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h, ok := v.symbols[candle.Symbol]
+	if !ok {
+		h = &candleHistory{}
+		v.symbols[candle.Symbol] = h
+	}
+
+	if !h.lastOpen.IsZero() && !candle.OpenTime.After(h.lastOpen) {
+		return ReasonDuplicate
+	}
+	if reason := checkPrices(candle.Open, candle.High, candle.Low, candle.Close); reason != "" {
+		return reason
+	}
+	h.lastOpen = candle.OpenTime
+
+	if v.maxWick > 0 {
+		top := math.Max(candle.Open, candle.Close)
+		bottom := math.Min(candle.Open, candle.Close)
+		if candle.High/top-1 > v.maxWick || 1-candle.Low/bottom > v.maxWick {
+			return ReasonWick
+		}
+	}
+
+	spike := v.volumeSigma > 0 && h.spike(candle.QuoteVolume, v.volumeSigma)
+	h.record(candle.QuoteVolume)
+	if spike {
+		return ReasonVolumeSpike
+	}
+	return ""
+}
+
+// spike reports whether volume is more than sigma standard deviations above
+// the mean of the recorded volumes
+func (h *candleHistory) spike(volume, sigma float64) bool {
+	if h.count < minVolumeSamples {
+		return false
+	}
+	var sum, sumSq float64
+	for _, vol := range h.volumes[:h.count] {
+		sum += vol
+		sumSq += vol * vol
+	}
+	mean := sum / float64(h.count)
+	stddev := math.Sqrt(math.Max(sumSq/float64(h.count)-mean*mean, 0))
+	// Flat history, such as a symbol that has not traded, has no spread to
+	// judge against
+	return stddev > 0 && volume > mean+sigma*stddev
+}
+
+func (h *candleHistory) record(volume float64) {
+	h.volumes[h.next] = volume
+	h.next = (h.next + 1) % volumeWindow
+	if h.count < volumeWindow {
+		h.count++
+	}
+}
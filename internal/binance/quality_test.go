@@ -0,0 +1,134 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/rs/zerolog"
+)
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testCandle(minute int, open, high, low, close, quoteVolume float64) *Candle {
+	return &Candle{
+		Symbol:      "BTCUSDT",
+		OpenTime:    start.Add(time.Duration(minute) * time.Minute),
+		Open:        open,
+		High:        high,
+		Low:         low,
+		Close:       close,
+		QuoteVolume: quoteVolume,
+	}
+}
+
+func TestCandleValidator(t *testing.T) {
+	v := NewCandleValidator(config.Collector{QuarantineMaxWick: 0.5, QuarantineVolumeSigma: 10})
+
+	// A history with some spread in volume
+	for i := 0; i < minVolumeSamples; i++ {
+		if reason := v.Check(testCandle(i, 100, 101, 99, 100, 1000+float64(i%5)*100)); reason != "" {
+			t.Fatalf("candle %d quarantined: %s", i, reason)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		candle *Candle
+		want   string
+	}{
+		{"zero price", testCandle(100, 0, 101, 99, 100, 1000), ReasonNonPositivePrice},
+		{"negative price", testCandle(101, 100, 101, -1, 100, 1000), ReasonNonPositivePrice},
+		{"high below low", testCandle(102, 100, 99, 101, 100, 1000), ReasonInvalidRange},
+		{"close above high", testCandle(103, 100, 101, 99, 102, 1000), ReasonInvalidRange},
+		{"upper wick", testCandle(104, 100, 160, 99, 100, 1000), ReasonWick},
+		{"lower wick", testCandle(105, 100, 101, 40, 100, 1000), ReasonWick},
+		{"volume spike", testCandle(106, 100, 101, 99, 100, 100_000), ReasonVolumeSpike},
+		{"plausible", testCandle(107, 100, 110, 95, 108, 1500), ""},
+		{"duplicate open time", testCandle(107, 100, 101, 99, 100, 1000), ReasonDuplicate},
+		{"older open time", testCandle(50, 100, 101, 99, 100, 1000), ReasonDuplicate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Check(tt.candle); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCandleValidatorNeedsHistoryForSpikes(t *testing.T) {
+	v := NewCandleValidator(config.Collector{QuarantineVolumeSigma: 3})
+	if reason := v.Check(testCandle(0, 100, 101, 99, 100, 1)); reason != "" {
+		t.Fatalf("first candle quarantined: %s", reason)
+	}
+	if reason := v.Check(testCandle(1, 100, 101, 99, 100, 1e9)); reason != "" {
+		t.Errorf("spike judged without history: %s", reason)
+	}
+}
+
+// recordingPublisher keeps the messages published
+type recordingPublisher struct {
+	msgs []*messaging.Msg
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *messaging.Msg) error {
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func TestProcessMessageQuarantinesSuspectCandles(t *testing.T) {
+	pub := &recordingPublisher{}
+	c := &connection{
+		symbol:    "BTCUSDT",
+		publisher: pub,
+		validator: NewCandleValidator(config.Collector{QuarantineMaxWick: 0.5}),
+		subject:   messaging.CandleSubject("BTCUSDT", 16),
+		logger:    zerolog.Nop(),
+	}
+
+	kline := func(minute int64, high string) []byte {
+		data, _ := json.Marshal(KlineEvent{
+			EventType: "kline",
+			EventTime: 1640000060000 + minute*60000,
+			Symbol:    "BTCUSDT",
+			Kline: KlineData{
+				Symbol:           "BTCUSDT",
+				StartTime:        1640000000000 + minute*60000,
+				CloseTime:        1640000059999 + minute*60000,
+				IsClosed:         true,
+				OpenPrice:        "40000",
+				HighPrice:        high,
+				LowPrice:         "39900",
+				ClosePrice:       "40050",
+				BaseAssetVolume:  "10",
+				QuoteAssetVolume: "400000",
+			},
+		})
+		return data
+	}
+
+	for _, data := range [][]byte{kline(0, "40100"), kline(1, "90000"), kline(2, "40100")} {
+		if err := c.processMessage(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(pub.msgs) != 3 {
+		t.Fatalf("published %d messages, want 3", len(pub.msgs))
+	}
+
+	want := []struct{ subject, reason string }{
+		{c.subject, ""},
+		{messaging.QuarantineSubject("BTCUSDT"), ReasonWick},
+		{c.subject, ""},
+	}
+	for i, w := range want {
+		msg := pub.msgs[i]
+		if msg.Subject != w.subject || msg.Header.Get(messaging.HeaderQuarantineReason) != w.reason {
+			t.Errorf("message %d on %s (%q), want %s (%q)", i, msg.Subject, msg.Header.Get(messaging.HeaderQuarantineReason), w.subject, w.reason)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package binance
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 // ExchangeInfo represents the response from /fapi/v1/exchangeInfo
 type ExchangeInfo struct {
@@ -71,6 +74,29 @@ func (k *KlineData) ValidateFields() bool {
 	return true
 }
 
+// Validate reports whether k is a closed kline whose fields parse into
+// plausible prices: positive, with open and close between low and high
+func (k *KlineData) Validate() bool {
+	if !k.IsClosed || !k.ValidateFields() {
+		return false
+	}
+
+	var prices [4]float64
+	for i, raw := range []string{k.OpenPrice, k.HighPrice, k.LowPrice, k.ClosePrice} {
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return false
+		}
+		prices[i] = price
+	}
+	for _, raw := range []string{k.BaseAssetVolume, k.QuoteAssetVolume} {
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return false
+		}
+	}
+	return checkPrices(prices[0], prices[1], prices[2], prices[3]) == ""
+}
+
 // Candle represents a processed candlestick for internal use
 type Candle struct {
 	Symbol         string    `json:"symbol"`
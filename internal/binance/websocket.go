@@ -10,11 +10,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/gorilla/websocket"
-	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = observability.Tracer("github.com/bl8ckfz/crypto-screener-backend/internal/binance")
+
 const (
 	// FuturesWebSocketBase is the base URL for Binance Futures WebSocket
 	FuturesWebSocketBase = "wss://fstream.binance.com/ws"
@@ -33,7 +39,9 @@ const (
 type ConnectionManager struct {
 	symbols     []string
 	connections map[string]*connection
-	js          nats.JetStreamContext
+	publisher   messaging.Publisher
+	partitions  int
+	validator   *CandleValidator
 	logger      zerolog.Logger
 	wg          sync.WaitGroup
 	mu          sync.RWMutex
@@ -43,19 +51,26 @@ type ConnectionManager struct {
 type connection struct {
 	symbol          string
 	conn            *websocket.Conn
-	js              nats.JetStreamContext
+	publisher       messaging.Publisher
+	validator       *CandleValidator
+	subject         string
 	logger          zerolog.Logger
 	reconnectCount  int
 	stopCh          chan struct{}
 	stoppedCh       chan struct{}
 }
 
-// NewConnectionManager creates a new WebSocket connection manager
-func NewConnectionManager(symbols []string, js nats.JetStreamContext, logger zerolog.Logger) *ConnectionManager {
+// NewConnectionManager creates a new WebSocket connection manager that
+// publishes closed candles through publisher, hashing symbols into
+// cfg.CandlePartitions subject partitions. Candles failing validation are
+// published to the quarantine subjects instead.
+func NewConnectionManager(symbols []string, publisher messaging.Publisher, cfg config.Collector, logger zerolog.Logger) *ConnectionManager {
 	return &ConnectionManager{
 		symbols:     symbols,
 		connections: make(map[string]*connection),
-		js:          js,
+		publisher:   publisher,
+		partitions:  cfg.CandlePartitions,
+		validator:   NewCandleValidator(cfg),
 		logger:      logger.With().Str("component", "ws-manager").Logger(),
 	}
 }
@@ -68,7 +83,9 @@ func (m *ConnectionManager) Start(ctx context.Context) error {
 	for _, symbol := range m.symbols {
 		conn := &connection{
 			symbol:    symbol,
-			js:        m.js,
+			publisher: m.publisher,
+			validator: m.validator,
+			subject:   messaging.CandleSubject(symbol, m.partitions),
 			logger:    m.logger.With().Str("symbol", symbol).Logger(),
 			stopCh:    make(chan struct{}),
 			stoppedCh: make(chan struct{}),
@@ -211,7 +228,7 @@ func (c *connection) handleMessages(ctx context.Context) error {
 }
 
 // processMessage parses and publishes a kline event
-func (c *connection) processMessage(data []byte) error {
+func (c *connection) processMessage(data []byte) (err error) {
 	var event KlineEvent
 	if err := json.Unmarshal(data, &event); err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
@@ -226,6 +243,15 @@ func (c *connection) processMessage(data []byte) error {
 	if !event.Kline.IsClosed {
 		return nil // Skip without error - this is normal
 	}
+
+	// Closed candles start the trace that downstream metrics and alerts join
+	ctx, span := tracer.Start(context.Background(), "collector.processMessage",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("symbol", event.Symbol),
+			attribute.Int64("candle.open_time", event.Kline.StartTime),
+		))
+	defer func() { observability.EndSpan(span, err) }()
 	
 	// Validate kline data (prices and volume present)
 	if !event.Kline.ValidateFields() {
@@ -248,16 +274,51 @@ func (c *connection) processMessage(data []byte) error {
 		return fmt.Errorf("convert kline: %w", err)
 	}
 	
+	// Suspect candles go to quarantine, where the calculator never sees them
+	subject := c.subject
+	reason := c.validator.Check(candle)
+	if reason != "" {
+		subject = messaging.QuarantineSubject(candle.Symbol)
+		span.SetAttributes(attribute.String("candle.quarantine_reason", reason))
+		observability.GetCollector().CounterWith(observability.MetricCandlesQuarantined,
+			observability.Labels{"symbol": candle.Symbol, "reason": reason}).Inc()
+		c.logger.Warn().
+			Str("reason", reason).
+			Time("open_time", candle.OpenTime).
+			Float64("open", candle.Open).
+			Float64("high", candle.High).
+			Float64("low", candle.Low).
+			Float64("close", candle.Close).
+			Float64("quote_volume", candle.QuoteVolume).
+			Msg("quarantined candle")
+	}
+
 	// Publish to NATS
-	subject := fmt.Sprintf("candles.1m.%s", event.Symbol)
 	payload, err := json.Marshal(candle)
 	if err != nil {
 		return fmt.Errorf("marshal candle: %w", err)
 	}
 	
-	if _, err := c.js.Publish(subject, payload); err != nil {
+	// Stamp origin and publish times so downstream services can measure lag.
+	// The ID makes a candle published again after a reconnect a duplicate.
+	// Quarantined candles get none, so a repeated open time is kept for
+	// inspection rather than dropped by the stream.
+	msg := messaging.NewMsg(subject, payload, nil)
+	if reason != "" {
+		msg.Header.Set(messaging.HeaderQuarantineReason, reason)
+	} else {
+		messaging.SetMsgID(msg, messaging.CandleMsgID(candle.Symbol, candle.OpenTime))
+	}
+	eventTime := time.UnixMilli(event.EventTime)
+	publishTime := time.Now()
+	messaging.SetTimestamp(msg.Header, messaging.HeaderBinanceEventTime, eventTime)
+	messaging.SetTimestamp(msg.Header, messaging.HeaderCollectorPublished, publishTime)
+	messaging.InjectTrace(ctx, msg)
+
+	if err := c.publisher.Publish(ctx, msg); err != nil {
 		return fmt.Errorf("publish to NATS: %w", err)
 	}
+	observability.GetCollector().RecordStage(observability.StageCollector, publishTime.Sub(eventTime))
 	
 	c.logger.Debug().
 		Str("subject", subject).
@@ -0,0 +1,200 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// writeAttempts is how often a batch is written before its rows are
+	// given up on; the messages they came from are then redelivered
+	writeAttempts = 3
+
+	// retryBackoff is the pause before the second attempt, doubled for each
+	// one after that
+	retryBackoff = 500 * time.Millisecond
+)
+
+var errPersisterClosed = errors.New("persister closed")
+
+// batchWriter queues rows for one table and writes them in batches of size,
+// or whatever is queued every interval. The queue is bounded: while it is
+// full, add blocks, so a slow database slows the consumer down instead of
+// rows being dropped.
+type batchWriter[T any] struct {
+	table    string
+	queue    chan queued[T]
+	size     int
+	interval time.Duration
+	write    func(ctx context.Context, rows []T) error
+	logger   zerolog.Logger
+	metrics  *observability.MetricsCollector
+	labels   observability.Labels
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// queued is a row waiting to be written and the callback of its write
+type queued[T any] struct {
+	row  T
+	done func(error)
+	link trace.Link
+}
+
+func newBatchWriter[T any](table string, size, queueSize int, interval time.Duration, write func(ctx context.Context, rows []T) error, logger zerolog.Logger) *batchWriter[T] {
+	w := &batchWriter[T]{
+		table:    table,
+		queue:    make(chan queued[T], queueSize),
+		size:     size,
+		interval: interval,
+		write:    write,
+		logger:   logger,
+		metrics:  observability.GetCollector(),
+		labels:   observability.Labels{"table": table},
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// add queues row, waiting for room while the queue is full, and calls done
+// with the outcome of its write. done is called with an error at once if the
+// row cannot be queued because ctx is done or the writer is closed. The span
+// in ctx is linked from the span of the batch write.
+func (w *batchWriter[T]) add(ctx context.Context, row T, done func(error)) {
+	q := queued[T]{row: row, done: done, link: trace.LinkFromContext(ctx)}
+
+	select {
+	case <-w.closing:
+		done(errPersisterClosed)
+		return
+	case w.queue <- q:
+		return
+	default:
+	}
+
+	w.metrics.CounterWith(observability.MetricPersistQueueFull, w.labels).Inc()
+	select {
+	case w.queue <- q:
+	case <-ctx.Done():
+		done(ctx.Err())
+	case <-w.closing:
+		done(errPersisterClosed)
+	}
+}
+
+// close writes what is queued and stops the writer
+func (w *batchWriter[T]) close() {
+	select {
+	case <-w.closing:
+	default:
+		close(w.closing)
+	}
+	<-w.done
+}
+
+func (w *batchWriter[T]) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]queued[T], 0, w.size)
+	flush := func() {
+		if len(batch) > 0 {
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case q := <-w.queue:
+			batch = append(batch, q)
+			if len(batch) >= w.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-w.closing:
+			for {
+				select {
+				case q := <-w.queue:
+					batch = append(batch, q)
+					if len(batch) >= w.size {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+		w.metrics.GaugeWith(observability.MetricPersistQueueDepth, w.labels).Set(float64(len(w.queue)))
+	}
+}
+
+// flush writes batch, retrying a failed write, and reports the outcome to
+// every row's callback
+func (w *batchWriter[T]) flush(batch []queued[T]) {
+	rows := make([]T, len(batch))
+	links := make([]trace.Link, 0, len(batch))
+	for i, q := range batch {
+		rows[i] = q.row
+		if q.link.SpanContext.IsValid() {
+			links = append(links, q.link)
+		}
+	}
+
+	var err error
+	for attempt := 1; attempt <= writeAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(retryBackoff << (attempt - 2))
+		}
+		err = w.writeOnce(rows, links)
+		if err == nil {
+			break
+		}
+		w.logger.Warn().
+			Err(err).
+			Str("table", w.table).
+			Int("rows", len(rows)).
+			Int("attempt", attempt).
+			Msg("batch write failed")
+	}
+
+	if err != nil {
+		w.metrics.CounterWith(observability.MetricPersistBatchesFailed, w.labels).Inc()
+		w.logger.Error().Err(err).Str("table", w.table).Int("rows", len(rows)).Msg("giving up on batch, messages will be redelivered")
+	} else {
+		w.logger.Debug().Str("table", w.table).Int("rows", len(rows)).Msg("persisted batch")
+	}
+	for _, q := range batch {
+		q.done(err)
+	}
+}
+
+func (w *batchWriter[T]) writeOnce(rows []T, links []trace.Link) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Batches mix rows from many candles, so the span starts its own trace
+	// and links to the spans that queued the rows
+	ctx, span := tracer.Start(ctx, "calculator.writeBatch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("db.table", w.table),
+			attribute.Int("batch.size", len(rows)),
+		))
+	defer func() { observability.EndSpan(span, err) }()
+
+	defer w.metrics.TimerWith(observability.MetricDBInsertDuration, w.labels)()
+	return w.write(ctx, rows)
+}
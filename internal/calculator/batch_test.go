@@ -0,0 +1,92 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// gatedWrite records the batches written, each one waiting until released
+type gatedWrite struct {
+	mu      sync.Mutex
+	batches [][]int
+	release chan struct{}
+	err     error
+}
+
+func (g *gatedWrite) write(ctx context.Context, rows []int) error {
+	<-g.release
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.batches = append(g.batches, append([]int(nil), rows...))
+	return g.err
+}
+
+func TestBatchWriterReportsAfterWrite(t *testing.T) {
+	g := &gatedWrite{release: make(chan struct{})}
+	w := newBatchWriter("test", 3, 10, time.Hour, g.write, zerolog.Nop())
+	defer w.close()
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		w.add(context.Background(), i, func(err error) { results <- err })
+	}
+
+	// The batch is full, but nothing is reported before it is written
+	select {
+	case <-results:
+		t.Fatal("row reported before its batch was written")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(g.release)
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+	}
+	if len(g.batches) != 1 || len(g.batches[0]) != 3 {
+		t.Fatalf("batches = %v, want one of 3 rows", g.batches)
+	}
+}
+
+func TestBatchWriterBlocksWhenFull(t *testing.T) {
+	g := &gatedWrite{release: make(chan struct{})}
+	w := newBatchWriter("test", 1, 1, time.Hour, g.write, zerolog.Nop())
+	defer w.close()
+
+	// One row is being written and one waits in the queue
+	noop := func(error) {}
+	w.add(context.Background(), 0, noop)
+	w.add(context.Background(), 1, noop)
+	eventually(t, "first write", func() bool { return len(w.queue) == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var got error
+	w.add(ctx, 2, func(err error) { got = err })
+	if !errors.Is(got, context.DeadlineExceeded) {
+		t.Fatalf("add to a full queue reported %v, want %v", got, context.DeadlineExceeded)
+	}
+	close(g.release)
+}
+
+func TestBatchWriterReportsFailedWrite(t *testing.T) {
+	g := &gatedWrite{release: make(chan struct{}), err: errors.New("database down")}
+	close(g.release)
+	w := newBatchWriter("test", 1, 10, time.Hour, g.write, zerolog.Nop())
+	defer w.close()
+
+	result := make(chan error, 1)
+	w.add(context.Background(), 0, func(err error) { result <- err })
+	if err := <-result; !errors.Is(err, g.err) {
+		t.Fatalf("failed write reported %v, want %v", err, g.err)
+	}
+	if len(g.batches) != writeAttempts {
+		t.Fatalf("batch written %d times, want %d", len(g.batches), writeAttempts)
+	}
+}
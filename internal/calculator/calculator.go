@@ -93,13 +93,22 @@ func (mc *MetricsCalculator) InitializeBufferFromDB(ctx context.Context, symbol
 	mc.buffers[symbol] = buffer
 	mc.mu.Unlock()
 
-	// Load last 1440 candles (24 hours) from database
+	// Without a database (tests, in-process runs) buffers start empty
+	if mc.pool == nil {
+		return nil
+	}
+
+	// Load the latest 1440 candles (24 hours) from database, oldest first
 	query := `
 		SELECT time, symbol, open, high, low, close, volume, quote_volume, trades
-		FROM candles_1m
-		WHERE symbol = $1
+		FROM (
+			SELECT time, symbol, open, high, low, close, volume, quote_volume, trades
+			FROM candles_1m
+			WHERE symbol = $1
+			ORDER BY time DESC
+			LIMIT 1440
+		) latest
 		ORDER BY time ASC
-		LIMIT 1440
 	`
 
 	rows, err := mc.pool.Query(ctx, query, symbol)
@@ -177,10 +186,18 @@ func (mc *MetricsCalculator) AddCandle(candle ringbuffer.Candle) (*SymbolMetrics
 		mc.mu.Lock()
 	}
 
-	// Add candle to buffer
-	buffer.Append(candle)
+	// Add candle to buffer. A redelivered candle, or one the buffer was just
+	// loaded with from the database, replaces itself rather than adding its
+	// volume twice.
+	latest := buffer.GetLatest()
+	buffer.Upsert(candle)
 	mc.mu.Unlock()
 
+	// Metrics of a candle older than the latest were superseded
+	if latest != nil && candle.OpenTime.Before(latest.OpenTime) {
+		return nil, nil
+	}
+
 	// Calculate metrics if we have enough data
 	return mc.CalculateMetrics(candle.Symbol)
 }
@@ -395,3 +412,117 @@ func (mc *MetricsCalculator) ClearBuffer(symbol string) {
 
 	delete(mc.buffers, symbol)
 }
+
+// BufferCandles returns the candles in symbol's ring buffer, oldest first
+func (mc *MetricsCalculator) BufferCandles(symbol string) []ringbuffer.Candle {
+	mc.mu.RLock()
+	buffer, exists := mc.buffers[symbol]
+	mc.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+	return buffer.GetLast(1440)
+}
+
+// RestoreBuffer replaces symbol's ring buffer with one holding candles,
+// which must be oldest first
+func (mc *MetricsCalculator) RestoreBuffer(symbol string, candles []ringbuffer.Candle) {
+	buffer := ringbuffer.NewRingBuffer()
+	for _, candle := range candles {
+		buffer.Upsert(candle)
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.buffers[symbol] = buffer
+}
+
+// LoadCandlesSince returns the stored candles of every symbol in since that
+// opened after its time there, oldest first, in a single query. Without a
+// database it returns none.
+func (mc *MetricsCalculator) LoadCandlesSince(ctx context.Context, since map[string]time.Time) (map[string][]ringbuffer.Candle, error) {
+	if mc.pool == nil || len(since) == 0 {
+		return nil, nil
+	}
+
+	symbols := make([]string, 0, len(since))
+	times := make([]time.Time, 0, len(since))
+	earliest := time.Now()
+	for symbol, t := range since {
+		symbols = append(symbols, symbol)
+		times = append(times, t)
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+
+	// The constant bound on time lets TimescaleDB skip older chunks
+	query := `
+		SELECT c.time, c.symbol, c.open, c.high, c.low, c.close, c.volume, c.quote_volume, c.trades
+		FROM candles_1m c
+		JOIN unnest($1::text[], $2::timestamptz[]) AS s(symbol, since) ON c.symbol = s.symbol
+		WHERE c.time > s.since AND c.time > $3
+		ORDER BY c.symbol, c.time
+	`
+	rows, err := mc.pool.Query(ctx, query, symbols, times, earliest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := make(map[string][]ringbuffer.Candle, len(since))
+	for rows.Next() {
+		var candle ringbuffer.Candle
+		if err := rows.Scan(
+			&candle.OpenTime,
+			&candle.Symbol,
+			&candle.Open,
+			&candle.High,
+			&candle.Low,
+			&candle.Close,
+			&candle.Volume,
+			&candle.QuoteVolume,
+			&candle.NumberOfTrades,
+		); err != nil {
+			return nil, err
+		}
+		candles[candle.Symbol] = append(candles[candle.Symbol], candle)
+	}
+	return candles, rows.Err()
+}
+
+// Symbols returns the symbols that have a ring buffer
+func (mc *MetricsCalculator) Symbols() []string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	symbols := make([]string, 0, len(mc.buffers))
+	for symbol := range mc.buffers {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// RecentSymbols returns the symbols with candles stored in the last window.
+// Without a database it returns none.
+func (mc *MetricsCalculator) RecentSymbols(ctx context.Context, window time.Duration) ([]string, error) {
+	if mc.pool == nil {
+		return nil, nil
+	}
+
+	rows, err := mc.pool.Query(ctx, `SELECT DISTINCT symbol FROM candles_1m WHERE time > $1`, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
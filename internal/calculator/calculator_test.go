@@ -0,0 +1,41 @@
+package calculator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/rs/zerolog"
+)
+
+func TestAddCandleIgnoresReplays(t *testing.T) {
+	calc := NewMetricsCalculator(zerolog.Nop(), nil)
+	minute := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(i int) ringbuffer.Candle {
+		return ringbuffer.Candle{Symbol: "BTCUSDT", OpenTime: minute.Add(time.Duration(i) * time.Minute), Close: 1, Volume: 10}
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := calc.AddCandle(candle(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, _ := calc.CalculateMetrics("BTCUSDT")
+
+	// The latest candle delivered again is recalculated, not added
+	got, err := calc.AddCandle(candle(4))
+	if err != nil || got == nil {
+		t.Fatalf("replayed latest candle = %v, %v", got, err)
+	}
+	if got.Candle5m.Volume != want.Candle5m.Volume || calc.GetBufferSize("BTCUSDT") != 5 {
+		t.Fatalf("volume_5m = %v with %d candles, want %v with 5", got.Candle5m.Volume, calc.GetBufferSize("BTCUSDT"), want.Candle5m.Volume)
+	}
+
+	// An older one publishes nothing
+	if got, err := calc.AddCandle(candle(2)); got != nil || err != nil {
+		t.Fatalf("replayed old candle = %v, %v", got, err)
+	}
+	if calc.GetBufferSize("BTCUSDT") != 5 {
+		t.Fatalf("buffer holds %d candles", calc.GetBufferSize("BTCUSDT"))
+	}
+}
@@ -0,0 +1,158 @@
+package calculator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/rs/zerolog"
+)
+
+const (
+	memberPrefix    = "member."
+	partitionPrefix = "partition."
+)
+
+func partitionKey(partition int) string {
+	return partitionPrefix + strconv.Itoa(partition)
+}
+
+// partitionAssigner claims a fair share of the candle partitions through
+// leases. Every replica keeps a member lease alive and claims free partitions
+// up to ceil(partitions/members), releasing any beyond that. A new replica
+// gets its share within a refresh or two; a stopped replica's partitions are
+// taken over once its leases expire.
+type partitionAssigner struct {
+	leases     messaging.Leases
+	owner      string
+	partitions int
+	refresh    time.Duration
+	owned      map[int]bool
+	logger     zerolog.Logger
+	metrics    *observability.MetricsCollector
+
+	// assign starts consuming a claimed partition; revoke stops it
+	assign func(ctx context.Context, partition int) error
+	revoke func(partition int)
+}
+
+// run rebalances every refresh until ctx is done, then gives up every lease
+func (a *partitionAssigner) run(ctx context.Context) {
+	ticker := time.NewTicker(a.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.releaseAll()
+			return
+		case <-ticker.C:
+		}
+		if err := a.rebalance(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Warn().Err(err).Msg("partition rebalance failed")
+		}
+	}
+}
+
+// rebalance renews the leases held, hands back partitions beyond this
+// replica's share and claims free ones up to it
+func (a *partitionAssigner) rebalance(ctx context.Context) error {
+	defer func() {
+		a.metrics.Gauge(observability.MetricPartitionsOwned).Set(float64(len(a.owned)))
+	}()
+
+	if _, err := a.leases.Acquire(ctx, memberPrefix+a.owner, a.owner); err != nil {
+		return fmt.Errorf("renew membership: %w", err)
+	}
+	members, err := a.leases.Holders(ctx, memberPrefix)
+	if err != nil {
+		return fmt.Errorf("list members: %w", err)
+	}
+	share := (a.partitions + len(members) - 1) / max(len(members), 1)
+
+	for _, p := range a.ownedPartitions() {
+		ok, err := a.leases.Acquire(ctx, partitionKey(p), a.owner)
+		if err != nil {
+			return fmt.Errorf("renew partition %d: %w", p, err)
+		}
+		if !ok {
+			// Expired while we were unreachable and claimed by another replica
+			a.logger.Warn().Int("partition", p).Msg("lost partition lease")
+			a.revoke(p)
+			delete(a.owned, p)
+		}
+	}
+
+	owned := a.ownedPartitions()
+	for len(owned) > share {
+		p := owned[len(owned)-1]
+		owned = owned[:len(owned)-1]
+		a.logger.Info().Int("partition", p).Int("share", share).Msg("handing back partition")
+		a.release(ctx, p)
+	}
+	if len(a.owned) >= share {
+		return nil
+	}
+
+	holders, err := a.leases.Holders(ctx, partitionPrefix)
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	// Replicas start looking at different partitions so that ones starting
+	// together do not all race for the same leases
+	start := messaging.CandlePartition(a.owner, a.partitions)
+	for i := 0; i < a.partitions && len(a.owned) < share; i++ {
+		p := (start + i) % a.partitions
+		if _, held := holders[partitionKey(p)]; held || a.owned[p] {
+			continue
+		}
+		ok, err := a.leases.Acquire(ctx, partitionKey(p), a.owner)
+		if err != nil {
+			return fmt.Errorf("claim partition %d: %w", p, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := a.assign(ctx, p); err != nil {
+			a.logger.Error().Err(err).Int("partition", p).Msg("failed to start partition")
+			_ = a.leases.Release(ctx, partitionKey(p), a.owner)
+			continue
+		}
+		a.owned[p] = true
+		a.logger.Info().Int("partition", p).Msg("claimed partition")
+	}
+	return nil
+}
+
+// release stops consuming a partition before giving up its lease, so the
+// next owner never overlaps with this one
+func (a *partitionAssigner) release(ctx context.Context, partition int) {
+	a.revoke(partition)
+	delete(a.owned, partition)
+	if err := a.leases.Release(ctx, partitionKey(partition), a.owner); err != nil {
+		a.logger.Warn().Err(err).Int("partition", partition).Msg("failed to release partition lease")
+	}
+}
+
+func (a *partitionAssigner) releaseAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, p := range a.ownedPartitions() {
+		a.release(ctx, p)
+	}
+	_ = a.leases.Release(ctx, memberPrefix+a.owner, a.owner)
+	a.metrics.Gauge(observability.MetricPartitionsOwned).Set(0)
+}
+
+func (a *partitionAssigner) ownedPartitions() []int {
+	owned := make([]int, 0, len(a.owned))
+	for p := range a.owned {
+		owned = append(owned, p)
+	}
+	sort.Ints(owned)
+	return owned
+}
@@ -3,133 +3,134 @@ package calculator
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
 )
 
-// MetricsPersister handles batch writing of metrics to TimescaleDB
+var tracer = observability.Tracer("github.com/bl8ckfz/crypto-screener-backend/internal/calculator")
+
+// MetricsPersister writes the candles the service consumes to candles_1m and
+// the metrics it calculates to metrics_calculated. Each table has a bounded
+// queue drained by one writer, which upserts a batch in a single round trip.
 type MetricsPersister struct {
-	pool   *pgxpool.Pool
-	logger zerolog.Logger
-	queue  chan *SymbolMetrics
-	ctx    context.Context
-	cancel context.CancelFunc
+	pool    *pgxpool.Pool
+	logger  zerolog.Logger
+	candles *batchWriter[ringbuffer.Candle]
+	metrics *batchWriter[*SymbolMetrics]
 }
 
-// NewMetricsPersister creates a new metrics persister with batch writing
-func NewMetricsPersister(pool *pgxpool.Pool, logger zerolog.Logger, batchSize int) *MetricsPersister {
-	ctx, cancel := context.WithCancel(context.Background())
-
+// NewMetricsPersister creates a persister that writes batches of
+// cfg.PersistBatchSize rows, or whatever is queued every
+// cfg.PersistFlushInterval, queueing up to cfg.PersistQueueSize per table
+func NewMetricsPersister(pool *pgxpool.Pool, cfg config.Calculator, logger zerolog.Logger) *MetricsPersister {
 	mp := &MetricsPersister{
 		pool:   pool,
 		logger: logger.With().Str("component", "metrics-persister").Logger(),
-		queue:  make(chan *SymbolMetrics, batchSize*2), // Buffer 2x batch size
-		ctx:    ctx,
-		cancel: cancel,
 	}
-
-	// Start batch writer goroutine
-	go mp.batchWriter(batchSize)
-
+	mp.candles = newBatchWriter("candles_1m", cfg.PersistBatchSize, cfg.PersistQueueSize, cfg.PersistFlushInterval, mp.writeCandles, mp.logger)
+	mp.metrics = newBatchWriter("metrics_calculated", cfg.PersistBatchSize, cfg.PersistQueueSize, cfg.PersistFlushInterval, mp.writeMetrics, mp.logger)
 	return mp
 }
 
-// Enqueue adds metrics to the write queue (non-blocking)
-func (mp *MetricsPersister) Enqueue(metrics *SymbolMetrics) {
-	select {
-	case mp.queue <- metrics:
-	default:
-		mp.logger.Warn().Str("symbol", metrics.Symbol).Msg("metrics queue full, dropping")
-	}
+// SaveCandle queues candle for candles_1m, blocking while the queue is full,
+// and calls done once it is written or could not be
+func (mp *MetricsPersister) SaveCandle(ctx context.Context, candle ringbuffer.Candle, done func(error)) {
+	mp.candles.add(ctx, candle, done)
 }
 
-// batchWriter processes metrics in batches
-func (mp *MetricsPersister) batchWriter(batchSize int) {
-	ticker := time.NewTicker(5 * time.Second) // Write every 5 seconds
-	defer ticker.Stop()
-
-	batch := make([]*SymbolMetrics, 0, batchSize)
-
-	for {
-		select {
-		case <-mp.ctx.Done():
-			// Flush remaining metrics
-			if len(batch) > 0 {
-				mp.writeBatch(batch)
-			}
-			return
-
-		case metrics := <-mp.queue:
-			batch = append(batch, metrics)
-			if len(batch) >= batchSize {
-				mp.writeBatch(batch)
-				batch = batch[:0] // Clear batch
-			}
+// SaveMetrics queues one metrics_calculated row per timeframe of metrics,
+// blocking while the queue is full, and calls done once they are written or
+// could not be
+func (mp *MetricsPersister) SaveMetrics(ctx context.Context, metrics *SymbolMetrics, done func(error)) {
+	mp.metrics.add(ctx, metrics, done)
+}
 
-		case <-ticker.C:
-			if len(batch) > 0 {
-				mp.writeBatch(batch)
-				batch = batch[:0]
-			}
-		}
-	}
+// Close writes what is queued and stops the persister
+func (mp *MetricsPersister) Close() error {
+	mp.candles.close()
+	mp.metrics.close()
+	return nil
 }
 
-// writeBatch writes a batch of metrics to TimescaleDB
-func (mp *MetricsPersister) writeBatch(batch []*SymbolMetrics) {
-	if len(batch) == 0 {
-		return
+const upsertCandle = `
+	INSERT INTO candles_1m (
+		time, symbol,
+		open, high, low, close,
+		volume, quote_volume,
+		trades
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (time, symbol) DO UPDATE SET
+		open = EXCLUDED.open,
+		high = EXCLUDED.high,
+		low = EXCLUDED.low,
+		close = EXCLUDED.close,
+		volume = EXCLUDED.volume,
+		quote_volume = EXCLUDED.quote_volume,
+		trades = EXCLUDED.trades
+`
+
+// writeCandles upserts candles in one batch. The statements of a batch run
+// in one implicit transaction, so either all of them are written or none.
+func (mp *MetricsPersister) writeCandles(ctx context.Context, candles []ringbuffer.Candle) error {
+	batch := &pgx.Batch{}
+	for _, candle := range candles {
+		batch.Queue(upsertCandle,
+			candle.OpenTime,
+			candle.Symbol,
+			candle.Open,
+			candle.High,
+			candle.Low,
+			candle.Close,
+			candle.Volume,
+			candle.QuoteVolume,
+			candle.NumberOfTrades,
+		)
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Use COPY for efficient bulk insert
-	// We'll insert one row per timeframe (5m, 15m, 1h, 4h, 8h, 1d)
-	query := `
-		INSERT INTO metrics_calculated (
-			time, symbol, timeframe,
-			open, high, low, close, volume,
-			price_change, volume_ratio,
-			vcp, rsi_14, macd, macd_signal,
-			fib_r3, fib_r2, fib_r1, fib_pivot, fib_s1, fib_s2, fib_s3
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
-		ON CONFLICT (time, symbol, timeframe) DO UPDATE SET
-			open = EXCLUDED.open,
-			high = EXCLUDED.high,
-			low = EXCLUDED.low,
-			close = EXCLUDED.close,
-			volume = EXCLUDED.volume,
-			price_change = EXCLUDED.price_change,
-			volume_ratio = EXCLUDED.volume_ratio,
-			vcp = EXCLUDED.vcp,
-			rsi_14 = EXCLUDED.rsi_14,
-			macd = EXCLUDED.macd,
-			macd_signal = EXCLUDED.macd_signal,
-			fib_r3 = EXCLUDED.fib_r3,
-			fib_r2 = EXCLUDED.fib_r2,
-			fib_r1 = EXCLUDED.fib_r1,
-			fib_pivot = EXCLUDED.fib_pivot,
-			fib_s1 = EXCLUDED.fib_s1,
-			fib_s2 = EXCLUDED.fib_s2,
-			fib_s3 = EXCLUDED.fib_s3
-	`
-
-	// Begin transaction
-	tx, err := mp.pool.Begin(ctx)
-	if err != nil {
-		mp.logger.Error().Err(err).Msg("failed to begin transaction")
-		return
+	if err := mp.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("upsert %d candles: %w", len(candles), err)
 	}
-	defer tx.Rollback(ctx)
-
-	inserted := 0
+	return nil
+}
 
+const upsertMetrics = `
+	INSERT INTO metrics_calculated (
+		time, symbol, timeframe,
+		open, high, low, close, volume,
+		price_change, volume_ratio,
+		vcp, rsi_14, macd, macd_signal,
+		fib_r3, fib_r2, fib_r1, fib_pivot, fib_s1, fib_s2, fib_s3
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+	ON CONFLICT (time, symbol, timeframe) DO UPDATE SET
+		open = EXCLUDED.open,
+		high = EXCLUDED.high,
+		low = EXCLUDED.low,
+		close = EXCLUDED.close,
+		volume = EXCLUDED.volume,
+		price_change = EXCLUDED.price_change,
+		volume_ratio = EXCLUDED.volume_ratio,
+		vcp = EXCLUDED.vcp,
+		rsi_14 = EXCLUDED.rsi_14,
+		macd = EXCLUDED.macd,
+		macd_signal = EXCLUDED.macd_signal,
+		fib_r3 = EXCLUDED.fib_r3,
+		fib_r2 = EXCLUDED.fib_r2,
+		fib_r1 = EXCLUDED.fib_r1,
+		fib_pivot = EXCLUDED.fib_pivot,
+		fib_s1 = EXCLUDED.fib_s1,
+		fib_s2 = EXCLUDED.fib_s2,
+		fib_s3 = EXCLUDED.fib_s3
+`
+
+// writeMetrics upserts one row per timeframe (5m, 15m, 1h, 4h, 8h, 1d) of
+// each metrics in one batch
+func (mp *MetricsPersister) writeMetrics(ctx context.Context, batch []*SymbolMetrics) error {
+	rows := &pgx.Batch{}
 	for _, metrics := range batch {
-		// Insert each timeframe as a separate row
 		timeframes := []struct {
 			name   string
 			candle TimeframeCandle
@@ -169,7 +170,7 @@ func (mp *MetricsPersister) writeBatch(batch []*SymbolMetrics) {
 				priceChange = metrics.PriceChange1d
 			}
 
-			_, err := tx.Exec(ctx, query,
+			rows.Queue(upsertMetrics,
 				metrics.Timestamp,
 				metrics.Symbol,
 				tf.name,
@@ -192,92 +193,15 @@ func (mp *MetricsPersister) writeBatch(batch []*SymbolMetrics) {
 				metrics.Fibonacci.Support618,
 				metrics.Fibonacci.Support1,
 			)
-
-			if err != nil {
-				mp.logger.Error().
-					Err(err).
-					Str("symbol", metrics.Symbol).
-					Str("timeframe", tf.name).
-					Msg("failed to insert metrics")
-				continue
-			}
-
-			inserted++
 		}
 	}
-
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		mp.logger.Error().Err(err).Msg("failed to commit transaction")
-		return
+	if rows.Len() == 0 {
+		return nil
 	}
 
-	mp.logger.Info().
-		Int("batch_size", len(batch)).
-		Int("rows_inserted", inserted).
-		Msg("persisted metrics batch")
-}
-
-// Close stops the persister and flushes remaining metrics
-func (mp *MetricsPersister) Close() error {
-	mp.cancel()
-	close(mp.queue)
-
-	// Give time for final batch to write
-	time.Sleep(1 * time.Second)
-
-	return nil
-}
-
-// PersistCandle writes a single 1m candle to TimescaleDB
-// This is called synchronously for each candle to ensure we have historical data
-func (mp *MetricsPersister) PersistCandle(ctx context.Context, candle ringbuffer.Candle) error {
-	query := `
-		INSERT INTO candles_1m (
-			time, symbol,
-			open, high, low, close,
-			volume, quote_volume,
-			trades
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		ON CONFLICT (time, symbol) DO UPDATE SET
-			open = EXCLUDED.open,
-			high = EXCLUDED.high,
-			low = EXCLUDED.low,
-			close = EXCLUDED.close,
-			volume = EXCLUDED.volume,
-			quote_volume = EXCLUDED.quote_volume,
-			trades = EXCLUDED.trades
-	`
-
-	_, err := mp.pool.Exec(ctx, query,
-		candle.OpenTime,
-		candle.Symbol,
-		candle.Open,
-		candle.High,
-		candle.Low,
-		candle.Close,
-		candle.Volume,
-		candle.QuoteVolume,
-		candle.NumberOfTrades,
-	)
-
-	if err != nil {
-		mp.logger.Error().
-			Err(err).
-			Str("symbol", candle.Symbol).
-			Time("time", candle.OpenTime).
-			Msg("failed to persist candle to candles_1m")
-		return fmt.Errorf("insert candle: %w", err)
+	if err := mp.pool.SendBatch(ctx, rows).Close(); err != nil {
+		return fmt.Errorf("upsert %d metrics rows: %w", rows.Len(), err)
 	}
-
-	// Log successful persistence periodically (every 100th candle to avoid spam)
-	// This helps verify the feature is working
-	mp.logger.Debug().
-		Str("symbol", candle.Symbol).
-		Time("time", candle.OpenTime).
-		Float64("close", candle.Close).
-		Msg("persisted candle to candles_1m")
-
 	return nil
 }
 
@@ -0,0 +1,493 @@
+package calculator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MetricsSubject is where calculated metrics are published
+	MetricsSubject = "metrics.calculated"
+
+	// consumerName prefixes the durable consumer of each candle partition.
+	// The replica holding a partition's lease is its only subscriber, so each
+	// symbol's candles are handled in order by one ring buffer.
+	consumerName = "metrics-calculator"
+
+	// leaseBucket holds the partition and member leases of all replicas
+	leaseBucket = "calculator-partitions"
+
+	// warmWindow is how recently a symbol must have traded for its buffer to
+	// be loaded when its partition is claimed
+	warmWindow = 10 * time.Minute
+
+	// bufferSpan is how far back a full ring buffer reaches
+	bufferSpan = 24 * time.Hour
+)
+
+// Store persists the candles the service consumes and the metrics it
+// calculates. Writes are queued; done is called once with the outcome of
+// each. MetricsPersister is the TimescaleDB store.
+type Store interface {
+	SaveCandle(ctx context.Context, candle ringbuffer.Candle, done func(error))
+	SaveMetrics(ctx context.Context, metrics *SymbolMetrics, done func(error))
+}
+
+// Service consumes the candle partitions this replica holds, keeps their ring
+// buffers up to date and publishes metrics for every symbol with at least
+// MinPublishCandles candles. With a snapshot store it snapshots the buffers
+// of each partition every SnapshotInterval and when handing it back.
+type Service struct {
+	calc      *MetricsCalculator
+	store     Store
+	snapshots SnapshotStore
+	snapMu    sync.Mutex // serializes snapshot writes
+	bus       messaging.Bus
+	cfg       config.Calculator
+	owner     string
+	logger    zerolog.Logger
+	metrics   *observability.MetricsCollector
+	mu        sync.Mutex
+	subs      map[int]messaging.Subscription
+	assigner  *partitionAssigner
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewService creates a calculator service. snapshots may be nil, in which
+// case buffers are loaded from the database alone.
+func NewService(calc *MetricsCalculator, store Store, snapshots SnapshotStore, bus messaging.Bus, cfg config.Calculator, logger zerolog.Logger) *Service {
+	owner := messaging.InstanceID()
+	return &Service{
+		calc:      calc,
+		store:     store,
+		snapshots: snapshots,
+		bus:       bus,
+		cfg:       cfg,
+		owner:     owner,
+		logger:    logger.With().Str("component", "calculator-service").Str("owner", owner).Logger(),
+		metrics:   observability.GetCollector(),
+		subs:      make(map[int]messaging.Subscription),
+	}
+}
+
+// Start ensures the streams exist, claims this replica's share of the candle
+// partitions and keeps rebalancing them until ctx is done or Stop is called
+func (s *Service) Start(ctx context.Context) error {
+	if err := s.bus.CreateStream(ctx, messaging.CandlesStream); err != nil {
+		return fmt.Errorf("create CANDLES stream: %w", err)
+	}
+	if err := s.bus.CreateStream(ctx, messaging.MetricsStream); err != nil {
+		return fmt.Errorf("create METRICS stream: %w", err)
+	}
+
+	// The single consumer of older releases overlaps every partition, which
+	// a work-queue stream does not allow
+	if err := s.bus.DeleteConsumer(ctx, messaging.CandlesStream.Name, consumerName); err != nil {
+		return err
+	}
+
+	leases, err := s.bus.Leases(ctx, leaseBucket, s.cfg.PartitionLeaseTTL)
+	if err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.assigner = &partitionAssigner{
+		leases:     leases,
+		owner:      s.owner,
+		partitions: s.cfg.CandlePartitions,
+		refresh:    s.cfg.PartitionLeaseTTL / 3,
+		owned:      make(map[int]bool),
+		logger:     s.logger,
+		metrics:    s.metrics,
+		assign:     s.claim,
+		revoke:     s.release,
+	}
+
+	s.logger.Info().Int("partitions", s.cfg.CandlePartitions).Msg("claiming candle partitions")
+	if err := s.assigner.rebalance(runCtx); err != nil {
+		s.logger.Warn().Err(err).Msg("initial partition claim failed")
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.assigner.run(runCtx)
+	}()
+	if s.snapshots != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runSnapshots(runCtx)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(s.done)
+	}()
+	return nil
+}
+
+// Stop stops consuming once the candles in progress are handled and gives
+// up this replica's partitions
+func (s *Service) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// claim warms the ring buffers of a newly held partition, then consumes it
+// from where the previous owner left off
+func (s *Service) claim(ctx context.Context, partition int) error {
+	s.warm(ctx, partition)
+
+	durable := fmt.Sprintf("%s-p%d", consumerName, partition)
+	sub, err := s.bus.Subscribe(ctx, messaging.CandlePartitionSubject(partition), messaging.ConsumerConfig{Durable: durable}, s.handleCandle)
+	if err != nil {
+		return fmt.Errorf("subscribe to partition %d: %w", partition, err)
+	}
+	s.mu.Lock()
+	s.subs[partition] = sub
+	s.mu.Unlock()
+	return nil
+}
+
+// release stops consuming a partition, snapshots its buffers for the next
+// owner and drops them, as they would have a gap if the partition came back
+// later
+func (s *Service) release(partition int) {
+	s.mu.Lock()
+	sub, ok := s.subs[partition]
+	delete(s.subs, partition)
+	s.mu.Unlock()
+	if ok {
+		if err := sub.Unsubscribe(); err != nil {
+			s.logger.Error().Err(err).Int("partition", partition).Msg("failed to unsubscribe")
+		}
+	}
+	if s.snapshots != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.snapMu.Lock()
+		err := s.saveSnapshot(ctx, partition)
+		s.snapMu.Unlock()
+		cancel()
+		if err != nil {
+			s.logger.Warn().Err(err).Int("partition", partition).Msg("failed to snapshot released partition")
+		}
+	}
+	for _, symbol := range s.calc.Symbols() {
+		if messaging.CandlePartition(symbol, s.cfg.CandlePartitions) == partition {
+			s.calc.ClearBuffer(symbol)
+		}
+	}
+}
+
+// Partitions returns the candle partitions this replica consumes
+func (s *Service) Partitions() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	partitions := make([]int, 0, len(s.subs))
+	for p := range s.subs {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+// warm restores the partition's ring buffers from its snapshot, then fills
+// them with the candles stored since, in one query that also loads symbols
+// which traded recently but are missing from the snapshot. Metrics are then
+// complete from the first candle after a restart or handoff.
+func (s *Service) warm(ctx context.Context, partition int) {
+	cutoff := time.Now().Add(-bufferSpan)
+	restored := s.loadSnapshot(ctx, partition, cutoff)
+
+	since := make(map[string]time.Time, len(restored))
+	symbols, err := s.calc.RecentSymbols(ctx, warmWindow)
+	if err != nil {
+		s.logger.Warn().Err(err).Int("partition", partition).Msg("failed to list symbols to warm up")
+	}
+	for _, symbol := range symbols {
+		if messaging.CandlePartition(symbol, s.cfg.CandlePartitions) == partition {
+			since[symbol] = cutoff
+		}
+	}
+	for symbol, candles := range restored {
+		since[symbol] = candles[len(candles)-1].OpenTime
+	}
+
+	stop := s.metrics.TimerWith(observability.MetricSnapshotDuration, observability.Labels{"op": "fill"})
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	gap, err := s.calc.LoadCandlesSince(loadCtx, since)
+	cancel()
+	stop()
+	if err != nil {
+		// Restored buffers would have a gap; leave every symbol to be loaded
+		// on its next candle instead
+		s.logger.Warn().Err(err).Int("partition", partition).Msg("failed to fill buffers from database")
+		return
+	}
+
+	warmed, fromSnapshot, fromDB := 0, 0, 0
+	for symbol := range since {
+		candles := append(restored[symbol], gap[symbol]...)
+		if len(candles) == 0 {
+			continue
+		}
+		s.calc.RestoreBuffer(symbol, candles)
+		warmed++
+		fromSnapshot += len(restored[symbol])
+		fromDB += len(gap[symbol])
+	}
+	s.metrics.CounterWith(observability.MetricCandlesRestored, observability.Labels{"source": "snapshot"}).Add(float64(fromSnapshot))
+	s.metrics.CounterWith(observability.MetricCandlesRestored, observability.Labels{"source": "database"}).Add(float64(fromDB))
+	if warmed > 0 {
+		s.logger.Info().
+			Int("partition", partition).
+			Int("symbols", warmed).
+			Int("from_snapshot", fromSnapshot).
+			Int("from_database", fromDB).
+			Msg("warmed up partition buffers")
+	}
+}
+
+// loadSnapshot returns the candles of the partition's snapshot that are
+// still within a buffer's span, by symbol. A missing or unreadable snapshot
+// yields none.
+func (s *Service) loadSnapshot(ctx context.Context, partition int, cutoff time.Time) map[string][]ringbuffer.Candle {
+	if s.snapshots == nil {
+		return nil
+	}
+	defer s.metrics.TimerWith(observability.MetricSnapshotDuration, observability.Labels{"op": "restore"})()
+
+	data, err := s.snapshots.Load(ctx, partition)
+	if err != nil || data == nil {
+		if err != nil {
+			s.logger.Warn().Err(err).Int("partition", partition).Msg("failed to load snapshot")
+		}
+		return nil
+	}
+	var snap ringbuffer.Snapshot
+	if err := snap.UnmarshalBinary(data); err != nil {
+		s.logger.Warn().Err(err).Int("partition", partition).Msg("ignoring unreadable snapshot")
+		return nil
+	}
+
+	restored := make(map[string][]ringbuffer.Candle, len(snap.Candles))
+	for symbol, candles := range snap.Candles {
+		// The partition count may have changed since the snapshot was taken
+		if messaging.CandlePartition(symbol, s.cfg.CandlePartitions) != partition {
+			continue
+		}
+		first := sort.Search(len(candles), func(i int) bool { return candles[i].OpenTime.After(cutoff) })
+		if first < len(candles) {
+			restored[symbol] = candles[first:]
+		}
+	}
+	s.logger.Debug().
+		Int("partition", partition).
+		Time("taken_at", snap.TakenAt).
+		Int("symbols", len(restored)).
+		Msg("loaded snapshot")
+	return restored
+}
+
+// runSnapshots snapshots every held partition each SnapshotInterval until
+// ctx is done, so a crashed replica's successor restores recent buffers
+func (s *Service) runSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, partition := range s.Partitions() {
+			// A partition released meanwhile has a final snapshot already
+			s.snapMu.Lock()
+			s.mu.Lock()
+			_, held := s.subs[partition]
+			s.mu.Unlock()
+			var err error
+			if held {
+				err = s.saveSnapshot(ctx, partition)
+			}
+			s.snapMu.Unlock()
+			if err != nil && ctx.Err() == nil {
+				s.logger.Warn().Err(err).Int("partition", partition).Msg("failed to snapshot partition")
+			}
+		}
+	}
+}
+
+// saveSnapshot writes the buffers of the partition's symbols to the
+// snapshot store. The caller holds snapMu.
+func (s *Service) saveSnapshot(ctx context.Context, partition int) error {
+	defer s.metrics.TimerWith(observability.MetricSnapshotDuration, observability.Labels{"op": "save"})()
+
+	snap := ringbuffer.Snapshot{TakenAt: time.Now(), Candles: make(map[string][]ringbuffer.Candle)}
+	for _, symbol := range s.calc.Symbols() {
+		if messaging.CandlePartition(symbol, s.cfg.CandlePartitions) != partition {
+			continue
+		}
+		if candles := s.calc.BufferCandles(symbol); len(candles) > 0 {
+			snap.Candles[symbol] = candles
+		}
+	}
+	data, err := snap.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return s.snapshots.Save(ctx, partition, data)
+}
+
+// metricsMsgID identifies the metrics calculated for candle
+func metricsMsgID(candle ringbuffer.Candle) string {
+	return fmt.Sprintf("metrics.%s.%d", candle.Symbol, candle.OpenTime.UnixMilli())
+}
+
+// writeAck acks a message once every write started for it has succeeded. A
+// failed write leaves the message for redelivery.
+type writeAck struct {
+	msg     *messaging.Msg
+	pending atomic.Int32
+	failed  atomic.Bool
+}
+
+func newWriteAck(msg *messaging.Msg) *writeAck {
+	a := &writeAck{msg: msg}
+	a.pending.Store(1) // the handler itself, done when it returns
+	return a
+}
+
+// add returns the callback of one more write
+func (a *writeAck) add() func(error) {
+	a.pending.Add(1)
+	return a.done
+}
+
+func (a *writeAck) done(err error) {
+	if err != nil {
+		a.failed.Store(true)
+	}
+	if a.pending.Add(-1) == 0 && !a.failed.Load() {
+		a.msg.Ack()
+	}
+}
+
+func (s *Service) handleCandle(ctx context.Context, msg *messaging.Msg) {
+	// Acked once the candle and its metrics are written. Handling the message
+	// again after a failed write is harmless: the ring buffer replaces a
+	// replayed candle, writes upsert and published metrics are deduplicated.
+	ack := newWriteAck(msg)
+	defer ack.done(nil)
+
+	// Quarantined candles are published on subjects no partition consumer
+	// matches; one that reached us anyway must not touch the buffers
+	if reason := msg.Header.Get(messaging.HeaderQuarantineReason); reason != "" {
+		s.logger.Warn().Str("subject", msg.Subject).Str("reason", reason).Msg("ignoring quarantined candle")
+		return
+	}
+
+	// Continue the trace started by the data collector
+	msgCtx, span := tracer.Start(messaging.ExtractTrace(ctx, msg.Header), "calculator.handleCandle",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.subject", msg.Subject)))
+	defer span.End()
+
+	// Parse candle from message
+	var candle ringbuffer.Candle
+	if err := json.Unmarshal(msg.Data, &candle); err != nil {
+		s.logger.Error().Err(err).Msg("failed to unmarshal candle")
+		span.RecordError(err)
+		return
+	}
+	span.SetAttributes(attribute.String("symbol", candle.Symbol))
+
+	s.logger.Debug().
+		Str("symbol", candle.Symbol).
+		Float64("volume", candle.Volume).
+		Float64("quote_volume", candle.QuoteVolume).
+		Float64("close", candle.Close).
+		Msg("received candle")
+
+	s.metrics.Counter(observability.MetricCandlesProcessed).Inc()
+
+	// Queue the candle for candles_1m, which ring buffers are loaded from on
+	// restart. Metrics are published without waiting for the write.
+	s.store.SaveCandle(msgCtx, candle, ack.add())
+
+	// Measure calculation time
+	defer s.metrics.Timer(observability.MetricCalculationDuration)()
+
+	// Add candle and calculate metrics
+	_, addSpan := tracer.Start(msgCtx, "calculator.AddCandle")
+	metricsData, err := s.calc.AddCandle(candle)
+	observability.EndSpan(addSpan, err)
+	if err != nil {
+		s.logger.Error().Err(err).Str("symbol", candle.Symbol).Msg("failed to calculate metrics")
+		return
+	}
+
+	// Only publish if we have meaningful metrics (buffer has enough data)
+	if metricsData == nil || s.calc.GetBufferSize(candle.Symbol) < s.cfg.MinPublishCandles {
+		return
+	}
+
+	s.metrics.Counter(observability.MetricMetricsCalculated).Inc()
+
+	// Persist metrics to TimescaleDB (async batch write)
+	s.store.SaveMetrics(msgCtx, metricsData, ack.add())
+
+	payload, err := json.Marshal(metricsData)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to marshal metrics")
+		return
+	}
+
+	// Carry the candle's pipeline stamps forward and add our own. Metrics are
+	// identified by the candle they were calculated for, so handling a
+	// redelivered candle again publishes nothing new.
+	out := messaging.NewMsg(MetricsSubject, payload, msg.Header)
+	messaging.SetMsgID(out, metricsMsgID(candle))
+	publishTime := time.Now()
+	messaging.SetTimestamp(out.Header, messaging.HeaderCalculatorPublished, publishTime)
+	messaging.InjectTrace(msgCtx, out)
+	if err := s.bus.Publish(msgCtx, out); err != nil {
+		s.logger.Error().Err(err).Msg("failed to publish metrics")
+		s.metrics.Counter(observability.MetricNATSPublishErrors).Inc()
+		return
+	}
+
+	s.metrics.Counter(observability.MetricNATSMessagesPublished).Inc()
+	if collected, ok := messaging.Timestamp(msg.Header, messaging.HeaderCollectorPublished); ok {
+		s.metrics.RecordStage(observability.StageCalculator, publishTime.Sub(collected))
+	}
+
+	s.logger.Debug().
+		Str("symbol", candle.Symbol).
+		Float64("vcp", metricsData.VCP).
+		Float64("rsi", metricsData.RSI).
+		Float64("volume_1h", metricsData.Candle1h.Volume).
+		Float64("volume_5m", metricsData.Candle5m.Volume).
+		Msg("published metrics")
+}
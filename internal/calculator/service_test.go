@@ -0,0 +1,167 @@
+package calculator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/ringbuffer"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/rs/zerolog"
+)
+
+// recordingStore counts the candles each replica persisted
+type recordingStore struct {
+	mu      sync.Mutex
+	candles map[string]int
+}
+
+func (r *recordingStore) SaveCandle(ctx context.Context, candle ringbuffer.Candle, done func(error)) {
+	r.mu.Lock()
+	r.candles[fmt.Sprintf("%s@%d", candle.Symbol, candle.OpenTime.Unix())]++
+	r.mu.Unlock()
+	done(nil)
+}
+
+func (r *recordingStore) SaveMetrics(ctx context.Context, metrics *SymbolMetrics, done func(error)) {
+	done(nil)
+}
+
+func (r *recordingStore) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, c := range r.candles {
+		n += c
+	}
+	return n
+}
+
+func startReplica(t *testing.T, bus messaging.Bus, cfg config.Calculator, snapshots SnapshotStore) (*Service, *recordingStore) {
+	t.Helper()
+	store := &recordingStore{candles: make(map[string]int)}
+	svc := NewService(NewMetricsCalculator(zerolog.Nop(), nil), store, snapshots, bus, cfg, zerolog.Nop())
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(svc.Stop)
+	return svc, store
+}
+
+func publishCandles(t *testing.T, bus messaging.Bus, partitions int, minute time.Time) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		candle := ringbuffer.Candle{Symbol: fmt.Sprintf("SYM%dUSDT", i), OpenTime: minute, Close: 1}
+		payload, _ := json.Marshal(candle)
+		msg := messaging.NewMsg(messaging.CandleSubject(candle.Symbol, partitions), payload, nil)
+		if err := bus.Publish(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicasSplitPartitions(t *testing.T) {
+	bus := messaging.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	cfg := config.Calculator{CandlePartitions: 4, PartitionLeaseTTL: 300 * time.Millisecond, MinPublishCandles: 1000}
+
+	a, storeA := startReplica(t, bus, cfg, nil)
+	if got := len(a.Partitions()); got != 4 {
+		t.Fatalf("lone replica holds %d partitions, want 4", got)
+	}
+
+	// A second replica gets half once the first hands partitions back
+	b, storeB := startReplica(t, bus, cfg, nil)
+	eventually(t, "an even split", func() bool {
+		return len(a.Partitions()) == 2 && len(b.Partitions()) == 2
+	})
+	for _, p := range a.Partitions() {
+		for _, q := range b.Partitions() {
+			if p == q {
+				t.Fatalf("partition %d held by both replicas", p)
+			}
+		}
+	}
+
+	// Every candle is handled once, by the replica holding its partition
+	minute := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	publishCandles(t, bus, cfg.CandlePartitions, minute)
+	eventually(t, "all candles", func() bool { return storeA.count()+storeB.count() == 20 })
+	if storeA.count() == 0 || storeB.count() == 0 {
+		t.Fatalf("candles not split: a=%d b=%d", storeA.count(), storeB.count())
+	}
+
+	// The survivor takes over a stopped replica's partitions
+	a.Stop()
+	eventually(t, "takeover", func() bool { return len(b.Partitions()) == 4 })
+	before := storeB.count()
+	publishCandles(t, bus, cfg.CandlePartitions, minute.Add(time.Minute))
+	eventually(t, "candles after takeover", func() bool { return storeB.count() == before+20 })
+}
+
+func TestSnapshotRestoredByNextReplica(t *testing.T) {
+	bus := messaging.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	snapshots, err := NewFileSnapshots(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Calculator{CandlePartitions: 4, PartitionLeaseTTL: 300 * time.Millisecond, MinPublishCandles: 1000, SnapshotInterval: 50 * time.Millisecond}
+
+	a, storeA := startReplica(t, bus, cfg, snapshots)
+	minute := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+	for i := 0; i < 5; i++ {
+		publishCandles(t, bus, cfg.CandlePartitions, minute.Add(time.Duration(i)*time.Minute))
+	}
+	eventually(t, "all candles", func() bool { return storeA.count() == 100 })
+
+	// Partitions are snapshotted while held
+	eventually(t, "periodic snapshots", func() bool {
+		for p := 0; p < cfg.CandlePartitions; p++ {
+			if data, _ := snapshots.Load(context.Background(), p); data == nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	// and once more when handed back, so the next replica starts where this
+	// one stopped, without a database
+	a.Stop()
+	b, _ := startReplica(t, bus, cfg, snapshots)
+	for i := 0; i < 20; i++ {
+		symbol := fmt.Sprintf("SYM%dUSDT", i)
+		candles := b.calc.BufferCandles(symbol)
+		if len(candles) != 5 || !candles[4].OpenTime.Equal(minute.Add(4*time.Minute)) {
+			t.Fatalf("%s restored with %d candles", symbol, len(candles))
+		}
+	}
+
+	// Candles older than a buffer's span are not restored
+	stale := ringbuffer.Snapshot{TakenAt: time.Now(), Candles: map[string][]ringbuffer.Candle{
+		"SYM0USDT": {{Symbol: "SYM0USDT", OpenTime: time.Now().Add(-25 * time.Hour)}},
+	}}
+	data, _ := stale.MarshalBinary()
+	p := messaging.CandlePartition("SYM0USDT", cfg.CandlePartitions)
+	if err := snapshots.Save(context.Background(), p, data); err != nil {
+		t.Fatal(err)
+	}
+	if restored := b.loadSnapshot(context.Background(), p, time.Now().Add(-bufferSpan)); len(restored) != 0 {
+		t.Errorf("restored candles older than a day: %v", restored)
+	}
+}
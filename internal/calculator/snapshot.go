@@ -0,0 +1,97 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SnapshotStore keeps the latest ring buffer snapshot of each candle
+// partition, encoded by ringbuffer.Snapshot, so a replica claiming a
+// partition starts from it instead of loading a day of candles per symbol
+type SnapshotStore interface {
+	Save(ctx context.Context, partition int, data []byte) error
+
+	// Load returns nil without an error if the partition has no snapshot
+	Load(ctx context.Context, partition int) ([]byte, error)
+}
+
+// snapshotTTL is how long a snapshot is worth keeping: by then every candle
+// in it has left the ring buffers
+const snapshotTTL = 24 * time.Hour
+
+// FileSnapshots keeps snapshots as files in a directory, which replicas
+// must share to pick up each other's partitions
+type FileSnapshots struct {
+	dir string
+}
+
+// NewFileSnapshots creates a store in dir, creating the directory if needed
+func NewFileSnapshots(dir string) (*FileSnapshots, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %w", err)
+	}
+	return &FileSnapshots{dir: dir}, nil
+}
+
+func (f *FileSnapshots) path(partition int) string {
+	return filepath.Join(f.dir, fmt.Sprintf("partition-%d.snap", partition))
+}
+
+// Save writes a temporary file and renames it over the previous snapshot,
+// so a crash mid-write leaves the previous one intact
+func (f *FileSnapshots) Save(ctx context.Context, partition int, data []byte) error {
+	tmp, err := os.CreateTemp(f.dir, "partition-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(partition))
+}
+
+func (f *FileSnapshots) Load(ctx context.Context, partition int) ([]byte, error) {
+	data, err := os.ReadFile(f.path(partition))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// RedisSnapshots keeps snapshots in Redis, expiring them after a day
+type RedisSnapshots struct {
+	rdb *redis.Client
+}
+
+// NewRedisSnapshots creates a store on rdb
+func NewRedisSnapshots(rdb *redis.Client) *RedisSnapshots {
+	return &RedisSnapshots{rdb: rdb}
+}
+
+func snapshotKey(partition int) string {
+	return fmt.Sprintf("calculator:snapshot:p%d", partition)
+}
+
+func (r *RedisSnapshots) Save(ctx context.Context, partition int, data []byte) error {
+	return r.rdb.Set(ctx, snapshotKey(partition), data, snapshotTTL).Err()
+}
+
+func (r *RedisSnapshots) Load(ctx context.Context, partition int) ([]byte, error) {
+	data, err := r.rdb.Get(ctx, snapshotKey(partition)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+)
+
+const (
+	defaultStatsWindow = 24 * time.Hour
+	maxStatsWindow     = 30 * 24 * time.Hour
+	defaultStatsTop    = 10
+	maxStatsTop        = 100
+	// maxStatsBuckets bounds the time series length (e.g. 7 days of 5m buckets)
+	maxStatsBuckets = 2016
+)
+
+// statsBuckets maps the accepted bucket parameter to its width and the
+// interval literal passed to time_bucket
+var statsBuckets = map[string]struct {
+	width    time.Duration
+	interval string
+}{
+	"5m": {5 * time.Minute, "5 minutes"},
+	"1h": {time.Hour, "1 hour"},
+	"1d": {24 * time.Hour, "1 day"},
+}
+
+// alertStatsQuery holds the parsed parameters of a /api/alerts/stats request
+type alertStatsQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Bucket    string
+	Top       int
+	Symbols   []string
+	RuleTypes []string
+}
+
+type ruleTypeCount struct {
+	RuleType  string `json:"rule_type"`
+	Direction string `json:"direction,omitempty"`
+	Count     int64  `json:"count"`
+}
+
+type symbolCount struct {
+	Symbol  string   `json:"symbol"`
+	Count   int64    `json:"count"`
+	Bullish int64    `json:"bullish"`
+	Bearish int64    `json:"bearish"`
+	Ratio   *float64 `json:"bull_bear_ratio,omitempty"` // omitted without bearish alerts
+}
+
+type bucketCount struct {
+	Time    time.Time `json:"time"`
+	Count   int64     `json:"count"`
+	Bullish int64     `json:"bullish"`
+	Bearish int64     `json:"bearish"`
+}
+
+type alertStatsResponse struct {
+	Since      time.Time       `json:"since"`
+	Until      time.Time       `json:"until"`
+	Bucket     string          `json:"bucket"`
+	Total      int64           `json:"total"`
+	Bullish    int64           `json:"bullish"`
+	Bearish    int64           `json:"bearish"`
+	Ratio      *float64        `json:"bull_bear_ratio,omitempty"` // omitted without bearish alerts
+	ByRuleType []ruleTypeCount `json:"by_rule_type"`
+	TopSymbols []symbolCount   `json:"top_symbols"`
+	Buckets    []bucketCount   `json:"buckets"`
+}
+
+// parseAlertStatsQuery validates the query string of a /api/alerts/stats request.
+// The window defaults to the last 24 hours ending now.
+func parseAlertStatsQuery(q url.Values, now time.Time) (alertStatsQuery, error) {
+	sq := alertStatsQuery{
+		Until:     now,
+		Bucket:    strings.TrimSpace(q.Get("bucket")),
+		Top:       clamp(toInt(q.Get("top"), defaultStatsTop), 1, maxStatsTop),
+		Symbols:   splitMultiValue(q["symbol"], strings.ToUpper),
+		RuleTypes: splitMultiValue(q["rule_type"], nil),
+	}
+	if sq.Bucket == "" {
+		sq.Bucket = "1h"
+	}
+	bucket, ok := statsBuckets[sq.Bucket]
+	if !ok {
+		return sq, fmt.Errorf("bucket must be one of 5m, 1h, 1d")
+	}
+
+	if raw := strings.TrimSpace(q.Get("until")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return sq, fmt.Errorf("until must be an RFC3339 timestamp")
+		}
+		sq.Until = t
+	}
+	sq.Since = sq.Until.Add(-defaultStatsWindow)
+	if raw := strings.TrimSpace(q.Get("since")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return sq, fmt.Errorf("since must be an RFC3339 timestamp")
+		}
+		sq.Since = t
+	}
+
+	window := sq.Until.Sub(sq.Since)
+	if window <= 0 {
+		return sq, fmt.Errorf("until must be after since")
+	}
+	if window > maxStatsWindow {
+		return sq, fmt.Errorf("window must not exceed %d days", int(maxStatsWindow.Hours()/24))
+	}
+	if int(window/bucket.width) > maxStatsBuckets {
+		return sq, fmt.Errorf("too many %s buckets for window, use a larger bucket", sq.Bucket)
+	}
+
+	return sq, nil
+}
+
+// whereClause renders the shared filter of all stats queries. Leading
+// arguments are kept in place so callers can reference them as $1, $2, ...
+func (sq alertStatsQuery) whereClause(leading ...interface{}) (string, []interface{}) {
+	args := append(leading, sq.Since, sq.Until)
+	filters := []string{
+		"created_at >= $" + strconv.Itoa(len(args)-1),
+		"created_at < $" + strconv.Itoa(len(args)),
+	}
+
+	if len(sq.Symbols) > 0 {
+		args = append(args, sq.Symbols)
+		filters = append(filters, "symbol = ANY($"+strconv.Itoa(len(args))+")")
+	}
+	if len(sq.RuleTypes) > 0 {
+		args = append(args, sq.RuleTypes)
+		filters = append(filters, "rule_type = ANY($"+strconv.Itoa(len(args))+")")
+	}
+
+	return strings.Join(filters, " AND "), args
+}
+
+func (s *Server) handleAlertStats(w http.ResponseWriter, r *http.Request) {
+	sq, err := parseAlertStatsQuery(r.URL.Query(), time.Now().UTC())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// Postgres rejects untyped parameters a statement does not reference, so only
+	// the symbol and bucket queries carry the bullish/bearish lists as $1 and $2
+	where, args := sq.whereClause()
+	directionWhere, directionArgs := sq.whereClause(alerts.BullishRuleTypes, alerts.BearishRuleTypes)
+	directionCounts := `
+		COUNT(*) FILTER (WHERE rule_type = ANY($1)) AS bullish,
+		COUNT(*) FILTER (WHERE rule_type = ANY($2)) AS bearish`
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp := alertStatsResponse{
+		Since:      sq.Since,
+		Until:      sq.Until,
+		Bucket:     sq.Bucket,
+		ByRuleType: []ruleTypeCount{},
+		TopSymbols: []symbolCount{},
+		Buckets:    []bucketCount{},
+	}
+
+	// Counts per rule type
+	rows, err := s.db.Query(ctx, `
+		SELECT rule_type, COUNT(*) AS count
+		FROM alert_history
+		WHERE `+where+`
+		GROUP BY rule_type
+		ORDER BY count DESC, rule_type`, args...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	for rows.Next() {
+		var rc ruleTypeCount
+		if err := rows.Scan(&rc.RuleType, &rc.Count); err != nil {
+			rows.Close()
+			s.writeError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+			return
+		}
+		rc.Direction = alerts.RuleDirection(rc.RuleType)
+		switch rc.Direction {
+		case alerts.DirectionBullish:
+			resp.Bullish += rc.Count
+		case alerts.DirectionBearish:
+			resp.Bearish += rc.Count
+		}
+		resp.Total += rc.Count
+		resp.ByRuleType = append(resp.ByRuleType, rc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	resp.Ratio = bullBearRatio(resp.Bullish, resp.Bearish)
+
+	// Top N symbols by alert frequency
+	topArgs := append(directionArgs[:len(directionArgs):len(directionArgs)], sq.Top)
+	rows, err = s.db.Query(ctx, `
+		SELECT symbol, COUNT(*) AS count,`+directionCounts+`
+		FROM alert_history
+		WHERE `+directionWhere+`
+		GROUP BY symbol
+		ORDER BY count DESC, symbol
+		LIMIT $`+strconv.Itoa(len(topArgs)), topArgs...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	for rows.Next() {
+		var sc symbolCount
+		if err := rows.Scan(&sc.Symbol, &sc.Count, &sc.Bullish, &sc.Bearish); err != nil {
+			rows.Close()
+			s.writeError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+			return
+		}
+		sc.Ratio = bullBearRatio(sc.Bullish, sc.Bearish)
+		resp.TopSymbols = append(resp.TopSymbols, sc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+
+	// Time series using TimescaleDB time_bucket
+	bucketArgs := append(directionArgs[:len(directionArgs):len(directionArgs)], statsBuckets[sq.Bucket].interval)
+	rows, err = s.db.Query(ctx, `
+		SELECT time_bucket($`+strconv.Itoa(len(bucketArgs))+`::interval, created_at) AS bucket,
+			COUNT(*) AS count,`+directionCounts+`
+		FROM alert_history
+		WHERE `+directionWhere+`
+		GROUP BY bucket
+		ORDER BY bucket`, bucketArgs...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bc bucketCount
+		if err := rows.Scan(&bc.Time, &bc.Count, &bc.Bullish, &bc.Bearish); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+			return
+		}
+		resp.Buckets = append(resp.Buckets, bc)
+	}
+	if err := rows.Err(); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// bullBearRatio returns bullish/bearish. Without bearish alerts the ratio is
+// undefined, so it returns nil and bull_bear_ratio is left out of the response;
+// clients read the bullish and bearish counts instead.
+func bullBearRatio(bullish, bearish int64) *float64 {
+	if bearish == 0 {
+		return nil
+	}
+	ratio := float64(bullish) / float64(bearish)
+	return &ratio
+}
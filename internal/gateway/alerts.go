@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+)
+
+const (
+	defaultAlertsLimit = 100
+	maxAlertsLimit     = 500
+
+	// nextCursorHeader carries the opaque cursor for the next page of alerts.
+	// The body stays a plain JSON array so existing clients keep working.
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// alertCursor identifies the last alert of a page. Alerts are ordered by
+// (created_at DESC, id DESC), so the pair is a stable keyset position. The
+// serial id stays inside the cursor; alerts are returned with the ID the
+// engine gave them, the one WebSocket and SSE clients see.
+type alertCursor struct {
+	Time time.Time
+	ID   int64
+}
+
+// alertQuery holds the parsed filters of a /api/alerts request
+type alertQuery struct {
+	Symbols   []string
+	RuleTypes []string
+	Since     *time.Time
+	Until     *time.Time
+	Cursor    *alertCursor
+	Limit     int
+}
+
+// encodeAlertCursor returns the opaque cursor string for a keyset position
+func encodeAlertCursor(c alertCursor) string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeAlertCursor parses a cursor produced by encodeAlertCursor
+func decodeAlertCursor(s string) (alertCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return alertCursor{}, fmt.Errorf("invalid cursor encoding")
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return alertCursor{}, fmt.Errorf("invalid cursor format")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return alertCursor{}, fmt.Errorf("invalid cursor time")
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return alertCursor{}, fmt.Errorf("invalid cursor id")
+	}
+	return alertCursor{Time: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// splitMultiValue collects values from repeated and comma-separated query params,
+// e.g. ?symbol=BTCUSDT&symbol=ETHUSDT or ?symbol=BTCUSDT,ETHUSDT
+func splitMultiValue(values []string, normalize func(string) string) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, v := range values {
+		for _, raw := range strings.Split(v, ",") {
+			item := strings.TrimSpace(raw)
+			if normalize != nil {
+				item = normalize(item)
+			}
+			if item == "" {
+				continue
+			}
+			if _, ok := seen[item]; ok {
+				continue
+			}
+			seen[item] = struct{}{}
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseAlertQuery validates the query string of a /api/alerts request
+func parseAlertQuery(q url.Values) (alertQuery, error) {
+	aq := alertQuery{
+		Symbols:   splitMultiValue(q["symbol"], strings.ToUpper),
+		RuleTypes: splitMultiValue(q["rule_type"], nil),
+		Limit:     clamp(toInt(q.Get("limit"), defaultAlertsLimit), 1, maxAlertsLimit),
+	}
+
+	if raw := strings.TrimSpace(q.Get("since")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return aq, fmt.Errorf("since must be an RFC3339 timestamp")
+		}
+		aq.Since = &t
+	}
+	if raw := strings.TrimSpace(q.Get("until")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return aq, fmt.Errorf("until must be an RFC3339 timestamp")
+		}
+		aq.Until = &t
+	}
+	if aq.Since != nil && aq.Until != nil && aq.Until.Before(*aq.Since) {
+		return aq, fmt.Errorf("until must not be before since")
+	}
+
+	if raw := strings.TrimSpace(q.Get("cursor")); raw != "" {
+		c, err := decodeAlertCursor(raw)
+		if err != nil {
+			return aq, err
+		}
+		aq.Cursor = &c
+	}
+
+	return aq, nil
+}
+
+// buildSQL renders the alert_history query and its arguments. One extra row is
+// requested so the handler can tell whether another page exists.
+func (aq alertQuery) buildSQL() (string, []interface{}) {
+	filters := []string{"1=1"}
+	args := []interface{}{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(aq.Symbols) > 0 {
+		filters = append(filters, "symbol = ANY("+arg(aq.Symbols)+")")
+	}
+	if len(aq.RuleTypes) > 0 {
+		filters = append(filters, "rule_type = ANY("+arg(aq.RuleTypes)+")")
+	}
+	if aq.Since != nil {
+		filters = append(filters, "created_at >= "+arg(*aq.Since))
+	}
+	if aq.Until != nil {
+		filters = append(filters, "created_at < "+arg(*aq.Until))
+	}
+	if aq.Cursor != nil {
+		filters = append(filters, "(created_at, id) < ("+arg(aq.Cursor.Time)+", "+arg(aq.Cursor.ID)+")")
+	}
+
+	query := "SELECT id, alert_id::TEXT, created_at, symbol, rule_type, rule_version, message, price, metadata FROM alert_history WHERE " +
+		strings.Join(filters, " AND ") +
+		" ORDER BY created_at DESC, id DESC LIMIT " + arg(aq.Limit+1)
+
+	return query, args
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	aq, err := parseAlertQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	query, args := aq.buildSQL()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	defer rows.Close()
+
+	results := make([]alerts.Alert, 0, aq.Limit)
+	var last alertCursor
+	hasMore := false
+	for rows.Next() {
+		if len(results) == aq.Limit {
+			hasMore = true
+			break
+		}
+
+		var a alerts.Alert
+		var id int64
+		var ruleVersion *int
+		var message *string
+		var price *float64
+		var metadata []byte
+		if err := rows.Scan(&id, &a.ID, &a.Timestamp, &a.Symbol, &a.RuleType, &ruleVersion, &message, &price, &metadata); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+			return
+		}
+		if ruleVersion != nil {
+			a.RuleVersion = *ruleVersion
+		}
+		if message != nil {
+			a.Description = *message
+		}
+		if price != nil {
+			a.Price = *price
+		}
+		if len(metadata) > 0 {
+			_ = json.Unmarshal(metadata, &a.Metadata)
+		}
+		results = append(results, a)
+		last = alertCursor{Time: a.Timestamp, ID: id}
+	}
+	if err := rows.Err(); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+
+	if hasMore {
+		w.Header().Set(nextCursorHeader, encodeAlertCursor(last))
+	}
+	s.writeJSON(w, http.StatusOK, results)
+}
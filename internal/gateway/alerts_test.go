@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertCursorRoundTrip(t *testing.T) {
+	want := alertCursor{Time: time.Date(2026, 1, 29, 12, 30, 15, 123456000, time.UTC), ID: 4242}
+
+	got, err := decodeAlertCursor(encodeAlertCursor(want))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !got.Time.Equal(want.Time) || got.ID != want.ID {
+		t.Fatalf("cursor mismatch: got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"not-base64!", "Zm9v", encodeAlertCursor(want)[:3]} {
+		if _, err := decodeAlertCursor(bad); err == nil {
+			t.Errorf("expected error for cursor %q", bad)
+		}
+	}
+}
+
+func TestParseAlertQuery(t *testing.T) {
+	q := url.Values{}
+	q.Add("symbol", "btcusdt,ETHUSDT")
+	q.Add("symbol", "BTCUSDT")
+	q.Add("rule_type", "futures_pioneer_bull")
+	q.Set("since", "2026-01-29T00:00:00Z")
+	q.Set("until", "2026-01-30T00:00:00Z")
+	q.Set("limit", "10000")
+
+	aq, err := parseAlertQuery(q)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(aq.Symbols) != 2 || aq.Symbols[0] != "BTCUSDT" || aq.Symbols[1] != "ETHUSDT" {
+		t.Errorf("symbols = %v", aq.Symbols)
+	}
+	if len(aq.RuleTypes) != 1 {
+		t.Errorf("rule types = %v", aq.RuleTypes)
+	}
+	if aq.Limit != maxAlertsLimit {
+		t.Errorf("limit = %d, want %d", aq.Limit, maxAlertsLimit)
+	}
+
+	query, args := aq.buildSQL()
+	for _, frag := range []string{"SELECT id, alert_id::TEXT,", "symbol = ANY($1)", "rule_type = ANY($2)", "created_at >= $3", "created_at < $4", "LIMIT $5"} {
+		if !strings.Contains(query, frag) {
+			t.Errorf("query missing %q: %s", frag, query)
+		}
+	}
+	if len(args) != 5 || args[4] != maxAlertsLimit+1 {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
+
+func TestParseAlertQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"bad_since", "since=yesterday"},
+		{"bad_until", "until=2026-13-01"},
+		{"until_before_since", "since=2026-01-02T00:00:00Z&until=2026-01-01T00:00:00Z"},
+		{"bad_cursor", "cursor=%21%21%21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			if _, err := parseAlertQuery(q); err == nil {
+				t.Errorf("expected error for %q", tt.query)
+			}
+		})
+	}
+}
+
+func TestAlertQueryCursorFilter(t *testing.T) {
+	c := alertCursor{Time: time.Now().UTC(), ID: 7}
+	aq, err := parseAlertQuery(url.Values{"cursor": {encodeAlertCursor(c)}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	query, args := aq.buildSQL()
+	if !strings.Contains(query, "(created_at, id) < ($1, $2)") {
+		t.Errorf("query missing keyset filter: %s", query)
+	}
+	if args[1] != int64(7) {
+		t.Errorf("cursor id arg = %v", args[1])
+	}
+}
+
+func TestParseAlertStatsQuery(t *testing.T) {
+	now := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	sq, err := parseAlertStatsQuery(url.Values{}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sq.Bucket != "1h" || sq.Top != defaultStatsTop {
+		t.Errorf("unexpected defaults: %+v", sq)
+	}
+	if !sq.Until.Equal(now) || !sq.Since.Equal(now.Add(-defaultStatsWindow)) {
+		t.Errorf("unexpected window: %s - %s", sq.Since, sq.Until)
+	}
+
+	sq, err = parseAlertStatsQuery(url.Values{"symbol": {"btcusdt"}, "rule_type": {"futures_top_hunter"}}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	where, args := sq.whereClause()
+	if !strings.Contains(where, "created_at >= $1") || !strings.Contains(where, "symbol = ANY($3)") || !strings.Contains(where, "rule_type = ANY($4)") {
+		t.Errorf("unexpected where clause: %s", where)
+	}
+	if len(args) != 4 {
+		t.Errorf("args = %d, want 4", len(args))
+	}
+
+	where, args = sq.whereClause([]string{"bull"}, []string{"bear"})
+	if !strings.Contains(where, "created_at >= $3") || !strings.Contains(where, "rule_type = ANY($6)") {
+		t.Errorf("unexpected where clause with leading args: %s", where)
+	}
+	if len(args) != 6 {
+		t.Errorf("args = %d, want 6", len(args))
+	}
+
+	for _, bad := range []string{
+		"bucket=1w",
+		"since=2026-02-02T00:00:00Z",
+		"since=2025-01-01T00:00:00Z",
+		"bucket=5m&since=2026-01-15T00:00:00Z",
+		"until=tomorrow",
+	} {
+		q, _ := url.ParseQuery(bad)
+		if _, err := parseAlertStatsQuery(q, now); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestBullBearRatio(t *testing.T) {
+	if got := bullBearRatio(6, 3); got == nil || *got != 2 {
+		t.Errorf("ratio = %v, want 2", got)
+	}
+	if got := bullBearRatio(4, 0); got != nil {
+		t.Errorf("ratio without bears = %f, want nil", *got)
+	}
+
+	// Without bearish alerts the field is left out rather than a made-up number
+	out, err := json.Marshal(symbolCount{Symbol: "BTCUSDT", Count: 4, Bullish: 4, Ratio: bullBearRatio(4, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "bull_bear_ratio") {
+		t.Errorf("encoded %s, want no bull_bear_ratio", out)
+	}
+}
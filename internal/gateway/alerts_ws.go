@@ -0,0 +1,308 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+)
+
+const alertsSubject = alerts.AlertsSubject
+
+// alertReplay describes where a (re)connecting client wants the alert feed to
+// start. The zero value means live alerts only.
+type alertReplay struct {
+	// SinceSeq is the last ALERTS stream sequence the client has seen
+	SinceSeq uint64
+	// LastID is the ID of the last alert the client has seen, live or from
+	// /api/alerts, which returns the same IDs
+	LastID string
+}
+
+// alertFrame is a single alert pushed to a client, tagged with its ALERTS
+// stream sequence so the client can resume with ?since_seq=
+type alertFrame struct {
+	alerts.Alert
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// parseAlertReplay reads the resume parameters of an alert stream request
+func parseAlertReplay(q url.Values) (alertReplay, error) {
+	var rp alertReplay
+	if raw := strings.TrimSpace(q.Get("since_seq")); raw != "" {
+		seq, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return rp, fmt.Errorf("since_seq must be a positive integer")
+		}
+		rp.SinceSeq = seq
+	}
+	rp.LastID = strings.TrimSpace(q.Get("last_id"))
+	if rp.SinceSeq > 0 && rp.LastID != "" {
+		return rp, fmt.Errorf("since_seq and last_id are mutually exclusive")
+	}
+	return rp, nil
+}
+
+// alertFilter restricts a stream to the requested symbols and rule types.
+// Empty sets match everything.
+type alertFilter struct {
+	symbols   map[string]struct{}
+	ruleTypes map[string]struct{}
+}
+
+// parseAlertFilter reads the symbol and rule_type parameters shared by the
+// alert WebSocket and SSE endpoints
+func parseAlertFilter(q url.Values) alertFilter {
+	return alertFilter{
+		symbols:   toSet(splitMultiValue(q["symbol"], strings.ToUpper)),
+		ruleTypes: toSet(splitMultiValue(q["rule_type"], nil)),
+	}
+}
+
+func (f alertFilter) match(a *alerts.Alert) bool {
+	if len(f.symbols) > 0 {
+		if _, ok := f.symbols[a.Symbol]; !ok {
+			return false
+		}
+	}
+	if len(f.ruleTypes) > 0 {
+		if _, ok := f.ruleTypes[a.RuleType]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func toSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+// alertResumer drops replayed alerts up to and including the client's last
+// seen alert ID. If the ID is no longer retained, everything replayed is kept.
+type alertResumer struct {
+	lastID string
+	found  bool
+	held   []alertFrame
+}
+
+func newAlertResumer(lastID string) *alertResumer {
+	return &alertResumer{lastID: lastID, found: lastID == ""}
+}
+
+// push accepts the next frame from the stream along with the number of
+// messages still pending, and returns the frames that are ready to send
+func (r *alertResumer) push(f alertFrame, pending uint64) []alertFrame {
+	if r.found {
+		return []alertFrame{f}
+	}
+	if f.ID == r.lastID {
+		r.found = true
+		r.held = nil
+		return nil
+	}
+	r.held = append(r.held, f)
+	if pending == 0 {
+		// Caught up without seeing the ID: it expired, so replay all we have
+		r.found = true
+		out := r.held
+		r.held = nil
+		return out
+	}
+	return nil
+}
+
+// alertFeed is one client's source of alert messages: an ordered consumer on
+// the ALERTS stream, which can replay, or a live-only bus listener
+type alertFeed struct {
+	sub  *nats.Subscription
+	live <-chan *messaging.Msg
+	stop messaging.Subscription
+}
+
+// subscribeAlerts creates an ephemeral ordered consumer on the ALERTS stream
+// positioned according to rp. Falls back to a live bus listener when there is
+// no NATS connection or the stream is unavailable, in which case frames carry
+// no sequence.
+func (s *Server) subscribeAlerts(ctx context.Context, rp alertReplay) (*alertFeed, error) {
+	if s.js != nil {
+		opts := []nats.SubOpt{nats.OrderedConsumer()}
+		switch {
+		case rp.SinceSeq > 0:
+			opts = append(opts, nats.StartSequence(rp.SinceSeq+1))
+		case rp.LastID != "":
+			opts = append(opts, nats.DeliverAll())
+		default:
+			opts = append(opts, nats.DeliverNew())
+		}
+
+		sub, err := s.js.SubscribeSync(alertsSubject, opts...)
+		if err == nil {
+			return &alertFeed{sub: sub}, nil
+		}
+		s.logger.WithField("error", err.Error()).Warn("ALERTS stream consumer unavailable, falling back to live-only alerts")
+	}
+
+	live, sub, err := s.listen(ctx, alertsSubject)
+	if err != nil {
+		return nil, err
+	}
+	return &alertFeed{live: live, stop: sub}, nil
+}
+
+// next waits for the next alert message and returns its payload, its stream
+// sequence and the number of messages still pending. Live feeds report zero
+// for both.
+func (f *alertFeed) next(ctx context.Context) ([]byte, uint64, uint64, error) {
+	if f.sub == nil {
+		select {
+		case msg := <-f.live:
+			return msg.Data, 0, 0, nil
+		case <-ctx.Done():
+			return nil, 0, 0, ctx.Err()
+		}
+	}
+
+	msg, err := f.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		return msg.Data, 0, 0, nil
+	}
+	return msg.Data, meta.Sequence.Stream, meta.NumPending, nil
+}
+
+func (f *alertFeed) close() {
+	if f.sub != nil {
+		_ = f.sub.Unsubscribe()
+	}
+	if f.stop != nil {
+		_ = f.stop.Unsubscribe()
+	}
+}
+
+// streamAlerts reads alerts from feed until ctx ends or emit fails, applying
+// the resume position and filter before handing each frame to emit
+func (s *Server) streamAlerts(ctx context.Context, feed *alertFeed, rp alertReplay, filter alertFilter, emit func(alertFrame) error) error {
+	resumer := newAlertResumer(rp.LastID)
+	for {
+		data, seq, pending, err := feed.next(ctx)
+		if err != nil {
+			return err
+		}
+		frame := alertFrame{Seq: seq}
+		if err := json.Unmarshal(data, &frame.Alert); err != nil {
+			s.logger.Error("failed to decode alert frame", err)
+			continue
+		}
+
+		for _, f := range resumer.push(frame, pending) {
+			if !filter.match(&f.Alert) {
+				continue
+			}
+			if err := emit(f); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) handleAlertsWS(w http.ResponseWriter, r *http.Request) {
+	rp, err := parseAlertReplay(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	filter := parseAlertFilter(r.URL.Query())
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("websocket upgrade failed", err)
+		return
+	}
+
+	const pongWait = 30 * time.Second
+	const pingPeriod = 20 * time.Second
+	const writeWait = 10 * time.Second
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	feed, err := s.subscribeAlerts(ctx, rp)
+	if err != nil {
+		s.logger.Error("alert subscribe failed", err)
+		_ = conn.Close()
+		return
+	}
+	defer feed.close()
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	var writeMu sync.Mutex
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	go func() {
+		for {
+			select {
+			case <-pingTicker.C:
+				writeMu.Lock()
+				_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+				_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(writeWait))
+				writeMu.Unlock()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Read pump to detect client disconnects and handle pong frames
+	// This goroutine must exist for SetPongHandler to work
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			// Client sent a message (could be keepalive JSON) - reset deadline
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+		}
+	}()
+
+	err = s.streamAlerts(ctx, feed, rp, filter, func(f alertFrame) error {
+		payload, err := json.Marshal(f)
+		if err != nil {
+			return nil
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteMessage(websocket.TextMessage, payload)
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.WithField("error", err.Error()).Debug("alert websocket closed")
+	}
+
+	_ = conn.Close()
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+)
+
+func TestParseAlertReplay(t *testing.T) {
+	rp, err := parseAlertReplay(url.Values{"since_seq": {"42"}})
+	if err != nil || rp.SinceSeq != 42 {
+		t.Fatalf("since_seq: got %+v, err %v", rp, err)
+	}
+
+	rp, err = parseAlertReplay(url.Values{"last_id": {"abc"}})
+	if err != nil || rp.LastID != "abc" {
+		t.Fatalf("last_id: got %+v, err %v", rp, err)
+	}
+
+	for _, bad := range []url.Values{
+		{"since_seq": {"-1"}},
+		{"since_seq": {"ten"}},
+		{"since_seq": {"3"}, "last_id": {"abc"}},
+	} {
+		if _, err := parseAlertReplay(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func frame(id string, seq uint64) alertFrame {
+	return alertFrame{Alert: alerts.Alert{ID: id}, Seq: seq}
+}
+
+func TestAlertResumerSkipsUntilLastID(t *testing.T) {
+	r := newAlertResumer("b")
+
+	if out := r.push(frame("a", 1), 3); len(out) != 0 {
+		t.Fatalf("expected frame before last ID to be held, got %v", out)
+	}
+	if out := r.push(frame("b", 2), 2); len(out) != 0 {
+		t.Fatalf("expected last ID itself to be dropped, got %v", out)
+	}
+	out := r.push(frame("c", 3), 1)
+	if len(out) != 1 || out[0].ID != "c" {
+		t.Fatalf("expected frame after last ID, got %v", out)
+	}
+}
+
+func TestAlertResumerReplaysAllWhenIDExpired(t *testing.T) {
+	r := newAlertResumer("gone")
+
+	r.push(frame("a", 10), 1)
+	out := r.push(frame("b", 11), 0)
+	if len(out) != 2 || out[0].ID != "a" || out[1].ID != "b" {
+		t.Fatalf("expected held frames to be replayed, got %v", out)
+	}
+	if out := r.push(frame("c", 12), 0); len(out) != 1 {
+		t.Fatalf("expected live frame to pass through, got %v", out)
+	}
+}
+
+func TestAlertFrameJSON(t *testing.T) {
+	payload, err := json.Marshal(frame("x", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["id"] != "x" || got["seq"] != float64(7) {
+		t.Fatalf("unexpected frame JSON: %s", payload)
+	}
+}
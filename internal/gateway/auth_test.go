@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+)
+
+const testSecret = "jwt-signing-key"
+
+// signToken creates an HS256 token with the given claims
+func signToken(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	valid := map[string]interface{}{"sub": "user-1", "email": "ops@example.com", "role": "authenticated", "exp": now.Add(time.Hour).Unix()}
+
+	c, err := verifyToken(signToken(t, testSecret, valid), testSecret, now)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if c.Subject != "user-1" || c.actor() != "ops@example.com" || c.hasRole("admin") {
+		t.Fatalf("claims = %+v", c)
+	}
+
+	if _, err := verifyToken(signToken(t, "other-secret", valid), testSecret, now); err == nil {
+		t.Error("accepted a token signed with another secret")
+	}
+	if _, err := verifyToken(signToken(t, testSecret, valid), testSecret, now.Add(2*time.Hour)); err == nil {
+		t.Error("accepted an expired token")
+	}
+	noExp := map[string]interface{}{"sub": "user-1"}
+	if _, err := verifyToken(signToken(t, testSecret, noExp), testSecret, now); err == nil {
+		t.Error("accepted a token without exp")
+	}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","role":"admin"}`)) + "."
+	if _, err := verifyToken(none, testSecret, now); err == nil {
+		t.Error("accepted an unsigned token")
+	}
+}
+
+func TestAuthAdmin(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	admin := signToken(t, testSecret, map[string]interface{}{"sub": "a", "exp": exp, "app_metadata": map[string]interface{}{"roles": []string{"admin"}}})
+	user := signToken(t, testSecret, map[string]interface{}{"sub": "u", "exp": exp, "role": "authenticated",
+		"user_metadata": map[string]interface{}{"role": "admin"}})
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+		want   int
+	}{
+		{"admin", testSecret, admin, http.StatusOK},
+		{"no token", testSecret, "", http.StatusUnauthorized},
+		{"bad token", testSecret, "abc.def.ghi", http.StatusUnauthorized},
+		{"not admin", testSecret, user, http.StatusForbidden},
+		{"no secret", "", admin, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{logger: observability.NewLogger("test", observability.LevelInfo), authSecret: tt.secret, adminRole: "admin"}
+			var got *claims
+			handler := s.authAdmin(func(w http.ResponseWriter, r *http.Request) {
+				got = claimsFrom(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/rules", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK && (got == nil || got.Subject != "a") {
+				t.Fatalf("claims = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCandlesWindow = 24 * time.Hour
+	// maxCandlePoints bounds the candles of one response. The finest
+	// resolution that covers the window within it is served.
+	maxCandlePoints = 1500
+)
+
+// candleResolution is one tier of stored candles
+type candleResolution struct {
+	Name      string
+	Table     string
+	Width     time.Duration
+	Retention time.Duration // 0 keeps candles indefinitely
+}
+
+// candleResolutions lists the tiers finest first. Retentions mirror the
+// policies in pkg/database/migrations.
+var candleResolutions = []candleResolution{
+	{"1m", "candles_1m", time.Minute, candleRetention},
+	{"5m", "candles_5m", 5 * time.Minute, 90 * 24 * time.Hour},
+	{"1h", "candles_1h", time.Hour, 2 * 365 * 24 * time.Hour},
+	{"1d", "candles_1d", 24 * time.Hour, 0},
+}
+
+// pickResolution returns the finest resolution that still holds candles from
+// since and has at most maxCandlePoints of them in [since, until)
+func pickResolution(since, until, now time.Time) (candleResolution, error) {
+	for _, res := range candleResolutions {
+		if res.Retention > 0 && since.Before(now.Add(-res.Retention)) {
+			continue
+		}
+		if until.Sub(since)/res.Width <= maxCandlePoints {
+			return res, nil
+		}
+	}
+	return candleResolution{}, fmt.Errorf("window must not exceed %d days", maxCandlePoints)
+}
+
+// candleQuery holds the parsed parameters of a /api/candles request
+type candleQuery struct {
+	Symbol     string
+	Since      time.Time
+	Until      time.Time
+	Resolution candleResolution
+}
+
+type candle struct {
+	Time        time.Time `json:"time"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	Volume      float64   `json:"volume"`
+	QuoteVolume float64   `json:"quote_volume"`
+	Trades      int64     `json:"trades"`
+}
+
+type candlesResponse struct {
+	Symbol     string    `json:"symbol"`
+	Resolution string    `json:"resolution"`
+	Since      time.Time `json:"since"`
+	Until      time.Time `json:"until"`
+	Candles    []candle  `json:"candles"`
+}
+
+// parseCandleQuery validates the query string of a /api/candles request.
+// The window defaults to the last 24 hours ending now.
+func parseCandleQuery(q url.Values, now time.Time) (candleQuery, error) {
+	cq := candleQuery{
+		Symbol: strings.ToUpper(strings.TrimSpace(q.Get("symbol"))),
+		Until:  now,
+	}
+	if cq.Symbol == "" {
+		return cq, fmt.Errorf("symbol is required")
+	}
+	if raw := strings.TrimSpace(q.Get("until")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return cq, fmt.Errorf("until must be an RFC3339 timestamp")
+		}
+		cq.Until = t
+	}
+	cq.Since = cq.Until.Add(-defaultCandlesWindow)
+	if raw := strings.TrimSpace(q.Get("since")); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return cq, fmt.Errorf("since must be an RFC3339 timestamp")
+		}
+		cq.Since = t
+	}
+	if !cq.Until.After(cq.Since) {
+		return cq, fmt.Errorf("until must be after since")
+	}
+
+	res, err := pickResolution(cq.Since, cq.Until, now)
+	if err != nil {
+		return cq, err
+	}
+	cq.Resolution = res
+	return cq, nil
+}
+
+// queryCandles reads cq's window from the table of its resolution
+func (s *Server) queryCandles(ctx context.Context, cq candleQuery) ([]candle, error) {
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		SELECT time, open, high, low, close, volume, quote_volume, trades
+		FROM %s
+		WHERE symbol = $1 AND time >= $2 AND time < $3
+		ORDER BY time`, cq.Resolution.Table), cq.Symbol, cq.Since, cq.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := []candle{}
+	for rows.Next() {
+		var c candle
+		if err := rows.Scan(&c.Time, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.QuoteVolume, &c.Trades); err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	return candles, rows.Err()
+}
+
+// handleCandles serves stored candles of one symbol between since and until,
+// at the finest resolution kept that long and fitting in one response:
+// candles_1m for the last 48 hours, then the 5m, 1h and 1d aggregates
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	cq, err := parseCandleQuery(r.URL.Query(), time.Now().UTC())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	candles, err := s.queryCandles(ctx, cq)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, candlesResponse{
+		Symbol:     cq.Symbol,
+		Resolution: cq.Resolution.Name,
+		Since:      cq.Since,
+		Until:      cq.Until,
+		Candles:    candles,
+	})
+}
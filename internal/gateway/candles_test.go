@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPickResolution(t *testing.T) {
+	now := time.Date(2026, 2, 4, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	for _, tc := range []struct {
+		since, until time.Time
+		want         string
+	}{
+		{now.Add(-6 * time.Hour), now, "1m"},
+		{now.Add(-24 * time.Hour), now, "1m"},
+		// Inside the 1m retention, but more than maxCandlePoints minutes
+		{now.Add(-40 * time.Hour), now, "5m"},
+		// A short window from before the 1m retention
+		{now.Add(-72 * time.Hour), now.Add(-71 * time.Hour), "5m"},
+		{now.Add(-30 * day), now, "1h"},
+		{now.Add(-100 * day), now.Add(-99 * day), "1h"},
+		{now.Add(-365 * day), now, "1d"},
+		{now.Add(-3 * 365 * day), now.Add(-3*365*day + time.Hour), "1d"},
+	} {
+		res, err := pickResolution(tc.since, tc.until, now)
+		if err != nil {
+			t.Errorf("%s - %s: %v", tc.since, tc.until, err)
+			continue
+		}
+		if res.Name != tc.want {
+			t.Errorf("%s - %s: resolution %s, want %s", tc.since, tc.until, res.Name, tc.want)
+		}
+	}
+
+	if _, err := pickResolution(now.Add(-5*365*day), now, now); err == nil {
+		t.Error("expected an error for a window of more than maxCandlePoints days")
+	}
+}
+
+func TestParseCandleQuery(t *testing.T) {
+	now := time.Date(2026, 2, 4, 12, 0, 0, 0, time.UTC)
+
+	cq, err := parseCandleQuery(url.Values{"symbol": {"btcusdt"}}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cq.Symbol != "BTCUSDT" || !cq.Until.Equal(now) || !cq.Since.Equal(now.Add(-defaultCandlesWindow)) || cq.Resolution.Name != "1m" {
+		t.Errorf("unexpected query: %+v", cq)
+	}
+
+	cq, err = parseCandleQuery(url.Values{"symbol": {"ETHUSDT"}, "since": {"2025-11-01T00:00:00Z"}, "until": {"2026-01-01T00:00:00Z"}}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cq.Resolution.Table != "candles_1h" {
+		t.Errorf("two months served from %s, want candles_1h", cq.Resolution.Table)
+	}
+
+	for _, bad := range []string{
+		"since=2026-02-01T00:00:00Z",
+		"symbol=BTCUSDT&since=yesterday",
+		"symbol=BTCUSDT&since=2026-02-02T00:00:00Z&until=2026-02-01T00:00:00Z",
+	} {
+		q, _ := url.ParseQuery(bad)
+		if _, err := parseCandleQuery(q, now); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package gateway
 
 import (
 	"context"
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
 	"github.com/gorilla/websocket"
 )
 
@@ -30,7 +32,7 @@ func TestAlertsGatewayRESTAndWS(t *testing.T) {
 
 	// Prepare test alert payload
 	alert := alerts.Alert{
-		ID:          "test-alert-1",
+		ID:          "2b1e6c1a-5f0d-4a4f-8e3b-7c9d0a1f2e34",
 		Symbol:      "TESTUSDT",
 		RuleType:    "test_rule",
 		Description: "test alert description",
@@ -44,16 +46,16 @@ func TestAlertsGatewayRESTAndWS(t *testing.T) {
 		},
 	}
 
-	srv, err := bootstrap(ctx)
+	srv, err := Connect(ctx, testConfig(t), observability.NewLogger("api-gateway-test", observability.LevelInfo))
 	if err != nil {
-		t.Fatalf("bootstrap failed: %v", err)
+		t.Fatalf("Connect failed: %v", err)
 	}
-	defer srv.shutdown()
+	defer srv.Shutdown()
 
 	// Insert alert into alert_history for REST path
-	insert := `INSERT INTO alert_history (time, symbol, rule_type, description, price, metadata) VALUES ($1,$2,$3,$4,$5,$6)`
+	insert := `INSERT INTO alert_history (created_at, symbol, rule_type, message, price, metadata, alert_id) VALUES ($1,$2,$3,$4,$5,$6,$7)`
 	metaJSON, _ := json.Marshal(alert.Metadata)
-	if _, err := srv.db.Exec(ctx, insert, alert.Timestamp, alert.Symbol, alert.RuleType, alert.Description, alert.Price, metaJSON); err != nil {
+	if _, err := srv.db.Exec(ctx, insert, alert.Timestamp, alert.Symbol, alert.RuleType, alert.Description, alert.Price, metaJSON, alert.ID); err != nil {
 		t.Fatalf("failed to insert alert_history: %v", err)
 	}
 	t.Cleanup(func() {
@@ -61,7 +63,7 @@ func TestAlertsGatewayRESTAndWS(t *testing.T) {
 	})
 
 	// Start HTTP test server
-	ts := httptest.NewServer(srv.routes())
+	ts := httptest.NewServer(srv.Routes())
 	defer ts.Close()
 
 	// REST: fetch alerts
@@ -81,6 +83,10 @@ func TestAlertsGatewayRESTAndWS(t *testing.T) {
 	if len(got) == 0 {
 		t.Fatalf("expected at least one alert in REST response")
 	}
+	// History carries the engine's alert ID, which WebSocket clients also see
+	if got[0].ID != alert.ID {
+		t.Fatalf("REST alert ID = %q, want %q", got[0].ID, alert.ID)
+	}
 
 	// WS: connect and receive the published alert
 	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/alerts"
@@ -108,4 +114,14 @@ func TestAlertsGatewayRESTAndWS(t *testing.T) {
 	if wsAlert.ID != alert.ID || wsAlert.Symbol != alert.Symbol || wsAlert.RuleType != alert.RuleType {
 		t.Fatalf("unexpected WS alert: %+v", wsAlert)
 	}
-}
\ No newline at end of file
+}
+
+// testConfig loads the gateway defaults with environment overrides
+func testConfig(t *testing.T) *config.APIGateway {
+	t.Helper()
+	cfg := config.DefaultAPIGateway()
+	if err := config.LoadFile("", cfg); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,428 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKlinesLimit = 500
+	maxKlinesLimit     = 1500
+
+	// candleRetention mirrors the candles_1m retention policy in pkg/database/migrations.
+	// Older ranges are only available from Binance.
+	candleRetention = 48 * time.Hour
+
+	binanceKlinesURL = "https://fapi.binance.com/fapi/v1/klines"
+
+	// klinesSourceHeader reports whether a response came from local, binance or mixed data
+	klinesSourceHeader = "X-Klines-Source"
+
+	// klineCacheSize bounds the number of cached historical Binance responses
+	klineCacheSize = 1000
+	klineCacheTTL  = 24 * time.Hour
+)
+
+// klineIntervals maps each Binance interval to its width and the time_bucket
+// interval used to resample candles_1m. Monthly candles have no fixed width
+// and are always fetched from Binance.
+var klineIntervals = map[string]struct {
+	width  time.Duration
+	bucket string
+}{
+	"1m":  {time.Minute, "1 minute"},
+	"3m":  {3 * time.Minute, "3 minutes"},
+	"5m":  {5 * time.Minute, "5 minutes"},
+	"15m": {15 * time.Minute, "15 minutes"},
+	"30m": {30 * time.Minute, "30 minutes"},
+	"1h":  {time.Hour, "1 hour"},
+	"2h":  {2 * time.Hour, "2 hours"},
+	"4h":  {4 * time.Hour, "4 hours"},
+	"6h":  {6 * time.Hour, "6 hours"},
+	"8h":  {8 * time.Hour, "8 hours"},
+	"12h": {12 * time.Hour, "12 hours"},
+	"1d":  {24 * time.Hour, "1 day"},
+	"3d":  {72 * time.Hour, "3 days"},
+	"1w":  {7 * 24 * time.Hour, "7 days"},
+	"1M":  {},
+}
+
+// bucketOrigin is time_bucket's default origin, a Monday, so weekly buckets
+// line up with Binance's Monday-based weeks
+var bucketOrigin = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+
+// klineRequest is a parsed /api/klines request resolved to a window of whole
+// buckets [Start, End). FromStart is set when the client passed startTime, in
+// which case Binance returns the first limit candles instead of the last.
+type klineRequest struct {
+	Symbol    string
+	Interval  string
+	Limit     int
+	Width     time.Duration
+	Bucket    string
+	Start     time.Time
+	End       time.Time
+	FromStart bool
+	// Raw start/end in milliseconds, forwarded as-is when proxying monthly candles
+	StartMs string
+	EndMs   string
+}
+
+// alignBucket returns the start of the bucket containing t
+func alignBucket(t time.Time, width time.Duration) time.Time {
+	return bucketOrigin.Add(t.Sub(bucketOrigin) / width * width)
+}
+
+func parseMillis(raw string) (time.Time, error) {
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ms < 0 {
+		return time.Time{}, fmt.Errorf("must be a millisecond timestamp")
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// parseKlineRequest validates the Binance-compatible query parameters symbol,
+// interval, limit, startTime and endTime
+func parseKlineRequest(q url.Values, now time.Time) (klineRequest, error) {
+	kr := klineRequest{
+		Symbol:   strings.ToUpper(strings.TrimSpace(q.Get("symbol"))),
+		Interval: strings.TrimSpace(q.Get("interval")),
+		Limit:    clamp(toInt(q.Get("limit"), defaultKlinesLimit), 1, maxKlinesLimit),
+		StartMs:  strings.TrimSpace(q.Get("startTime")),
+		EndMs:    strings.TrimSpace(q.Get("endTime")),
+	}
+	if kr.Symbol == "" {
+		return kr, fmt.Errorf("symbol is required")
+	}
+	if kr.Interval == "" || !isValidKlineInterval(kr.Interval) {
+		return kr, fmt.Errorf("invalid interval")
+	}
+	iv := klineIntervals[kr.Interval]
+	kr.Width, kr.Bucket = iv.width, iv.bucket
+
+	var start, end time.Time
+	if kr.StartMs != "" {
+		t, err := parseMillis(kr.StartMs)
+		if err != nil {
+			return kr, fmt.Errorf("startTime %v", err)
+		}
+		start = t
+	}
+	end = now
+	if kr.EndMs != "" {
+		t, err := parseMillis(kr.EndMs)
+		if err != nil {
+			return kr, fmt.Errorf("endTime %v", err)
+		}
+		end = t
+	}
+	if kr.StartMs != "" && end.Before(start) {
+		return kr, fmt.Errorf("endTime must not be before startTime")
+	}
+	if kr.Width == 0 {
+		return kr, nil
+	}
+
+	// Resolve to whole buckets. Binance returns candles whose open time falls
+	// inside [startTime, endTime], so a partial first bucket is skipped.
+	last := alignBucket(end, kr.Width)
+	if kr.StartMs != "" {
+		kr.FromStart = true
+		kr.Start = alignBucket(start, kr.Width)
+		if kr.Start.Before(start) {
+			kr.Start = kr.Start.Add(kr.Width)
+		}
+		kr.End = last.Add(kr.Width)
+		if max := kr.Start.Add(time.Duration(kr.Limit) * kr.Width); kr.End.After(max) {
+			kr.End = max
+		}
+	} else {
+		kr.End = last.Add(kr.Width)
+		kr.Start = kr.End.Add(-time.Duration(kr.Limit) * kr.Width)
+	}
+	return kr, nil
+}
+
+// localCutoff is the first bucket boundary from which candles_1m is guaranteed
+// to hold complete data
+func (kr klineRequest) localCutoff(now time.Time) time.Time {
+	oldest := now.Add(-candleRetention)
+	cutoff := alignBucket(oldest, kr.Width)
+	if cutoff.Before(oldest) {
+		cutoff = cutoff.Add(kr.Width)
+	}
+	return cutoff
+}
+
+// formatKline renders a candle in Binance's array format. candles_1m does not
+// store taker buy volumes, so those fields are "0".
+func formatKline(open time.Time, width time.Duration, o, h, l, c, volume, quoteVolume float64, trades int64) []interface{} {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []interface{}{
+		open.UnixMilli(),
+		f(o), f(h), f(l), f(c), f(volume),
+		open.Add(width).UnixMilli() - 1,
+		f(quoteVolume),
+		trades,
+		"0", "0", "0",
+	}
+}
+
+// queryLocalKlines resamples candles_1m into kr's buckets within [from, to)
+func (s *Server) queryLocalKlines(ctx context.Context, kr klineRequest, from, to time.Time) ([]interface{}, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT time_bucket($1::interval, time) AS bucket,
+			first(open, time), MAX(high), MIN(low), last(close, time),
+			SUM(volume), SUM(quote_volume), SUM(trades)
+		FROM candles_1m
+		WHERE symbol = $2 AND time >= $3 AND time < $4
+		GROUP BY bucket
+		ORDER BY bucket`, kr.Bucket, kr.Symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	klines := []interface{}{}
+	for rows.Next() {
+		var bucket time.Time
+		var o, h, l, c, volume, quoteVolume float64
+		var trades int64
+		if err := rows.Scan(&bucket, &o, &h, &l, &c, &volume, &quoteVolume, &trades); err != nil {
+			return nil, err
+		}
+		klines = append(klines, formatKline(bucket, kr.Width, o, h, l, c, volume, quoteVolume, trades))
+	}
+	return klines, rows.Err()
+}
+
+// binanceError carries a non-200 upstream response so it can be relayed as-is
+type binanceError struct {
+	status int
+	body   []byte
+}
+
+func (e *binanceError) Error() string {
+	return fmt.Sprintf("binance returned %d", e.status)
+}
+
+// cacheKey identifies the client request a historical Binance response is
+// cached for. Without startTime the window rolls forward with the clock, so
+// only the times the client sent are part of the key.
+func (kr klineRequest) cacheKey() string {
+	q := url.Values{}
+	q.Set("symbol", kr.Symbol)
+	q.Set("interval", kr.Interval)
+	q.Set("limit", strconv.Itoa(kr.Limit))
+	if kr.StartMs != "" {
+		q.Set("startTime", kr.StartMs)
+	}
+	if kr.EndMs != "" {
+		q.Set("endTime", kr.EndMs)
+	}
+	return q.Encode()
+}
+
+// fetchBinanceKlines requests klines from Binance. Responses are cached under
+// cacheKey when it is set, which callers only do for closed historical ranges.
+func (s *Server) fetchBinanceKlines(ctx context.Context, params url.Values, cacheKey string) ([]interface{}, error) {
+	query := params.Encode()
+	if cacheKey != "" {
+		if klines, ok := s.klineCache.get(cacheKey, query); ok {
+			return klines, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, binanceKlinesURL+"?"+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &binanceError{status: resp.StatusCode, body: body}
+	}
+
+	var rows []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, err
+	}
+	klines := make([]interface{}, len(rows))
+	for i, row := range rows {
+		klines[i] = row
+	}
+	if cacheKey != "" {
+		s.klineCache.set(cacheKey, query, klines)
+	}
+	return klines, nil
+}
+
+// handleKlines serves Binance-compatible klines. Ranges inside the candles_1m
+// retention are resampled locally; only older ranges, monthly candles and
+// symbols we do not collect are fetched from Binance.
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	kr, err := parseKlineRequest(r.URL.Query(), now)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("symbol", kr.Symbol)
+	params.Set("interval", kr.Interval)
+
+	var klines []interface{}
+	var source string
+	if kr.Width == 0 {
+		// Monthly candles: forward the request unchanged
+		params.Set("limit", strconv.Itoa(kr.Limit))
+		if kr.StartMs != "" {
+			params.Set("startTime", kr.StartMs)
+		}
+		if kr.EndMs != "" {
+			params.Set("endTime", kr.EndMs)
+		}
+		source = "binance"
+		klines, err = s.fetchBinanceKlines(ctx, params, "")
+	} else {
+		klines, source, err = s.resolveKlines(ctx, kr, now, params)
+	}
+
+	if err != nil {
+		var upstream *binanceError
+		if errors.As(err, &upstream) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(upstream.status)
+			_, _ = w.Write(upstream.body)
+			return
+		}
+		s.writeError(w, http.StatusBadGateway, "klines_failed", err.Error())
+		return
+	}
+
+	if len(klines) > kr.Limit {
+		if kr.FromStart {
+			klines = klines[:kr.Limit]
+		} else {
+			klines = klines[len(klines)-kr.Limit:]
+		}
+	}
+	if klines == nil {
+		klines = []interface{}{}
+	}
+
+	w.Header().Set(klinesSourceHeader, source)
+	s.writeJSON(w, http.StatusOK, klines)
+}
+
+// resolveKlines fetches the part of kr older than the local retention from
+// Binance (cached, since those candles are closed) and resamples the rest from
+// candles_1m. It returns the klines and which source served them.
+func (s *Server) resolveKlines(ctx context.Context, kr klineRequest, now time.Time, params url.Values) ([]interface{}, string, error) {
+	var klines []interface{}
+	from := kr.Start
+	if cutoff := kr.localCutoff(now); from.Before(cutoff) {
+		to := cutoff
+		if kr.End.Before(to) {
+			to = kr.End
+		}
+		params.Set("startTime", strconv.FormatInt(kr.Start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(to.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(maxKlinesLimit))
+		historical, err := s.fetchBinanceKlines(ctx, params, kr.cacheKey())
+		if err != nil {
+			return nil, "", err
+		}
+		klines = historical
+		from = cutoff
+	}
+	if !from.Before(kr.End) {
+		return klines, "binance", nil
+	}
+
+	local, err := s.queryLocalKlines(ctx, kr, from, kr.End)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(local) == 0 && len(klines) == 0 {
+		// Not a symbol we collect: serve the whole window from Binance
+		params.Set("startTime", strconv.FormatInt(kr.Start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(kr.End.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(kr.Limit))
+		klines, err = s.fetchBinanceKlines(ctx, params, "")
+		return klines, "binance", err
+	}
+	if len(klines) > 0 {
+		return append(klines, local...), "mixed", nil
+	}
+	return local, "local", nil
+}
+
+// klineCache is a bounded in-memory cache of historical Binance klines. Closed
+// candles never change, so entries only expire to bound memory. Each entry
+// remembers the upstream query it answered: once a rolling window moves on to
+// the next bucket the query differs, and the refetched response replaces the
+// entry instead of adding one per bucket.
+type klineCache struct {
+	mu      sync.Mutex
+	entries map[string]klineCacheEntry
+}
+
+type klineCacheEntry struct {
+	query   string
+	klines  []interface{}
+	expires time.Time
+}
+
+func newKlineCache() *klineCache {
+	return &klineCache{entries: make(map[string]klineCacheEntry)}
+}
+
+func (c *klineCache) get(key, query string) ([]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.query != query || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.klines, true
+}
+
+func (c *klineCache) set(key, query string, klines []interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, replace := c.entries[key]; !replace && len(c.entries) >= klineCacheSize {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full: evict an arbitrary entry
+		for k := range c.entries {
+			if len(c.entries) < klineCacheSize {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = klineCacheEntry{query: query, klines: klines, expires: now.Add(klineCacheTTL)}
+}
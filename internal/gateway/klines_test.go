@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseKlineRequest(t *testing.T) {
+	now := time.Date(2026, 2, 4, 12, 34, 56, 0, time.UTC)
+
+	kr, err := parseKlineRequest(url.Values{"symbol": {"btcusdt"}, "interval": {"15m"}, "limit": {"4"}}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantEnd := time.Date(2026, 2, 4, 12, 45, 0, 0, time.UTC)
+	if kr.Symbol != "BTCUSDT" || !kr.End.Equal(wantEnd) || !kr.Start.Equal(wantEnd.Add(-time.Hour)) {
+		t.Errorf("unexpected window: %s - %s", kr.Start, kr.End)
+	}
+	if kr.FromStart {
+		t.Error("FromStart set without startTime")
+	}
+
+	// startTime inside a bucket skips to the next one, like Binance
+	start := time.Date(2026, 2, 4, 10, 1, 0, 0, time.UTC)
+	kr, err = parseKlineRequest(url.Values{
+		"symbol":    {"ETHUSDT"},
+		"interval":  {"1h"},
+		"limit":     {"2"},
+		"startTime": {strconv.FormatInt(start.UnixMilli(), 10)},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !kr.FromStart || !kr.Start.Equal(time.Date(2026, 2, 4, 11, 0, 0, 0, time.UTC)) || !kr.End.Equal(time.Date(2026, 2, 4, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected window: %s - %s", kr.Start, kr.End)
+	}
+
+	// Weekly buckets start on Monday
+	kr, _ = parseKlineRequest(url.Values{"symbol": {"BTCUSDT"}, "interval": {"1w"}, "limit": {"1"}}, now)
+	if kr.Start.Weekday() != time.Monday || !kr.Start.Equal(time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly bucket starts %s", kr.Start)
+	}
+
+	kr, err = parseKlineRequest(url.Values{"symbol": {"BTCUSDT"}, "interval": {"1M"}}, now)
+	if err != nil || kr.Width != 0 {
+		t.Errorf("monthly interval: width %s, err %v", kr.Width, err)
+	}
+
+	for _, bad := range []string{
+		"interval=1h",
+		"symbol=BTCUSDT&interval=2m",
+		"symbol=BTCUSDT&interval=1h&startTime=yesterday",
+		"symbol=BTCUSDT&interval=1h&startTime=2000&endTime=1000",
+	} {
+		q, _ := url.ParseQuery(bad)
+		if _, err := parseKlineRequest(q, now); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestKlineLocalCutoff(t *testing.T) {
+	now := time.Date(2026, 2, 4, 12, 34, 56, 0, time.UTC)
+	kr, _ := parseKlineRequest(url.Values{"symbol": {"BTCUSDT"}, "interval": {"4h"}, "limit": {"30"}}, now)
+
+	cutoff := kr.localCutoff(now)
+	if cutoff.Before(now.Add(-candleRetention)) {
+		t.Errorf("cutoff %s is older than retention", cutoff)
+	}
+	if !cutoff.Equal(time.Date(2026, 2, 2, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("cutoff = %s, want first whole 4h bucket inside retention", cutoff)
+	}
+	if !kr.Start.Before(cutoff) {
+		t.Errorf("30 x 4h window should reach past retention")
+	}
+}
+
+func TestFormatKline(t *testing.T) {
+	open := time.Date(2026, 2, 4, 12, 0, 0, 0, time.UTC)
+	data, err := json.Marshal(formatKline(open, time.Hour, 100.5, 101, 99.25, 100, 12.5, 1250, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[1770206400000,"100.5","101","99.25","100","12.5",1770209999999,"1250",42,"0","0","0"]`
+	if string(data) != want {
+		t.Errorf("kline = %s, want %s", data, want)
+	}
+}
+
+func TestKlineCacheEviction(t *testing.T) {
+	c := newKlineCache()
+	for i := 0; i < klineCacheSize+10; i++ {
+		c.set(strconv.Itoa(i), "q", []interface{}{i})
+	}
+	if len(c.entries) > klineCacheSize {
+		t.Errorf("cache holds %d entries, limit %d", len(c.entries), klineCacheSize)
+	}
+	if _, ok := c.get(strconv.Itoa(klineCacheSize+9), "q"); !ok {
+		t.Error("most recent entry missing")
+	}
+}
+
+func TestKlineCacheRollingWindow(t *testing.T) {
+	at := func(now time.Time, q url.Values) (klineRequest, url.Values) {
+		kr, err := parseKlineRequest(q, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The historical part resolveKlines fetches
+		params := url.Values{}
+		params.Set("startTime", strconv.FormatInt(kr.Start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(kr.localCutoff(now).UnixMilli()-1, 10))
+		return kr, params
+	}
+	now := time.Date(2026, 2, 4, 12, 34, 56, 0, time.UTC)
+	rolling := url.Values{"symbol": {"BTCUSDT"}, "interval": {"1h"}, "limit": {"100"}}
+
+	// Requests within a bucket share the key and the upstream query
+	c := newKlineCache()
+	kr, params := at(now, rolling)
+	c.set(kr.cacheKey(), params.Encode(), []interface{}{"a"})
+	kr, params = at(now.Add(10*time.Minute), rolling)
+	if _, ok := c.get(kr.cacheKey(), params.Encode()); !ok {
+		t.Fatal("miss within the same bucket")
+	}
+
+	// The next bucket keeps the key but not the query, so its response
+	// replaces the entry
+	later, laterParams := at(now.Add(time.Hour), rolling)
+	if later.cacheKey() != kr.cacheKey() {
+		t.Fatalf("key rolled: %q, then %q", kr.cacheKey(), later.cacheKey())
+	}
+	if _, ok := c.get(later.cacheKey(), laterParams.Encode()); ok {
+		t.Fatal("served the previous bucket's window")
+	}
+	c.set(later.cacheKey(), laterParams.Encode(), []interface{}{"b"})
+	if len(c.entries) != 1 {
+		t.Fatalf("cache holds %d entries, want the rolling window once", len(c.entries))
+	}
+
+	// Times the client sent are part of the key
+	fixed := url.Values{"symbol": {"BTCUSDT"}, "interval": {"1h"}, "limit": {"100"}, "startTime": {"1767225600000"}}
+	if kr, _ := at(now, fixed); kr.cacheKey() == later.cacheKey() {
+		t.Fatal("startTime not in the key")
+	}
+}
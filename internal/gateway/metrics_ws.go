@@ -0,0 +1,374 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMetricsThrottle = time.Second
+	maxMetricsThrottle     = time.Minute
+)
+
+// metricsEntry is the latest metrics message for one symbol, kept typed, as raw
+// top-level JSON fields for cheap per-client projection, and as flattened
+// numeric values for screener queries
+type metricsEntry struct {
+	Metrics calculator.SymbolMetrics
+	fields  map[string]json.RawMessage
+	values  map[string]float64
+}
+
+// metricsHub keeps the latest SymbolMetrics per symbol from metrics.calculated
+// and fans updates out to connected /ws/metrics clients
+type metricsHub struct {
+	mu      sync.RWMutex
+	latest  map[string]*metricsEntry
+	clients map[*metricsClient]struct{}
+}
+
+func newMetricsHub() *metricsHub {
+	return &metricsHub{
+		latest:  make(map[string]*metricsEntry),
+		clients: make(map[*metricsClient]struct{}),
+	}
+}
+
+// handleMsg is the bus listener for metrics.calculated
+func (h *metricsHub) handleMsg(msg *messaging.Msg) {
+	_ = h.update(msg.Data)
+}
+
+// update decodes a metrics message, stores it and offers it to every client
+func (h *metricsHub) update(data []byte) error {
+	e := &metricsEntry{}
+	if err := json.Unmarshal(data, &e.Metrics); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &e.fields); err != nil {
+		return err
+	}
+	if e.Metrics.Symbol == "" {
+		return fmt.Errorf("metrics message without symbol")
+	}
+	e.values = flattenMetricValues(e.fields)
+
+	h.mu.Lock()
+	h.latest[e.Metrics.Symbol] = e
+	clients := make([]*metricsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.offer(e)
+	}
+	return nil
+}
+
+// snapshot returns the latest entry of every symbol ordered by symbol
+func (h *metricsHub) snapshot() []*metricsEntry {
+	h.mu.RLock()
+	out := make([]*metricsEntry, 0, len(h.latest))
+	for _, e := range h.latest {
+		out = append(out, e)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Metrics.Symbol < out[j].Metrics.Symbol })
+	return out
+}
+
+func (h *metricsHub) register(c *metricsClient) {
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *metricsHub) unregister(c *metricsClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// metricsSubscription selects which symbols and fields a client receives.
+// Empty sets mean everything.
+type metricsSubscription struct {
+	Symbols []string `json:"symbols"`
+	Fields  []string `json:"fields"`
+}
+
+// metricsClient conflates updates per symbol between flushes, so a slow or
+// throttled client only ever sees the newest value for each symbol
+type metricsClient struct {
+	mu      sync.Mutex
+	symbols map[string]struct{}
+	fields  []string
+	pending map[string]*metricsEntry
+	notify  chan struct{}
+}
+
+func newMetricsClient(sub metricsSubscription) *metricsClient {
+	c := &metricsClient{
+		pending: make(map[string]*metricsEntry),
+		notify:  make(chan struct{}, 1),
+	}
+	c.setSubscription(sub)
+	return c
+}
+
+// setSubscription replaces the client's symbol and field selection and drops
+// pending updates for symbols it no longer wants
+func (c *metricsClient) setSubscription(sub metricsSubscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.symbols = toSet(splitMultiValue(sub.Symbols, strings.ToUpper))
+	c.fields = splitMultiValue(sub.Fields, strings.ToLower)
+	for symbol := range c.pending {
+		if !c.wantsLocked(symbol) {
+			delete(c.pending, symbol)
+		}
+	}
+}
+
+func (c *metricsClient) wantsLocked(symbol string) bool {
+	if len(c.symbols) == 0 {
+		return true
+	}
+	_, ok := c.symbols[symbol]
+	return ok
+}
+
+// offer queues e if the client is subscribed to its symbol, replacing any
+// update for that symbol that has not been sent yet
+func (c *metricsClient) offer(e *metricsEntry) {
+	c.mu.Lock()
+	if !c.wantsLocked(e.Metrics.Symbol) {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[e.Metrics.Symbol] = e
+	c.mu.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain returns and clears the pending updates, projected to the client's fields
+func (c *metricsClient) drain() []map[string]json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	entries := make([]*metricsEntry, 0, len(c.pending))
+	for _, e := range c.pending {
+		entries = append(entries, e)
+	}
+	c.pending = make(map[string]*metricsEntry)
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Metrics.Symbol < entries[j].Metrics.Symbol })
+	return c.projectLocked(entries)
+}
+
+// snapshot projects the given entries for this client, skipping unwanted symbols
+func (c *metricsClient) snapshot(entries []*metricsEntry) []map[string]json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wanted := make([]*metricsEntry, 0, len(entries))
+	for _, e := range entries {
+		if c.wantsLocked(e.Metrics.Symbol) {
+			wanted = append(wanted, e)
+		}
+	}
+	return c.projectLocked(wanted)
+}
+
+func (c *metricsClient) projectLocked(entries []*metricsEntry) []map[string]json.RawMessage {
+	out := make([]map[string]json.RawMessage, 0, len(entries))
+	for _, e := range entries {
+		if len(c.fields) == 0 {
+			out = append(out, e.fields)
+			continue
+		}
+		item := map[string]json.RawMessage{
+			"symbol":    e.fields["symbol"],
+			"timestamp": e.fields["timestamp"],
+		}
+		for _, f := range c.fields {
+			if v, ok := e.fields[f]; ok {
+				item[f] = v
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// metricsFrame is a message sent to /ws/metrics clients
+type metricsFrame struct {
+	Type    string                       `json:"type"`
+	Data    []map[string]json.RawMessage `json:"data,omitempty"`
+	Message string                       `json:"message,omitempty"`
+}
+
+// metricsCommand is a control message sent by /ws/metrics clients
+type metricsCommand struct {
+	Action string `json:"action"`
+	metricsSubscription
+}
+
+// parseMetricsStreamQuery reads the initial subscription and throttle interval
+// from the query string. throttle_ms=0 sends updates as soon as they arrive.
+func parseMetricsStreamQuery(q url.Values) (metricsSubscription, time.Duration, error) {
+	sub := metricsSubscription{
+		Symbols: q["symbols"],
+		Fields:  q["fields"],
+	}
+	throttle := defaultMetricsThrottle
+	if raw := strings.TrimSpace(q.Get("throttle_ms")); raw != "" {
+		ms := toInt(raw, -1)
+		if ms < 0 {
+			return sub, 0, fmt.Errorf("throttle_ms must be a non-negative integer")
+		}
+		throttle = time.Duration(ms) * time.Millisecond
+		if throttle > maxMetricsThrottle {
+			throttle = maxMetricsThrottle
+		}
+	}
+	return sub, throttle, nil
+}
+
+// handleMetricsWS relays metrics.calculated to the client. On connect, and after
+// every subscribe command, the client receives a snapshot of the latest metrics
+// for its symbols; afterwards it receives conflated updates at most once per
+// throttle interval.
+func (s *Server) handleMetricsWS(w http.ResponseWriter, r *http.Request) {
+	sub, throttle, err := parseMetricsStreamQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("websocket upgrade failed", err)
+		return
+	}
+
+	const pongWait = 30 * time.Second
+	const pingPeriod = 20 * time.Second
+	const writeWait = 10 * time.Second
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	client := newMetricsClient(sub)
+	s.metricsHub.register(client)
+	defer s.metricsHub.unregister(client)
+
+	var writeMu sync.Mutex
+	writeFrame := func(f metricsFrame) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(f)
+	}
+
+	if err := writeFrame(metricsFrame{Type: "snapshot", Data: client.snapshot(s.metricsHub.snapshot())}); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// Read pump handles subscribe commands and detects disconnects
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+
+			var cmd metricsCommand
+			if err := json.Unmarshal(data, &cmd); err != nil || cmd.Action == "" {
+				// Ignore keepalive payloads
+				continue
+			}
+			switch cmd.Action {
+			case "subscribe":
+				client.setSubscription(cmd.metricsSubscription)
+				if err := writeFrame(metricsFrame{Type: "snapshot", Data: client.snapshot(s.metricsHub.snapshot())}); err != nil {
+					return
+				}
+			default:
+				if err := writeFrame(metricsFrame{Type: "error", Message: "unknown action: " + cmd.Action}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	var flush <-chan time.Time
+	if throttle > 0 {
+		flushTicker := time.NewTicker(throttle)
+		defer flushTicker.Stop()
+		flush = flushTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			return
+		case <-pingTicker.C:
+			writeMu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(writeWait))
+			writeMu.Unlock()
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+		case <-client.notify:
+			if throttle > 0 {
+				// Wait for the next flush tick; updates keep conflating meanwhile
+				continue
+			}
+			if data := client.drain(); len(data) > 0 {
+				if err := writeFrame(metricsFrame{Type: "update", Data: data}); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		case <-flush:
+			if data := client.drain(); len(data) > 0 {
+				if err := writeFrame(metricsFrame{Type: "update", Data: data}); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMetricsHubSnapshotAndConflation(t *testing.T) {
+	hub := newMetricsHub()
+	client := newMetricsClient(metricsSubscription{Symbols: []string{"btcusdt"}, Fields: []string{"last_price"}})
+	hub.register(client)
+
+	for _, msg := range []string{
+		`{"symbol":"BTCUSDT","timestamp":"2026-02-01T12:00:00Z","last_price":100,"vcp":1.5}`,
+		`{"symbol":"ETHUSDT","timestamp":"2026-02-01T12:00:00Z","last_price":10}`,
+		`{"symbol":"BTCUSDT","timestamp":"2026-02-01T12:01:00Z","last_price":101,"vcp":1.6}`,
+	} {
+		if err := hub.update([]byte(msg)); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+	if err := hub.update([]byte(`{"last_price":1}`)); err == nil {
+		t.Error("expected error for message without symbol")
+	}
+
+	if got := len(hub.snapshot()); got != 2 {
+		t.Fatalf("hub snapshot has %d symbols, want 2", got)
+	}
+
+	select {
+	case <-client.notify:
+	default:
+		t.Fatal("client was not notified")
+	}
+
+	updates := client.drain()
+	if len(updates) != 1 {
+		t.Fatalf("got %d updates, want 1 conflated update", len(updates))
+	}
+	u := updates[0]
+	if string(u["last_price"]) != "101" {
+		t.Errorf("last_price = %s, want newest value 101", u["last_price"])
+	}
+	if _, ok := u["vcp"]; ok {
+		t.Error("unsubscribed field vcp was sent")
+	}
+	if string(u["symbol"]) != `"BTCUSDT"` || len(u["timestamp"]) == 0 {
+		t.Errorf("symbol and timestamp must always be sent: %v", u)
+	}
+	if client.drain() != nil {
+		t.Error("drain did not clear pending updates")
+	}
+
+	client.setSubscription(metricsSubscription{})
+	if got := len(client.snapshot(hub.snapshot())); got != 2 {
+		t.Errorf("snapshot for all symbols has %d entries, want 2", got)
+	}
+
+	hub.unregister(client)
+	_ = hub.update([]byte(`{"symbol":"BTCUSDT","last_price":102}`))
+	if client.drain() != nil {
+		t.Error("unregistered client received an update")
+	}
+}
+
+func TestParseMetricsStreamQuery(t *testing.T) {
+	_, throttle, err := parseMetricsStreamQuery(url.Values{})
+	if err != nil || throttle != defaultMetricsThrottle {
+		t.Errorf("default throttle = %s, err = %v", throttle, err)
+	}
+
+	_, throttle, err = parseMetricsStreamQuery(url.Values{"throttle_ms": {"0"}})
+	if err != nil || throttle != 0 {
+		t.Errorf("throttle_ms=0 gave %s, err = %v", throttle, err)
+	}
+
+	_, throttle, _ = parseMetricsStreamQuery(url.Values{"throttle_ms": {"3600000"}})
+	if throttle != maxMetricsThrottle {
+		t.Errorf("throttle = %s, want clamp to %s", throttle, maxMetricsThrottle)
+	}
+
+	if _, _, err := parseMetricsStreamQuery(url.Values{"throttle_ms": {"fast"}}); err == nil {
+		t.Error("expected error for non-numeric throttle_ms")
+	}
+
+	sub, _, _ := parseMetricsStreamQuery(url.Values{"symbols": {"btcusdt,ethusdt"}, "fields": {"vcp"}})
+	if len(sub.Symbols) != 1 || len(sub.Fields) != 1 {
+		t.Errorf("unexpected subscription: %+v", sub)
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// pipelineLagWindow is the period /api/health percentiles are computed over
+	pipelineLagWindow  = 5 * time.Minute
+	pipelineLagSamples = 10000
+)
+
+// pipelineLag tracks the current lag of the pipeline from the stamps carried
+// in message headers: for metrics, Binance event to gateway receipt; for
+// alerts, Binance event to webhook delivery, the end_to_end stage
+type pipelineLag struct {
+	metrics *observability.LatencyWindow
+	alerts  *observability.LatencyWindow
+}
+
+type lagReport struct {
+	Stage   string `json:"stage"`
+	P50Ms   int64  `json:"p50_ms"`
+	P99Ms   int64  `json:"p99_ms"`
+	Samples int    `json:"samples"`
+}
+
+func newPipelineLag() *pipelineLag {
+	return &pipelineLag{
+		metrics: observability.NewLatencyWindow(pipelineLagWindow, pipelineLagSamples),
+		alerts:  observability.NewLatencyWindow(pipelineLagWindow, pipelineLagSamples),
+	}
+}
+
+// stageLag returns the time from the Binance event to the stamp until, or to
+// now if until is empty. Messages from publishers that predate pipeline
+// stamps, or that never reached until, are not measured.
+func stageLag(h nats.Header, until string, now time.Time) (time.Duration, bool) {
+	origin, ok := messaging.Timestamp(h, messaging.HeaderBinanceEventTime)
+	if !ok {
+		return 0, false
+	}
+	end := now
+	if until != "" {
+		if end, ok = messaging.Timestamp(h, until); !ok {
+			return 0, false
+		}
+	}
+	if lag := end.Sub(origin); lag > 0 {
+		return lag, true
+	}
+	return 0, true
+}
+
+// observeReceipt records the gateway stage of a received message
+func observeReceipt(h nats.Header, now time.Time) {
+	if lag, ok := stageLag(h, "", now); ok {
+		observability.GetCollector().RecordStage(observability.StageGateway, lag)
+	}
+}
+
+func (p *pipelineLag) observeMetrics(msg *messaging.Msg) {
+	now := time.Now()
+	if lag, ok := stageLag(msg.Header, "", now); ok {
+		p.metrics.Record(now, lag)
+	}
+	observeReceipt(msg.Header, now)
+}
+
+// observeAlert records the end-to-end lag of an alert. The engine records
+// the same stage in its histogram; alerts sent without a webhook have none.
+func (p *pipelineLag) observeAlert(msg *messaging.Msg) {
+	now := time.Now()
+	if lag, ok := stageLag(msg.Header, messaging.HeaderWebhookDelivered, now); ok {
+		p.alerts.Record(now, lag)
+	}
+	observeReceipt(msg.Header, now)
+}
+
+// report returns the current p50/p99 lag of metrics and alerts
+func (p *pipelineLag) report(now time.Time) map[string]interface{} {
+	summarize := func(w *observability.LatencyWindow, stage string) lagReport {
+		qs, n := w.Quantiles(now, 0.5, 0.99)
+		return lagReport{Stage: stage, P50Ms: qs[0].Milliseconds(), P99Ms: qs[1].Milliseconds(), Samples: n}
+	}
+	return map[string]interface{}{
+		"window":  pipelineLagWindow.String(),
+		"metrics": summarize(p.metrics, observability.StageGateway),
+		"alerts":  summarize(p.alerts, observability.StageEndToEnd),
+	}
+}
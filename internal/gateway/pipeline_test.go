@@ -0,0 +1,37 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/observability"
+)
+
+func TestPipelineLagAlertsAreEndToEnd(t *testing.T) {
+	lag := newPipelineLag()
+	event := time.Now().Add(-10 * time.Second)
+
+	delivered := messaging.NewMsg(alertsSubject, nil, nil)
+	messaging.SetTimestamp(delivered.Header, messaging.HeaderBinanceEventTime, event)
+	messaging.SetTimestamp(delivered.Header, messaging.HeaderWebhookDelivered, event.Add(300*time.Millisecond))
+	lag.observeAlert(delivered)
+
+	// Without a webhook there is no end-to-end lag to report
+	undelivered := messaging.NewMsg(alertsSubject, nil, nil)
+	messaging.SetTimestamp(undelivered.Header, messaging.HeaderBinanceEventTime, event)
+	lag.observeAlert(undelivered)
+
+	metrics := messaging.NewMsg("metrics.calculated", nil, delivered.Header)
+	lag.observeMetrics(metrics)
+
+	report := lag.report(time.Now())
+	alerts := report["alerts"].(lagReport)
+	if alerts.Stage != observability.StageEndToEnd || alerts.Samples != 1 || alerts.P50Ms != 300 || alerts.P99Ms != 300 {
+		t.Fatalf("alerts lag = %+v, want one end_to_end sample of 300ms", alerts)
+	}
+	received := report["metrics"].(lagReport)
+	if received.Stage != observability.StageGateway || received.Samples != 1 || received.P50Ms < 10000 {
+		t.Fatalf("metrics lag = %+v, want one gateway sample of at least 10s", received)
+	}
+}
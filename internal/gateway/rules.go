@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+)
+
+// ruleRequest is the body of rule change requests. Every change needs a
+// reason; enable, disable and delete requests may pass it as ?reason=
+// instead of in a body.
+type ruleRequest struct {
+	RuleType    string                 `json:"rule_type"`
+	Enabled     *bool                  `json:"enabled"`
+	Config      map[string]interface{} `json:"config"`
+	Description string                 `json:"description"`
+	Reason      string                 `json:"reason"`
+	Version     int                    `json:"version"` // rollback target
+}
+
+// decodeRuleRequest reads the request body, which is optional when it may
+// carry no more than a reason
+func decodeRuleRequest(r *http.Request, optional bool) (ruleRequest, error) {
+	var req ruleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == io.EOF && optional {
+		err = nil
+	}
+	if err != nil {
+		return req, errors.New("invalid JSON body")
+	}
+	if req.Reason == "" {
+		req.Reason = r.URL.Query().Get("reason")
+	}
+	return req, nil
+}
+
+// revision attributes a change to the admin making the request
+func revision(r *http.Request, reason string) alerts.Revision {
+	rev := alerts.Revision{Reason: reason}
+	if c := claimsFrom(r.Context()); c != nil {
+		rev.Author = c.actor()
+	}
+	return rev
+}
+
+// handleAdminRules serves GET and POST /api/admin/rules
+func (s *Server) handleAdminRules(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.rules.List(ctx)
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+	case http.MethodPost:
+		req, err := decodeRuleRequest(r, false)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		rule := &alerts.AlertRule{RuleType: req.RuleType, Enabled: true, Config: req.Config, Description: req.Description}
+		if req.Enabled != nil {
+			rule.Enabled = *req.Enabled
+		}
+		created, err := s.rules.Create(ctx, rule, revision(r, req.Reason))
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.ruleChanged(r, created.RuleType, alerts.RuleCreated)
+		s.writeJSON(w, http.StatusCreated, created)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET and POST allowed")
+	}
+}
+
+// handleAdminRule serves /api/admin/rules/{rule_type} and its enable,
+// disable, history, rollback and shadow-report actions
+func (s *Server) handleAdminRule(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/rules/"), "/")
+	ruleType, action, _ := strings.Cut(path, "/")
+	if ruleType == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "rule type required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	switch action {
+	case "":
+		// The rule itself, served below
+	case "enable", "disable":
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST allowed")
+			return
+		}
+		req, err := decodeRuleRequest(r, true)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		rule, err := s.rules.SetEnabled(ctx, ruleType, action == "enable", revision(r, req.Reason))
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		if action == "enable" {
+			s.ruleChanged(r, ruleType, alerts.RuleEnabled)
+		} else {
+			s.ruleChanged(r, ruleType, alerts.RuleDisabled)
+		}
+		s.writeJSON(w, http.StatusOK, rule)
+		return
+	case "history":
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET allowed")
+			return
+		}
+		versions, err := s.rules.History(ctx, ruleType)
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{"rule_type": ruleType, "versions": versions})
+		return
+	case "shadow-report":
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET allowed")
+			return
+		}
+		since, until, err := parseReportWindow(r.URL.Query(), time.Now().UTC())
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		// Forward returns join every signal with candles
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		report, err := s.rules.ShadowReport(ctx, ruleType, since, until)
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, report)
+		return
+	case "rollback":
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST allowed")
+			return
+		}
+		req, err := decodeRuleRequest(r, false)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if req.Version <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", "version to roll back to is required")
+			return
+		}
+		rule, err := s.rules.Rollback(ctx, ruleType, req.Version, revision(r, req.Reason))
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.ruleChanged(r, ruleType, alerts.RuleRolledBack)
+		s.writeJSON(w, http.StatusOK, rule)
+		return
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "unknown rule action "+action)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.rules.Get(ctx, ruleType)
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, rule)
+	case http.MethodPut:
+		req, err := decodeRuleRequest(r, false)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if req.RuleType != "" && req.RuleType != ruleType {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", "rule_type does not match the path")
+			return
+		}
+		if req.Enabled != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", "use the enable and disable actions to change enabled")
+			return
+		}
+		rule, err := s.rules.Update(ctx, &alerts.AlertRule{RuleType: ruleType, Config: req.Config, Description: req.Description},
+			revision(r, req.Reason))
+		if err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.ruleChanged(r, ruleType, alerts.RuleUpdated)
+		s.writeJSON(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		req, err := decodeRuleRequest(r, true)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if err := s.rules.Delete(ctx, ruleType, revision(r, req.Reason)); err != nil {
+			s.writeRuleError(w, err)
+			return
+		}
+		s.ruleChanged(r, ruleType, alerts.RuleDeleted)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET, PUT and DELETE allowed")
+	}
+}
+
+const (
+	defaultReportWindow = 7 * 24 * time.Hour
+	maxReportWindow     = 31 * 24 * time.Hour
+)
+
+// parseReportWindow reads the RFC3339 since and until of a shadow report,
+// by default the last 7 days
+func parseReportWindow(q url.Values, now time.Time) (since, until time.Time, err error) {
+	until = now
+	if raw := q.Get("until"); raw != "" {
+		if until, err = time.Parse(time.RFC3339, raw); err != nil {
+			return since, until, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	since = until.Add(-defaultReportWindow)
+	if raw := q.Get("since"); raw != "" {
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			return since, until, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if !since.Before(until) {
+		return since, until, errors.New("since must be before until")
+	}
+	if until.Sub(since) > maxReportWindow {
+		return since, until, fmt.Errorf("window must not exceed %d days", int(maxReportWindow.Hours()/24))
+	}
+	return since, until, nil
+}
+
+// writeRuleError maps rule store errors to responses
+func (s *Server) writeRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, alerts.ErrInvalidRule):
+		s.writeError(w, http.StatusBadRequest, "invalid_rule", err.Error())
+	case errors.Is(err, alerts.ErrRuleNotFound), errors.Is(err, alerts.ErrVersionNotFound):
+		s.writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, alerts.ErrRuleExists):
+		s.writeError(w, http.StatusConflict, "rule_exists", err.Error())
+	case errors.Is(err, alerts.ErrRuleInUse):
+		s.writeError(w, http.StatusConflict, "rule_in_use", "users are subscribed to this rule; disable it instead")
+	default:
+		s.logger.Error("Rule query failed", err)
+		s.writeError(w, http.StatusInternalServerError, "query_failed", "failed to access alert rules")
+	}
+}
+
+// ruleChanged logs a rule change and signals alert engines to reload. The
+// change is already stored, so a failed signal is logged and engines pick it
+// up on their next start.
+func (s *Server) ruleChanged(r *http.Request, ruleType, action string) {
+	logger := s.logger.WithField("rule_type", ruleType).WithField("action", action)
+	if c := claimsFrom(r.Context()); c != nil {
+		logger = logger.WithField("actor", c.actor())
+	}
+	logger.Info("Alert rule changed")
+
+	payload, err := json.Marshal(alerts.RuleChange{RuleType: ruleType, Action: action})
+	if err != nil {
+		logger.Error("Failed to marshal rule change", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.bus.Publish(ctx, messaging.NewMsg(alerts.RulesChangedSubject, payload, nil)); err != nil {
+		logger.Error("Failed to signal rule reload", err)
+	}
+}
@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseReportWindow(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	since, until, err := parseReportWindow(url.Values{}, now)
+	if err != nil || !until.Equal(now) || !since.Equal(now.Add(-7*24*time.Hour)) {
+		t.Fatalf("default window = %s - %s, %v", since, until, err)
+	}
+
+	since, until, err = parseReportWindow(url.Values{"since": {"2026-03-01T00:00:00Z"}, "until": {"2026-03-02T00:00:00Z"}}, now)
+	if err != nil || until.Sub(since) != 24*time.Hour {
+		t.Fatalf("window = %s - %s, %v", since, until, err)
+	}
+
+	for _, q := range []url.Values{
+		{"since": {"yesterday"}},
+		{"since": {"2026-03-02T00:00:00Z"}, "until": {"2026-03-01T00:00:00Z"}},
+		{"since": {"2026-01-01T00:00:00Z"}},
+	} {
+		if _, _, err := parseReportWindow(q, now); err == nil {
+			t.Errorf("accepted %v", q)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+)
+
+const (
+	defaultScreenerLimit = 50
+	maxScreenerLimit     = 500
+)
+
+// screenerFields is the set of field names a screener query may reference.
+// Nested objects are flattened with dots, e.g. candle_1h.volume or macd.histogram.
+var screenerFields = func() map[string]struct{} {
+	data, _ := json.Marshal(calculator.SymbolMetrics{})
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(data, &fields)
+
+	set := make(map[string]struct{})
+	for name := range flattenMetricValues(fields) {
+		set[name] = struct{}{}
+	}
+	return set
+}()
+
+// flattenMetricValues collects every numeric value of a metrics message keyed
+// by its dotted JSON path
+func flattenMetricValues(fields map[string]json.RawMessage) map[string]float64 {
+	values := make(map[string]float64, len(fields))
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch t := v.(type) {
+		case float64:
+			values[prefix] = t
+		case map[string]interface{}:
+			for k, child := range t {
+				walk(prefix+"."+k, child)
+			}
+		}
+	}
+	for name, raw := range fields {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		walk(name, v)
+	}
+	return values
+}
+
+// screenerQuery is a parsed screener expression:
+//
+//	<condition> [ORDER BY <field> [ASC|DESC]] [LIMIT <n>]
+//
+// Conditions compare fields and numbers with > >= < <= = != and combine them
+// with AND, OR, NOT and parentheses. An empty condition matches every symbol.
+type screenerQuery struct {
+	Where   screenerExpr
+	OrderBy string
+	Desc    bool
+	Limit   int
+}
+
+// screenerExpr is a node of a parsed screener condition
+type screenerExpr interface {
+	eval(values map[string]float64) bool
+}
+
+type screenerAnd struct{ left, right screenerExpr }
+type screenerOr struct{ left, right screenerExpr }
+type screenerNot struct{ expr screenerExpr }
+
+// screenerCompare compares two operands. An operand is either a field name or
+// a constant; comparisons against fields missing from a message are false.
+type screenerCompare struct {
+	op          string
+	left, right screenerOperand
+}
+
+type screenerOperand struct {
+	field string
+	value float64
+}
+
+func (e screenerAnd) eval(v map[string]float64) bool { return e.left.eval(v) && e.right.eval(v) }
+func (e screenerOr) eval(v map[string]float64) bool  { return e.left.eval(v) || e.right.eval(v) }
+func (e screenerNot) eval(v map[string]float64) bool { return !e.expr.eval(v) }
+
+func (o screenerOperand) resolve(values map[string]float64) (float64, bool) {
+	if o.field == "" {
+		return o.value, true
+	}
+	v, ok := values[o.field]
+	return v, ok
+}
+
+func (e screenerCompare) eval(values map[string]float64) bool {
+	l, ok := e.left.resolve(values)
+	if !ok {
+		return false
+	}
+	r, ok := e.right.resolve(values)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case "=":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	return false
+}
+
+// screenerToken is a lexical token of a screener expression. Keywords and
+// field names are lower-cased; kind is one of ident, number, op, lparen, rparen.
+type screenerToken struct {
+	kind string
+	text string
+	pos  int
+}
+
+func lexScreenerQuery(input string) ([]screenerToken, error) {
+	var tokens []screenerToken
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, screenerToken{"lparen", "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, screenerToken{"rparen", ")", i})
+			i++
+		case strings.ContainsRune("<>=!", c):
+			start := i
+			i++
+			if i < len(input) && input[i] == '=' {
+				i++
+			}
+			op := input[start:i]
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d", start)
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, screenerToken{"op", op, start})
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || input[i] == '.' || input[i] == 'e' || input[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, screenerToken{"number", input[start:i], start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(input) && (input[i] == '_' || input[i] == '.' || unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i]))) {
+				i++
+			}
+			tokens = append(tokens, screenerToken{"ident", strings.ToLower(input[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// screenerParser is a recursive descent parser over the token list
+type screenerParser struct {
+	tokens []screenerToken
+	pos    int
+}
+
+func (p *screenerParser) peek() *screenerToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *screenerParser) keyword(word string) bool {
+	if t := p.peek(); t != nil && t.kind == "ident" && t.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseScreenerQuery parses a full screener query string
+func parseScreenerQuery(input string) (screenerQuery, error) {
+	q := screenerQuery{Limit: defaultScreenerLimit}
+	tokens, err := lexScreenerQuery(input)
+	if err != nil {
+		return q, err
+	}
+	p := &screenerParser{tokens: tokens}
+
+	if t := p.peek(); t != nil && !(t.kind == "ident" && (t.text == "order" || t.text == "limit")) {
+		if q.Where, err = p.parseOr(); err != nil {
+			return q, err
+		}
+	}
+
+	if p.keyword("order") {
+		if !p.keyword("by") {
+			return q, fmt.Errorf("expected BY after ORDER")
+		}
+		t := p.peek()
+		if t == nil || t.kind != "ident" {
+			return q, fmt.Errorf("expected field after ORDER BY")
+		}
+		if _, ok := screenerFields[t.text]; !ok {
+			return q, fmt.Errorf("unknown field %q", t.text)
+		}
+		q.OrderBy = t.text
+		p.pos++
+		switch {
+		case p.keyword("desc"):
+			q.Desc = true
+		case p.keyword("asc"):
+		}
+	}
+
+	if p.keyword("limit") {
+		t := p.peek()
+		if t == nil || t.kind != "number" {
+			return q, fmt.Errorf("expected number after LIMIT")
+		}
+		n, err := strconv.Atoi(t.text)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("LIMIT must be a positive integer")
+		}
+		q.Limit = clamp(n, 1, maxScreenerLimit)
+		p.pos++
+	}
+
+	if t := p.peek(); t != nil {
+		return q, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return q, nil
+}
+
+func (p *screenerParser) parseOr() (screenerExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = screenerOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *screenerParser) parseAnd() (screenerExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = screenerAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *screenerParser) parseUnary() (screenerExpr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return screenerNot{expr}, nil
+	}
+	if t := p.peek(); t != nil && t.kind == "lparen" {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != "rparen" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *screenerParser) parseComparison() (screenerExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t == nil || t.kind != "op" {
+		return nil, fmt.Errorf("expected comparison operator after %q", p.tokens[p.pos-1].text)
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return screenerCompare{op: t.text, left: left, right: right}, nil
+}
+
+func (p *screenerParser) parseOperand() (screenerOperand, error) {
+	t := p.peek()
+	if t == nil {
+		return screenerOperand{}, fmt.Errorf("unexpected end of query")
+	}
+	switch t.kind {
+	case "number":
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return screenerOperand{}, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		p.pos++
+		return screenerOperand{value: v}, nil
+	case "ident":
+		if _, ok := screenerFields[t.text]; !ok {
+			return screenerOperand{}, fmt.Errorf("unknown field %q", t.text)
+		}
+		p.pos++
+		return screenerOperand{field: t.text}, nil
+	}
+	return screenerOperand{}, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+// run filters, sorts and limits entries. It returns the selected metrics and
+// the number of symbols that matched before the limit was applied.
+func (q screenerQuery) run(entries []*metricsEntry) ([]calculator.SymbolMetrics, int) {
+	matched := make([]*metricsEntry, 0, len(entries))
+	for _, e := range entries {
+		if q.Where == nil || q.Where.eval(e.values) {
+			matched = append(matched, e)
+		}
+	}
+
+	if q.OrderBy != "" {
+		// Symbols missing the sort field go last regardless of direction
+		key := func(e *metricsEntry) float64 {
+			if v, ok := e.values[q.OrderBy]; ok {
+				return v
+			}
+			if q.Desc {
+				return math.Inf(-1)
+			}
+			return math.Inf(1)
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if q.Desc {
+				return key(matched[i]) > key(matched[j])
+			}
+			return key(matched[i]) < key(matched[j])
+		})
+	}
+
+	total := len(matched)
+	if len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	out := make([]calculator.SymbolMetrics, len(matched))
+	for i, e := range matched {
+		out[i] = e.Metrics
+	}
+	return out, total
+}
+
+type screenerResponse struct {
+	Query    string                     `json:"query"`
+	Universe int                        `json:"universe"`
+	Matched  int                        `json:"matched"`
+	Results  []calculator.SymbolMetrics `json:"results"`
+	TookMs   float64                    `json:"took_ms"`
+}
+
+// handleScreener evaluates ?q= against the in-memory snapshot of the latest
+// metrics per symbol, without touching TimescaleDB
+func (s *Server) handleScreener(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	raw := strings.TrimSpace(r.URL.Query().Get("q"))
+	q, err := parseScreenerQuery(raw)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	entries := s.metricsHub.snapshot()
+	results, matched := q.run(entries)
+
+	s.writeJSON(w, http.StatusOK, screenerResponse{
+		Query:    raw,
+		Universe: len(entries),
+		Matched:  matched,
+		Results:  results,
+		TookMs:   float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"testing"
+)
+
+func screenerHub(t *testing.T) *metricsHub {
+	t.Helper()
+	hub := newMetricsHub()
+	for _, msg := range []string{
+		`{"symbol":"BTCUSDT","price_change_1h":3,"price_change_15m":1,"volume_ratio_15m":2,"macd":{"histogram":0.5}}`,
+		`{"symbol":"ETHUSDT","price_change_1h":5,"price_change_15m":4,"volume_ratio_15m":1.8,"macd":{"histogram":-0.2}}`,
+		`{"symbol":"SOLUSDT","price_change_1h":2.5,"price_change_15m":2,"volume_ratio_15m":1.2,"macd":{"histogram":0.1}}`,
+		`{"symbol":"XRPUSDT","price_change_1h":-1,"price_change_15m":-2,"volume_ratio_15m":3}`,
+	} {
+		if err := hub.update([]byte(msg)); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+	return hub
+}
+
+func TestScreenerQuery(t *testing.T) {
+	hub := screenerHub(t)
+
+	tests := []struct {
+		query   string
+		want    []string
+		matched int
+	}{
+		{"", []string{"BTCUSDT", "ETHUSDT", "SOLUSDT", "XRPUSDT"}, 4},
+		{"price_change_1h > 2 AND volume_ratio_15m > 1.5 ORDER BY price_change_15m DESC LIMIT 20", []string{"ETHUSDT", "BTCUSDT"}, 2},
+		{"order by price_change_1h asc limit 2", []string{"XRPUSDT", "SOLUSDT"}, 4},
+		{"volume_ratio_15m >= 3 OR (price_change_1h > 4 AND NOT macd.histogram > 0)", []string{"ETHUSDT", "XRPUSDT"}, 2},
+		{"price_change_15m > price_change_1h", nil, 0},
+		{"macd.histogram != 0 ORDER BY macd.histogram DESC", []string{"BTCUSDT", "SOLUSDT", "ETHUSDT"}, 3},
+		{"price_change_1h < -0.5", []string{"XRPUSDT"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseScreenerQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			results, matched := q.run(hub.snapshot())
+			if matched != tt.matched {
+				t.Errorf("matched = %d, want %d", matched, tt.matched)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %v", len(results), tt.want)
+			}
+			for i, m := range results {
+				if m.Symbol != tt.want[i] {
+					t.Errorf("result %d = %s, want %s", i, m.Symbol, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScreenerQueryErrors(t *testing.T) {
+	for _, bad := range []string{
+		"price_change_1h >",
+		"unknown_field > 1",
+		"price_change_1h > 1 AND",
+		"(price_change_1h > 1",
+		"price_change_1h ! 1",
+		"price_change_1h > 1 ORDER price_change_1h",
+		"ORDER BY nope",
+		"LIMIT 0",
+		"LIMIT many",
+		"price_change_1h > 1 price_change_5m > 1",
+		"price_change_1h > 1 # comment",
+	} {
+		if _, err := parseScreenerQuery(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	q, err := parseScreenerQuery("LIMIT 100000")
+	if err != nil || q.Limit != maxScreenerLimit {
+		t.Errorf("limit = %d, err = %v, want clamp to %d", q.Limit, err, maxScreenerLimit)
+	}
+}
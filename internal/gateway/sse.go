@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/calculator"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
+)
+
+const (
+	metricsSubject = calculator.MetricsSubject
+
+	sseHeartbeatInterval = 15 * time.Second
+	sseWriteWait         = 10 * time.Second
+)
+
+// sseWriter writes Server-Sent Events frames and flushes them immediately
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newSSEWriter prepares w for an event stream. The server-wide WriteTimeout is
+// lifted so the response can stay open, and each write sets its own deadline.
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// Disable response buffering in nginx-style proxies
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return &sseWriter{w: w, rc: rc}
+}
+
+// event writes a single event. id may be empty for events that cannot be resumed.
+func (sw *sseWriter) event(id, name string, data []byte) error {
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if name != "" {
+		b.WriteString("event: " + name + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return sw.write(b.String())
+}
+
+// comment writes an SSE comment line, used as a heartbeat to keep proxies from
+// closing idle connections
+func (sw *sseWriter) comment(text string) error {
+	return sw.write(": " + text + "\n\n")
+}
+
+func (sw *sseWriter) write(s string) error {
+	_ = sw.rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+	if _, err := fmt.Fprint(sw.w, s); err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// heartbeat writes a comment every sseHeartbeatInterval until ctx ends. Writes
+// are serialized through mu with the event writer.
+func (sw *sseWriter) heartbeat(ctx context.Context, mu *sync.Mutex) {
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mu.Lock()
+			err := sw.comment("heartbeat")
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleAlertsSSE streams alerts.triggered as Server-Sent Events. Each event id
+// is the ALERTS stream sequence, so EventSource reconnects resume through the
+// Last-Event-ID header. since_seq, last_id, symbol and rule_type work as on
+// /ws/alerts.
+func (s *Server) handleAlertsSSE(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if lastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID")); lastEventID != "" && q.Get("since_seq") == "" && q.Get("last_id") == "" {
+		q.Set("since_seq", lastEventID)
+	}
+	rp, err := parseAlertReplay(q)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	filter := parseAlertFilter(q)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	feed, err := s.subscribeAlerts(ctx, rp)
+	if err != nil {
+		s.writeError(w, http.StatusServiceUnavailable, "subscribe_failed", err.Error())
+		return
+	}
+	defer feed.close()
+
+	sw := newSSEWriter(w)
+	var writeMu sync.Mutex
+	go func() {
+		sw.heartbeat(ctx, &writeMu)
+		cancel()
+	}()
+
+	err = s.streamAlerts(ctx, feed, rp, filter, func(f alertFrame) error {
+		payload, err := json.Marshal(f)
+		if err != nil {
+			return nil
+		}
+		id := ""
+		if f.Seq > 0 {
+			id = strconv.FormatUint(f.Seq, 10)
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return sw.event(id, "alert", payload)
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.WithField("error", err.Error()).Debug("alert event stream closed")
+	}
+}
+
+// listenBuffer is how many messages a stream client may fall behind before
+// new ones are dropped, as NATS drops them for slow subscribers
+const listenBuffer = 1024
+
+// listen follows subject on the bus through a buffered channel for one client
+func (s *Server) listen(ctx context.Context, subject string) (<-chan *messaging.Msg, messaging.Subscription, error) {
+	ch := make(chan *messaging.Msg, listenBuffer)
+	sub, err := s.bus.Listen(ctx, subject, func(ctx context.Context, msg *messaging.Msg) {
+		select {
+		case ch <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, sub, nil
+}
+
+// handleMetricsSSE streams metrics.calculated as Server-Sent Events, optionally
+// filtered by symbol. Metrics are snapshots, so reconnecting clients simply
+// continue with the next update.
+func (s *Server) handleMetricsSSE(w http.ResponseWriter, r *http.Request) {
+	symbols := toSet(splitMultiValue(r.URL.Query()["symbol"], strings.ToUpper))
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	updates, sub, err := s.listen(ctx, metricsSubject)
+	if err != nil {
+		s.writeError(w, http.StatusServiceUnavailable, "subscribe_failed", err.Error())
+		return
+	}
+	defer sub.Unsubscribe()
+
+	sw := newSSEWriter(w)
+	var writeMu sync.Mutex
+	go func() {
+		sw.heartbeat(ctx, &writeMu)
+		cancel()
+	}()
+
+	for {
+		var msg *messaging.Msg
+		select {
+		case msg = <-updates:
+		case <-ctx.Done():
+			return
+		}
+		if len(symbols) > 0 {
+			var head struct {
+				Symbol string `json:"symbol"`
+			}
+			if err := json.Unmarshal(msg.Data, &head); err != nil {
+				continue
+			}
+			if _, ok := symbols[head.Symbol]; !ok {
+				continue
+			}
+		}
+
+		writeMu.Lock()
+		err = sw.event("", "metrics", msg.Data)
+		writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/alerts"
+)
+
+func TestSSEWriterEvent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := newSSEWriter(rec)
+
+	if err := sw.event("12", "alert", []byte("{\"a\":1}\n{\"b\":2}")); err != nil {
+		t.Fatalf("event failed: %v", err)
+	}
+	if err := sw.comment("heartbeat"); err != nil {
+		t.Fatalf("comment failed: %v", err)
+	}
+
+	want := "id: 12\nevent: alert\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n: heartbeat\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("unexpected stream:\n%q\nwant\n%q", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %q", ct)
+	}
+	if !rec.Flushed {
+		t.Error("expected response to be flushed")
+	}
+}
+
+func TestAlertFilter(t *testing.T) {
+	f := parseAlertFilter(url.Values{"symbol": {"btcusdt,ethusdt"}, "rule_type": {"futures_pioneer_bull"}})
+
+	tests := []struct {
+		alert alerts.Alert
+		want  bool
+	}{
+		{alerts.Alert{Symbol: "BTCUSDT", RuleType: "futures_pioneer_bull"}, true},
+		{alerts.Alert{Symbol: "ETHUSDT", RuleType: "futures_pioneer_bear"}, false},
+		{alerts.Alert{Symbol: "SOLUSDT", RuleType: "futures_pioneer_bull"}, false},
+	}
+	for _, tt := range tests {
+		if got := f.match(&tt.alert); got != tt.want {
+			t.Errorf("match(%s/%s) = %v, want %v", tt.alert.Symbol, tt.alert.RuleType, got, tt.want)
+		}
+	}
+
+	if !parseAlertFilter(url.Values{}).match(&alerts.Alert{Symbol: "ANY"}) {
+		t.Error("empty filter should match everything")
+	}
+}
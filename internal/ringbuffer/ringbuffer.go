@@ -42,6 +42,39 @@ func (rb *RingBuffer) Append(candle Candle) {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
+	rb.appendLocked(candle)
+}
+
+// Upsert adds candle unless the buffer already holds one with its open time,
+// which it replaces instead, so a replayed candle is never counted twice.
+// Candles older than the latest that are not in the buffer are dropped.
+// Upsert reports whether candle was appended.
+func (rb *RingBuffer) Upsert(candle Candle) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	// Candles almost always follow the latest one
+	if rb.size == 0 || rb.candles[(rb.head+1439)%1440].OpenTime.Before(candle.OpenTime) {
+		rb.appendLocked(candle)
+		return true
+	}
+
+	// A replay: walk back from the latest candle to the one it replaces
+	for i := 0; i < rb.size; i++ {
+		idx := (rb.head - 1 - i + 1440) % 1440
+		held := rb.candles[idx].OpenTime
+		if held.Equal(candle.OpenTime) {
+			rb.candles[idx] = candle
+			break
+		}
+		if held.Before(candle.OpenTime) {
+			break
+		}
+	}
+	return false
+}
+
+func (rb *RingBuffer) appendLocked(candle Candle) {
 	rb.candles[rb.head] = candle
 	rb.head = (rb.head + 1) % 1440
 
@@ -2,6 +2,7 @@ package ringbuffer
 
 import (
 	"testing"
+	"time"
 )
 
 func TestRingBuffer_AppendAndSize(t *testing.T) {
@@ -114,6 +115,37 @@ func TestRingBuffer_GetLatest(t *testing.T) {
 	}
 }
 
+func TestRingBuffer_UpsertReplacesReplays(t *testing.T) {
+	rb := NewRingBuffer()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if !rb.Upsert(Candle{OpenTime: start.Add(time.Duration(i) * time.Minute), Volume: 10}) {
+			t.Fatalf("candle %d not appended", i)
+		}
+	}
+
+	// Replays replace the candle with the same open time
+	if rb.Upsert(Candle{OpenTime: start.Add(2 * time.Minute), Volume: 20}) {
+		t.Error("replayed latest candle appended")
+	}
+	if rb.Upsert(Candle{OpenTime: start, Volume: 30}) {
+		t.Error("replayed oldest candle appended")
+	}
+	if rb.Size() != 3 {
+		t.Fatalf("Expected size 3, got %d", rb.Size())
+	}
+	candles := rb.GetLast(3)
+	if candles[0].Volume != 30 || candles[1].Volume != 10 || candles[2].Volume != 20 {
+		t.Errorf("Expected volumes 30, 10, 20, got %v, %v, %v", candles[0].Volume, candles[1].Volume, candles[2].Volume)
+	}
+
+	// Older candles missing from the buffer are dropped
+	if rb.Upsert(Candle{OpenTime: start.Add(-time.Minute)}) || rb.Size() != 3 {
+		t.Errorf("candle before the buffer was added, size %d", rb.Size())
+	}
+}
+
 func TestAggregateTimeframe(t *testing.T) {
 	// Create 5 one-minute candles
 	candles := []Candle{
@@ -0,0 +1,148 @@
+package ringbuffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+	"time"
+)
+
+// snapshotMagic starts every encoded snapshot; the last byte is the version
+var snapshotMagic = [4]byte{'R', 'B', 'S', 1}
+
+// Snapshot is the content of a set of ring buffers at one point in time
+type Snapshot struct {
+	TakenAt time.Time
+	Candles map[string][]Candle // per symbol, oldest first
+}
+
+// MarshalBinary encodes the snapshot compactly: symbols are written once,
+// times as varint deltas and prices as raw float64 bits, which comes to
+// about 60 bytes a candle. A CRC32 of the content ends the encoding.
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	symbols := make([]string, 0, len(s.Candles))
+	candles := 0
+	for symbol, c := range s.Candles {
+		symbols = append(symbols, symbol)
+		candles += len(c)
+	}
+	sort.Strings(symbols)
+
+	buf := make([]byte, 0, 16+len(symbols)*16+candles*64)
+	buf = append(buf, snapshotMagic[:]...)
+	buf = binary.AppendVarint(buf, s.TakenAt.UnixMilli())
+	buf = binary.AppendUvarint(buf, uint64(len(symbols)))
+	for _, symbol := range symbols {
+		buf = binary.AppendUvarint(buf, uint64(len(symbol)))
+		buf = append(buf, symbol...)
+		buf = binary.AppendUvarint(buf, uint64(len(s.Candles[symbol])))
+
+		var prev int64
+		for _, c := range s.Candles[symbol] {
+			open := c.OpenTime.UnixMilli()
+			buf = binary.AppendVarint(buf, open-prev)
+			buf = binary.AppendVarint(buf, c.CloseTime.UnixMilli()-open)
+			for _, f := range []float64{c.Open, c.High, c.Low, c.Close, c.Volume, c.QuoteVolume} {
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+			}
+			buf = binary.AppendVarint(buf, c.NumberOfTrades)
+			prev = open
+		}
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+// UnmarshalBinary decodes a snapshot written by MarshalBinary
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < len(snapshotMagic)+4 || [4]byte(data[:4]) != snapshotMagic {
+		return errors.New("not a ring buffer snapshot")
+	}
+	content, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(content) != sum {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	r := snapshotReader{data: content[len(snapshotMagic):]}
+	takenAt := r.varint()
+	symbols := r.uvarint()
+	result := make(map[string][]Candle, min(symbols, 1<<16))
+	for i := uint64(0); i < symbols && r.err == nil; i++ {
+		symbol := string(r.bytes(r.uvarint()))
+		count := r.uvarint()
+		candles := make([]Candle, 0, min(count, 1440))
+
+		var open int64
+		for j := uint64(0); j < count && r.err == nil; j++ {
+			open += r.varint()
+			c := Candle{
+				Symbol:    symbol,
+				OpenTime:  time.UnixMilli(open).UTC(),
+				CloseTime: time.UnixMilli(open + r.varint()).UTC(),
+			}
+			for _, f := range []*float64{&c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.QuoteVolume} {
+				*f = math.Float64frombits(binary.LittleEndian.Uint64(r.bytes(8)))
+			}
+			c.NumberOfTrades = r.varint()
+			candles = append(candles, c)
+		}
+		result[symbol] = candles
+	}
+	if r.err != nil {
+		return fmt.Errorf("decode snapshot: %w", r.err)
+	}
+
+	s.TakenAt = time.UnixMilli(takenAt).UTC()
+	s.Candles = result
+	return nil
+}
+
+// snapshotReader reads the fields of an encoded snapshot, remembering the
+// first error. Reads after an error return zero values.
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+var errSnapshotTruncated = errors.New("snapshot truncated")
+
+func (r *snapshotReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errSnapshotTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *snapshotReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errSnapshotTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// bytes returns the next n bytes, or n zero bytes after an error
+func (r *snapshotReader) bytes(n uint64) []byte {
+	if r.err == nil && uint64(len(r.data)) < n {
+		r.err = errSnapshotTruncated
+	}
+	if r.err != nil {
+		return make([]byte, min(n, 8))
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
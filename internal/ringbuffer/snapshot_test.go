@@ -0,0 +1,60 @@
+package ringbuffer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := Snapshot{TakenAt: start.Add(24 * time.Hour), Candles: map[string][]Candle{}}
+	for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+		rb := NewRingBuffer()
+		for i := 0; i < 1500; i++ {
+			open := start.Add(time.Duration(i) * time.Minute)
+			rb.Append(Candle{
+				Symbol:         symbol,
+				OpenTime:       open,
+				CloseTime:      open.Add(time.Minute - time.Millisecond),
+				Open:           40000.5 + float64(i),
+				High:           40010.25 + float64(i),
+				Low:            39990.125 + float64(i),
+				Close:          40001 + float64(i),
+				Volume:         12.345,
+				QuoteVolume:    493827.1,
+				NumberOfTrades: int64(100 + i),
+			})
+		}
+		snap.Candles[symbol] = rb.GetLast(1440)
+	}
+	snap.Candles["EMPTYUSDT"] = []Candle{}
+
+	data, err := snap.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perCandle := len(data) / 2880; perCandle > 64 {
+		t.Errorf("snapshot takes %d bytes a candle", perCandle)
+	}
+
+	var got Snapshot
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !got.TakenAt.Equal(snap.TakenAt) {
+		t.Errorf("TakenAt = %v, want %v", got.TakenAt, snap.TakenAt)
+	}
+	if !reflect.DeepEqual(got.Candles, snap.Candles) {
+		t.Error("decoded candles differ from the snapshot")
+	}
+
+	// Corruption and truncation are detected
+	data[len(data)/2] ^= 0xff
+	if err := got.UnmarshalBinary(data); err == nil {
+		t.Error("corrupted snapshot decoded")
+	}
+	if err := got.UnmarshalBinary(data[:10]); err == nil {
+		t.Error("truncated snapshot decoded")
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in printed configuration
+const redacted = "REDACTED"
+
+// Validator is implemented by every service configuration
+type Validator interface {
+	Validate() error
+}
+
+// MustLoad loads cfg like Load and exits the process if it fails
+func MustLoad(cfg Validator) {
+	if err := Load(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// Load parses the --config and --print-config flags, then fills cfg, which
+// must already hold its defaults, from the YAML file named by --config (or
+// CONFIG_FILE) and environment overrides, and validates it. With --print-config
+// the effective configuration is written to stdout with secrets redacted and
+// the process exits.
+func Load(cfg Validator) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	err := LoadFile(*path, cfg)
+	if *printConfig {
+		if perr := Print(os.Stdout, cfg); perr != nil {
+			return perr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	return err
+}
+
+// LoadFile fills cfg from the YAML file at path, if path is not empty, applies
+// environment overrides and validates the result
+func LoadFile(path string, cfg Validator) error {
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open config file: %w", err)
+		}
+		defer f.Close()
+
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// applyEnv overrides every field tagged `env:"NAME"` whose variable is set.
+// A tag may list fallback names, `env:"NAME,OLD_NAME"`; the first one set
+// wins. Lists are comma separated and durations use time.ParseDuration syntax.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, raw := lookupEnv(field.Tag.Get("env"))
+		if raw == "" {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv returns the first of the comma separated variable names in tag
+// that is set, and its value
+func lookupEnv(tag string) (string, string) {
+	if tag == "" {
+		return "", ""
+	}
+	for _, name := range strings.Split(tag, ",") {
+		if raw, ok := os.LookupEnv(name); ok && raw != "" {
+			return name, raw
+		}
+	}
+	return "", ""
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, part := range strings.Split(raw, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				items = append(items, part)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// Print writes cfg as YAML with every field tagged `secret` redacted. Fields
+// tagged `secret:"url"` keep the URL and hide only its password.
+func Print(w io.Writer, cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	out := reflect.New(v.Type()).Elem()
+	out.Set(v)
+	redact(out)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(out.Interface()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redact masks the secret fields of v, which must be an addressable copy.
+// Slices are replaced rather than modified so the original is left intact.
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			redact(fv)
+			continue
+		}
+
+		mode := field.Tag.Get("secret")
+		if mode == "" {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(redactString(fv.String(), mode))
+		case reflect.Slice:
+			masked := make([]string, fv.Len())
+			for j := range masked {
+				masked[j] = redactString(fv.Index(j).String(), mode)
+			}
+			fv.Set(reflect.ValueOf(masked))
+		}
+	}
+}
+
+func redactString(s, mode string) string {
+	if s == "" {
+		return ""
+	}
+	if mode == "url" {
+		if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+			return u.Redacted()
+		}
+		return s
+	}
+	return redacted
+}
+
+// validation collects field errors so startup reports every problem at once
+type validation []error
+
+func (v *validation) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		*v = append(*v, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v validation) err() error {
+	return errors.Join(v...)
+}
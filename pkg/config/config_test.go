@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileAppliesYAMLThenEnv(t *testing.T) {
+	path := writeConfig(t, `
+log_level: debug
+metrics_port: 9192
+nats:
+  url: nats://nats:4222
+database:
+  url: postgres://crypto_user:secret@db:5432/crypto
+webhook_urls:
+  - https://discord.com/api/webhooks/1/token
+evaluation_interval: 10s
+persist_batch_size: 20
+`)
+	t.Setenv("PERSIST_BATCH_SIZE", "80")
+	t.Setenv("STALE_ALERT_THRESHOLD", "90s")
+	t.Setenv("WEBHOOK_URLS", "https://a.example/hook, https://b.example/hook")
+
+	cfg := DefaultAlertEngine()
+	if err := LoadFile(path, cfg); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	if cfg.LogLevel != "debug" || cfg.MetricsPort != 9192 || cfg.NATS.URL != "nats://nats:4222" {
+		t.Errorf("yaml values not applied: %+v", cfg.Service)
+	}
+	if cfg.EvaluationInterval != 10*time.Second {
+		t.Errorf("evaluation_interval = %s", cfg.EvaluationInterval)
+	}
+	if cfg.PersistBatchSize != 80 {
+		t.Errorf("env should override yaml: persist_batch_size = %d", cfg.PersistBatchSize)
+	}
+	if cfg.StaleAlertThreshold != 90*time.Second {
+		t.Errorf("stale_alert_threshold = %s", cfg.StaleAlertThreshold)
+	}
+	if len(cfg.WebhookURLs) != 2 || cfg.WebhookURLs[1] != "https://b.example/hook" {
+		t.Errorf("webhook_urls = %v", cfg.WebhookURLs)
+	}
+	if cfg.PersistFlushInterval != 5*time.Second {
+		t.Errorf("default lost: persist_flush_interval = %s", cfg.PersistFlushInterval)
+	}
+}
+
+func TestLoadFileRejectsUnknownFields(t *testing.T) {
+	path := writeConfig(t, "symbol_limt: 10\n")
+	err := LoadFile(path, DefaultDataCollector())
+	if err == nil || !strings.Contains(err.Error(), "symbol_limt") {
+		t.Fatalf("err = %v, want unknown field error", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := DefaultMetricsCalculator()
+	cfg.LogLevel = "verbose"
+	cfg.Database.URL = "mysql://localhost/crypto"
+	cfg.PersistBatchSize = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, field := range []string{"log_level", "database.url", "persist_batch_size"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error %q does not mention %s", err, field)
+		}
+	}
+}
+
+func TestLoadScreenerSections(t *testing.T) {
+	path := writeConfig(t, `
+bus: memory
+database:
+  url: postgres://crypto_user:secret@db:5432/crypto
+collector:
+  symbol_limit: 20
+engine:
+  evaluation_interval: 10s
+gateway:
+  http_addr: ":9000"
+`)
+	cfg := DefaultScreener()
+	if err := LoadFile(path, cfg); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Bus != BusMemory || cfg.Collector.SymbolLimit != 20 || cfg.Engine.EvaluationInterval != 10*time.Second || cfg.Gateway.HTTPAddr != ":9000" {
+		t.Errorf("sections not applied: %+v", cfg)
+	}
+	if cfg.Calculator.MinPublishCandles != 15 {
+		t.Errorf("default lost: min_publish_candles = %d", cfg.Calculator.MinPublishCandles)
+	}
+
+	cfg.Bus = "kafka"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "bus") {
+		t.Errorf("err = %v, want bus error", err)
+	}
+	cfg.Bus = BusEmbedded
+	cfg.NATSStoreDir = ""
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "nats_store_dir") {
+		t.Errorf("err = %v, want nats_store_dir error", err)
+	}
+}
+
+func TestPersistEnvPerService(t *testing.T) {
+	t.Setenv("PERSIST_BATCH_SIZE", "80")
+	t.Setenv("PERSIST_FLUSH_INTERVAL", "2s")
+	t.Setenv("METRICS_PERSIST_BATCH_SIZE", "200")
+	t.Setenv("ALERT_PERSIST_FLUSH_INTERVAL", "10s")
+
+	cfg := DefaultScreener()
+	if err := LoadFile("", cfg); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	// Prefixed variables configure one service; the unprefixed ones fill in
+	if cfg.Calculator.PersistBatchSize != 200 || cfg.Calculator.PersistFlushInterval != 2*time.Second {
+		t.Errorf("calculator persist = %d, %s", cfg.Calculator.PersistBatchSize, cfg.Calculator.PersistFlushInterval)
+	}
+	if cfg.Engine.PersistBatchSize != 80 || cfg.Engine.PersistFlushInterval != 10*time.Second {
+		t.Errorf("engine persist = %d, %s", cfg.Engine.PersistBatchSize, cfg.Engine.PersistFlushInterval)
+	}
+}
+
+func TestBadEnvValue(t *testing.T) {
+	t.Setenv("SYMBOL_LIMIT", "lots")
+	err := LoadFile("", DefaultDataCollector())
+	if err == nil || !strings.Contains(err.Error(), "SYMBOL_LIMIT") {
+		t.Fatalf("err = %v, want SYMBOL_LIMIT parse error", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := DefaultAPIGateway()
+	cfg.Database.URL = "postgres://crypto_user:hunter2@db:5432/crypto"
+	cfg.JWTSecret = "jwt-signing-key"
+	cfg.Redis.Password = "redis-pass"
+
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "jwt-signing-key", "redis-pass"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed config leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"crypto_user:xxxxx@db:5432", "jwt_secret: " + redacted, "rate_limit_window: 1m0s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printed config missing %q:\n%s", want, out)
+		}
+	}
+	if cfg.JWTSecret != "jwt-signing-key" {
+		t.Error("Print modified the configuration")
+	}
+}
+
+func TestPrintDoesNotModifySlices(t *testing.T) {
+	cfg := DefaultAlertEngine()
+	cfg.WebhookURLs = []string{"https://discord.com/api/webhooks/1/token"}
+
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "token") {
+		t.Errorf("webhook token printed:\n%s", buf.String())
+	}
+	if cfg.WebhookURLs[0] != "https://discord.com/api/webhooks/1/token" {
+		t.Errorf("webhook_urls modified: %v", cfg.WebhookURLs)
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	opt, err := Redis{URL: "localhost:6379", Password: "p"}.Options()
+	if err != nil || opt.Addr != "localhost:6379" || opt.Password != "p" {
+		t.Errorf("host:port options = %+v, %v", opt, err)
+	}
+	opt, err = Redis{URL: "redis://:fromurl@cache:6380/1"}.Options()
+	if err != nil || opt.Addr != "cache:6380" || opt.Password != "fromurl" || opt.DB != 1 {
+		t.Errorf("url options = %+v, %v", opt, err)
+	}
+	if (Redis{URL: "disabled"}).Enabled() {
+		t.Error("disabled redis reported enabled")
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s: versions must run 1, 2, 3, ... without gaps", m.Version, m.Name)
+		}
+		if len(m.Checksum) != 64 {
+			t.Errorf("migration %d_%s: checksum %q", m.Version, m.Name, m.Checksum)
+		}
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {"0001_init.up.sql": sql},
+		"bad name":     {"0001_init.up.sql": sql, "0001_init.down.sql": sql, "init.sql": sql},
+		"two names":    {"0001_init.up.sql": sql, "0001_other.down.sql": sql},
+	} {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: loaded without an error", name)
+		}
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "one", Checksum: "a"},
+		{Version: 2, Name: "two", Checksum: "b"},
+		{Version: 3, Name: "three", Checksum: "c"},
+	}
+	applied := map[int]appliedMigration{
+		1: {name: "one", checksum: "a"},
+		2: {name: "two", checksum: "changed"},
+		4: {name: "four", checksum: "d"},
+	}
+
+	want := []string{StateApplied, StateModified, StatePending, StateUnknown}
+	statuses := migrationStatus(migrations, applied)
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(want))
+	}
+	for i, s := range statuses {
+		if s.Version != i+1 || s.State != want[i] {
+			t.Errorf("status %d = %d %s, want %d %s", i, s.Version, s.State, i+1, want[i])
+		}
+	}
+
+	if err := checkRecorded(migrations, applied); err == nil {
+		t.Error("checkRecorded accepted a modified migration")
+	}
+	delete(applied, 2)
+	delete(applied, 4)
+	if err := checkRecorded(migrations, applied); err != nil {
+		t.Errorf("checkRecorded: %v", err)
+	}
+}
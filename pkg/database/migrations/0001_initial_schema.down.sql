@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_alert_subscriptions;
+DROP TABLE IF EXISTS user_settings;
+DROP TABLE IF EXISTS alert_rules;
+DROP TABLE IF EXISTS alert_history;
+DROP TABLE IF EXISTS metrics_calculated;
+DROP TABLE IF EXISTS candles_1m;
@@ -1,6 +1,6 @@
--- AUTHORITATIVE DATABASE SCHEMA FOR RAILWAY/TIMESCALEDB
--- This is the ONLY schema file used in production
--- Last updated: 2026-01-29
+-- Baseline schema, as applied by hand before migrations were versioned.
+-- Every statement tolerates existing objects, so those databases adopt it
+-- unchanged.
 
 -- Enable TimescaleDB extension
 CREATE EXTENSION IF NOT EXISTS timescaledb;
@@ -26,10 +26,17 @@ CREATE TABLE IF NOT EXISTS candles_1m (
 
 SELECT create_hypertable('candles_1m', 'time', if_not_exists => TRUE);
 SELECT add_retention_policy('candles_1m', INTERVAL '48 hours', if_not_exists => TRUE);
-ALTER TABLE candles_1m SET (
-  timescaledb.compress,
-  timescaledb.compress_segmentby = 'symbol'
-);
+-- Compression settings cannot be set again once chunks are compressed
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM timescaledb_information.hypertables
+                 WHERE hypertable_name = 'candles_1m' AND compression_enabled) THEN
+    ALTER TABLE candles_1m SET (
+      timescaledb.compress,
+      timescaledb.compress_segmentby = 'symbol'
+    );
+  END IF;
+END $$;
 SELECT add_compression_policy('candles_1m', INTERVAL '1 hour', if_not_exists => TRUE);
 
 CREATE INDEX IF NOT EXISTS idx_candles_symbol_time ON candles_1m (symbol, time DESC);
@@ -83,6 +90,7 @@ CREATE INDEX IF NOT EXISTS idx_metrics_symbol_timeframe ON metrics_calculated (s
 -- Alert History (triggered alerts log)
 CREATE TABLE IF NOT EXISTS alert_history (
   id SERIAL PRIMARY KEY,
+  alert_id UUID NOT NULL DEFAULT gen_random_uuid(), -- ID the alert engine gave the alert
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   symbol TEXT NOT NULL,
   rule_type TEXT NOT NULL,
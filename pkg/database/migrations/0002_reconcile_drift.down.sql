@@ -0,0 +1,13 @@
+-- alert_history keeps created_at: the services never read "time"
+
+ALTER TABLE alert_history DROP COLUMN IF EXISTS alert_id;
+
+ALTER TABLE user_settings
+  DROP COLUMN IF EXISTS notification_enabled,
+  DROP COLUMN IF EXISTS webhook_url,
+  DROP COLUMN IF EXISTS selected_alerts;
+
+ALTER TABLE metrics_calculated
+  DROP COLUMN IF EXISTS bb_lower,
+  DROP COLUMN IF EXISTS bb_middle,
+  DROP COLUMN IF EXISTS bb_upper;
@@ -0,0 +1,28 @@
+-- Bring databases created by hand in line with what the services query
+
+-- The API reads Bollinger Bands, which the baseline schema lacked
+ALTER TABLE metrics_calculated
+  ADD COLUMN IF NOT EXISTS bb_upper DOUBLE PRECISION,
+  ADD COLUMN IF NOT EXISTS bb_middle DOUBLE PRECISION,
+  ADD COLUMN IF NOT EXISTS bb_lower DOUBLE PRECISION;
+
+-- Older databases time alerts in a "time" column; the services use created_at
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = current_schema() AND table_name = 'alert_history' AND column_name = 'time')
+     AND NOT EXISTS (SELECT 1 FROM information_schema.columns
+                     WHERE table_schema = current_schema() AND table_name = 'alert_history' AND column_name = 'created_at') THEN
+    ALTER TABLE alert_history RENAME COLUMN time TO created_at;
+  END IF;
+END $$;
+
+-- The API returns the ID the alert engine gave each alert, which clients
+-- resume from; alerts stored before get a fresh one
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS alert_id UUID NOT NULL DEFAULT gen_random_uuid();
+
+-- Settings the API stores per user
+ALTER TABLE user_settings
+  ADD COLUMN IF NOT EXISTS selected_alerts TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS webhook_url TEXT,
+  ADD COLUMN IF NOT EXISTS notification_enabled BOOLEAN NOT NULL DEFAULT true;
@@ -0,0 +1,3 @@
+DROP MATERIALIZED VIEW IF EXISTS candles_1d;
+DROP MATERIALIZED VIEW IF EXISTS candles_1h;
+DROP MATERIALIZED VIEW IF EXISTS candles_5m;
@@ -0,0 +1,74 @@
+-- Coarser candles kept longer than the 48 hours of candles_1m:
+--   candles_5m  from candles_1m, kept 90 days
+--   candles_1h  from candles_5m, kept 2 years
+--   candles_1d  from candles_1h, kept indefinitely
+-- Each aggregate is built from the previous one, so it keeps its history
+-- after the finer level is dropped. Refresh windows stay inside the source
+-- retention: refreshing a range whose raw candles are gone would empty it.
+-- Created WITH NO DATA so the migration runs in a transaction; the refresh
+-- policies fill them in on their first run, from the last day of candles_1m.
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_5m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '5 minutes', time) AS time,
+  symbol,
+  first(open, time) AS open,
+  MAX(high) AS high,
+  MIN(low) AS low,
+  last(close, time) AS close,
+  SUM(volume) AS volume,
+  SUM(quote_volume) AS quote_volume,
+  SUM(trades)::BIGINT AS trades
+FROM candles_1m
+GROUP BY time_bucket(INTERVAL '5 minutes', time), symbol
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('candles_5m',
+  start_offset => INTERVAL '1 day',
+  end_offset => INTERVAL '5 minutes',
+  schedule_interval => INTERVAL '5 minutes',
+  if_not_exists => TRUE);
+SELECT add_retention_policy('candles_5m', INTERVAL '90 days', if_not_exists => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 hour', time) AS time,
+  symbol,
+  first(open, time) AS open,
+  MAX(high) AS high,
+  MIN(low) AS low,
+  last(close, time) AS close,
+  SUM(volume) AS volume,
+  SUM(quote_volume) AS quote_volume,
+  SUM(trades)::BIGINT AS trades
+FROM candles_5m
+GROUP BY time_bucket(INTERVAL '1 hour', time), symbol
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('candles_1h',
+  start_offset => INTERVAL '3 days',
+  end_offset => INTERVAL '1 hour',
+  schedule_interval => INTERVAL '30 minutes',
+  if_not_exists => TRUE);
+SELECT add_retention_policy('candles_1h', INTERVAL '2 years', if_not_exists => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS candles_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 day', time) AS time,
+  symbol,
+  first(open, time) AS open,
+  MAX(high) AS high,
+  MIN(low) AS low,
+  last(close, time) AS close,
+  SUM(volume) AS volume,
+  SUM(quote_volume) AS quote_volume,
+  SUM(trades)::BIGINT AS trades
+FROM candles_1h
+GROUP BY time_bucket(INTERVAL '1 day', time), symbol
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('candles_1d',
+  start_offset => INTERVAL '7 days',
+  end_offset => INTERVAL '1 day',
+  schedule_interval => INTERVAL '1 hour',
+  if_not_exists => TRUE);
@@ -0,0 +1,4 @@
+ALTER TABLE alert_history DROP COLUMN IF EXISTS rule_version;
+DROP TABLE IF EXISTS alert_rule_versions;
+DROP FUNCTION IF EXISTS alert_rule_versions_immutable();
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS version;
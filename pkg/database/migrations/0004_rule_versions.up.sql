@@ -0,0 +1,39 @@
+-- Every change to alert_rules is kept as an immutable version, and alerts
+-- record the version of the rule that produced them
+
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- No foreign key: the history of a deleted rule is kept
+CREATE TABLE IF NOT EXISTS alert_rule_versions (
+  rule_type TEXT NOT NULL,
+  version INTEGER NOT NULL,
+  action TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL,
+  config JSONB NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  diff JSONB NOT NULL DEFAULT '{}',
+  rolled_back_to INTEGER, -- the version a rollback restored
+  author TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (rule_type, version)
+);
+
+CREATE OR REPLACE FUNCTION alert_rule_versions_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'alert_rule_versions is append-only';
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS alert_rule_versions_immutable ON alert_rule_versions;
+CREATE TRIGGER alert_rule_versions_immutable
+  BEFORE UPDATE OR DELETE ON alert_rule_versions
+  FOR EACH ROW EXECUTE FUNCTION alert_rule_versions_immutable();
+
+-- The rules as they are now become their first version
+INSERT INTO alert_rule_versions (rule_type, version, action, enabled, config, description, author, reason)
+SELECT rule_type, version, 'created', COALESCE(enabled, true), config, COALESCE(description, ''),
+       'migration', 'rule as of migration 0004_rule_versions'
+FROM alert_rules
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS rule_version INTEGER;
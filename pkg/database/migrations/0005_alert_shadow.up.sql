@@ -0,0 +1,16 @@
+-- Hits of shadow rules, which are evaluated on live metrics but never
+-- notified. One row per rule, symbol and metrics sample: periodic evaluation
+-- re-triggering on the same metrics adds nothing.
+CREATE TABLE IF NOT EXISTS alert_shadow (
+  id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  symbol TEXT NOT NULL,
+  rule_type TEXT NOT NULL,
+  rule_version INTEGER,
+  price DOUBLE PRECISION,
+  message TEXT,
+  metadata JSONB,
+  UNIQUE (rule_type, symbol, created_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_shadow_rule_type ON alert_shadow (rule_type, created_at DESC);
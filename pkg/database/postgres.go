@@ -147,7 +147,8 @@ func NewPostgresPool(ctx context.Context, connString string) (*pgxpool.Pool, err
 	}
 
 	log.Info().
-		Str("url", connString).
+		Str("host", poolConfig.ConnConfig.Host).
+		Str("database", poolConfig.ConnConfig.Database).
 		Int32("max_conns", poolConfig.MaxConns).
 		Msg("Connected to database")
 
@@ -0,0 +1,193 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Bus is the message transport between services. JetStreamBus runs it on a
+// NATS server; MemoryBus runs it in process for tests and single-binary runs.
+type Bus interface {
+	Publisher
+
+	// CreateStream ensures a stream capturing cfg.Subjects exists. Messages
+	// published to it with the ID of one stored within cfg.Duplicates are
+	// dropped.
+	CreateStream(ctx context.Context, cfg StreamConfig) error
+
+	// Subscribe delivers messages matching subject to handler, one at a time
+	// and in stream order, until ctx is done or the subscription is stopped.
+	// Every message must be acked; unacked messages are redelivered after
+	// cfg.AckWait. Subscriptions sharing a durable name share its messages.
+	Subscribe(ctx context.Context, subject string, cfg ConsumerConfig, handler Handler) (Subscription, error)
+
+	// Listen passes every message published on subject from now on to
+	// handler without consuming it, like a core NATS subscription. Nothing is
+	// replayed or redelivered and the messages need no ack.
+	Listen(ctx context.Context, subject string, handler Handler) (Subscription, error)
+
+	// DeleteConsumer removes a durable consumer and its position. Deleting a
+	// consumer that does not exist is not an error.
+	DeleteConsumer(ctx context.Context, stream, durable string) error
+
+	// Leases returns the lease store named bucket, creating it with ttl
+	Leases(ctx context.Context, bucket string, ttl time.Duration) (Leases, error)
+
+	// Close stops every subscription made through the bus
+	Close() error
+}
+
+// Publisher publishes messages to a stream
+type Publisher interface {
+	Publish(ctx context.Context, msg *Msg) error
+}
+
+// Handler processes one delivered message
+type Handler func(ctx context.Context, msg *Msg)
+
+// Subscription is an active consumer of a Bus. Stopping it keeps the durable
+// consumer's position, so a later Subscribe resumes where it left off.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Retention decides when a stream discards messages
+type Retention int
+
+const (
+	// WorkQueue removes each message once it is acked
+	WorkQueue Retention = iota
+	// Limits keeps messages until MaxAge so clients can replay them
+	Limits
+)
+
+// StreamConfig describes a stream
+type StreamConfig struct {
+	Name      string
+	Subjects  []string
+	MaxAge    time.Duration
+	Retention Retention
+
+	// Duplicates is how long the stream remembers message IDs: a message
+	// published again with the ID of one stored within the window is
+	// acknowledged but not stored. Defaults to DefaultDuplicates.
+	Duplicates time.Duration
+}
+
+// DefaultDuplicates matches the JetStream stream default
+const DefaultDuplicates = 2 * time.Minute
+
+func (c StreamConfig) duplicates() time.Duration {
+	if c.Duplicates <= 0 {
+		return DefaultDuplicates
+	}
+	return c.Duplicates
+}
+
+// ConsumerConfig describes a subscription's consumer. An empty Durable makes
+// an ephemeral consumer that is removed when the subscription stops.
+type ConsumerConfig struct {
+	Durable string
+
+	// AckWait is how long a delivered message may stay unacked before it is
+	// redelivered. Defaults to DefaultAckWait.
+	AckWait time.Duration
+
+	// MaxDeliver caps delivery attempts per message; 0 means unlimited
+	MaxDeliver int
+}
+
+// DefaultAckWait matches the JetStream consumer default
+const DefaultAckWait = 30 * time.Second
+
+// ErrNoStream is returned when publishing to a subject no stream captures
+var ErrNoStream = errors.New("no stream matches subject")
+
+// Msg is a message published to or delivered by a Bus. Header uses the NATS
+// header type so pipeline stamps and trace context travel unchanged.
+type Msg struct {
+	Subject string
+	Data    []byte
+	Header  nats.Header
+
+	// Sequence is the stream sequence and Delivered the delivery attempt,
+	// starting at 1. Both are set on delivered messages only.
+	Sequence  uint64
+	Delivered int
+
+	acker acker
+}
+
+type acker interface {
+	ack() error
+	nak() error
+}
+
+// Ack acknowledges a delivered message so it is not redelivered
+func (m *Msg) Ack() error {
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.ack()
+}
+
+// Nak asks for a delivered message to be redelivered immediately
+func (m *Msg) Nak() error {
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.nak()
+}
+
+func (c ConsumerConfig) ackWait() time.Duration {
+	if c.AckWait <= 0 {
+		return DefaultAckWait
+	}
+	return c.AckWait
+}
+
+// subjectMatches reports whether subject is matched by pattern, which may
+// contain the NATS wildcards * (one token) and > (one or more tokens)
+func subjectMatches(pattern, subject string) bool {
+	pt := strings.Split(pattern, ".")
+	st := strings.Split(subject, ".")
+	for i, p := range pt {
+		if p == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) {
+			return false
+		}
+		if p != "*" && p != st[i] {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
+
+// subjectCovers reports whether every subject matched by filter is also
+// matched by pattern
+func subjectCovers(pattern, filter string) bool {
+	pt := strings.Split(pattern, ".")
+	ft := strings.Split(filter, ".")
+	for i, p := range pt {
+		if p == ">" {
+			return len(ft) > i
+		}
+		if i >= len(ft) {
+			return false
+		}
+		switch {
+		case ft[i] == ">":
+			return false
+		case p == "*":
+		case p != ft[i]:
+			return false
+		}
+	}
+	return len(pt) == len(ft)
+}
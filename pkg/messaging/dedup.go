@@ -0,0 +1,27 @@
+package messaging
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// SetMsgID sets the ID streams deduplicate msg by. Publishing the same
+// message twice within the stream's duplicate window stores it once.
+func SetMsgID(msg *Msg, id string) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(nats.MsgIdHdr, id)
+}
+
+// MsgID returns the deduplication ID of msg, if it has one
+func MsgID(msg *Msg) string {
+	return msg.Header.Get(nats.MsgIdHdr)
+}
+
+// CandleMsgID identifies the 1m candle of symbol opening at openTime
+func CandleMsgID(symbol string, openTime time.Time) string {
+	return fmt.Sprintf("candle.%s.%d", symbol, openTime.UnixMilli())
+}
@@ -0,0 +1,34 @@
+package messaging
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/rs/zerolog/log"
+)
+
+// StartEmbeddedServer runs a NATS server with JetStream inside the process,
+// storing streams under storeDir. It accepts in-process connections only; pass
+// it as Config.InProcess to connect. Stop it with Shutdown.
+func StartEmbeddedServer(storeDir string) (*server.Server, error) {
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "screener",
+		JetStream:  true,
+		StoreDir:   storeDir,
+		DontListen: true,
+		NoSigs:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded NATS server: %w", err)
+	}
+
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server not ready")
+	}
+
+	log.Info().Str("store_dir", storeDir).Msg("Started embedded NATS server")
+	return ns, nil
+}
@@ -0,0 +1,301 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// fetchBatch is how many messages a subscription pulls per request
+	fetchBatch = 64
+	// fetchWait bounds each pull so subscriptions notice cancellation
+	fetchWait = time.Second
+)
+
+// JetStreamBus is a Bus on a NATS JetStream server. Subscriptions use pull
+// consumers created up front, so durable consumers outlive the process and
+// several replicas can share one.
+type JetStreamBus struct {
+	nc   *nats.Conn
+	js   nats.JetStreamContext
+	mu   sync.Mutex
+	subs map[*jsSub]struct{}
+}
+
+var _ Bus = (*JetStreamBus)(nil)
+
+type jsSub struct {
+	sub    *nats.Subscription
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewJetStreamBus runs a bus on nc. The caller keeps ownership of the
+// connection.
+func NewJetStreamBus(nc *nats.Conn) (*JetStreamBus, error) {
+	js, err := NewJetStream(nc)
+	if err != nil {
+		return nil, err
+	}
+	return &JetStreamBus{nc: nc, js: js, subs: make(map[*jsSub]struct{})}, nil
+}
+
+// CreateStream creates the stream if it doesn't exist and sets its duplicate
+// window. An existing stream with another retention policy is an
+// ErrRetentionMismatch; RecreateStream replaces it.
+func (b *JetStreamBus) CreateStream(ctx context.Context, cfg StreamConfig) error {
+	return ensureStream(b.js, streamConfig(cfg))
+}
+
+// RecreateStream deletes a stream whose retention policy differs from cfg's,
+// losing its messages and consumers, and creates it again; a missing stream
+// is created. It reports whether an existing stream was replaced.
+func (b *JetStreamBus) RecreateStream(ctx context.Context, cfg StreamConfig) (bool, error) {
+	want := streamConfig(cfg)
+	info, err := b.js.StreamInfo(cfg.Name)
+	if err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+		return false, fmt.Errorf("failed to look up stream %s: %w", cfg.Name, err)
+	}
+	if err == nil && info.Config.Retention == want.Retention {
+		return false, nil
+	}
+	replaced := err == nil
+	if replaced {
+		if err := b.js.DeleteStream(cfg.Name); err != nil {
+			return false, fmt.Errorf("failed to delete stream %s: %w", cfg.Name, err)
+		}
+		log.Warn().
+			Str("stream", cfg.Name).
+			Str("retention", info.Config.Retention.String()).
+			Uint64("messages", info.State.Msgs).
+			Msg("Deleted stream to change its retention policy")
+	}
+	return replaced, ensureStream(b.js, want)
+}
+
+// streamConfig translates cfg to a file-backed JetStream stream config
+func streamConfig(cfg StreamConfig) *nats.StreamConfig {
+	retention := nats.WorkQueuePolicy
+	if cfg.Retention == Limits {
+		retention = nats.LimitsPolicy
+	}
+	return &nats.StreamConfig{
+		Name:       cfg.Name,
+		Subjects:   cfg.Subjects,
+		Retention:  retention,
+		MaxAge:     cfg.MaxAge,
+		Duplicates: cfg.duplicates(),
+		Storage:    nats.FileStorage,
+	}
+}
+
+// Publish publishes msg and waits for the stream to store it
+func (b *JetStreamBus) Publish(ctx context.Context, msg *Msg) error {
+	out := &nats.Msg{Subject: msg.Subject, Data: msg.Data, Header: msg.Header}
+	if _, err := b.js.PublishMsg(out, nats.Context(ctx)); err != nil {
+		if errors.Is(err, nats.ErrNoStreamResponse) {
+			return fmt.Errorf("%w: %s", ErrNoStream, msg.Subject)
+		}
+		return err
+	}
+	return nil
+}
+
+// Subscribe binds a pull subscription to the consumer and fetches messages
+// for handler until ctx is done or the subscription is stopped
+func (b *JetStreamBus) Subscribe(ctx context.Context, subject string, cfg ConsumerConfig, handler Handler) (Subscription, error) {
+	var sub *nats.Subscription
+	if cfg.Durable != "" {
+		stream, err := b.js.StreamNameBySubject(subject)
+		if err != nil {
+			return nil, fmt.Errorf("find stream for %s: %w", subject, err)
+		}
+		if err := b.ensureConsumer(stream, subject, cfg); err != nil {
+			return nil, err
+		}
+		sub, err = b.js.PullSubscribe(subject, cfg.Durable, nats.Bind(stream, cfg.Durable))
+		if err != nil {
+			return nil, fmt.Errorf("bind consumer %s: %w", cfg.Durable, err)
+		}
+	} else {
+		opts := []nats.SubOpt{nats.AckExplicit(), nats.AckWait(cfg.ackWait()), nats.DeliverAll()}
+		if cfg.MaxDeliver > 0 {
+			opts = append(opts, nats.MaxDeliver(cfg.MaxDeliver))
+		}
+		var err error
+		sub, err = b.js.PullSubscribe(subject, "", opts...)
+		if err != nil {
+			return nil, fmt.Errorf("subscribe %s: %w", subject, err)
+		}
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	s := &jsSub{sub: sub, cancel: cancel, done: make(chan struct{})}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		defer func() {
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+		}()
+		fetchLoop(subCtx, sub, handler)
+	}()
+	return s, nil
+}
+
+// Listen subscribes to subject on the core NATS connection, so it sees
+// messages as they are published whether or not a stream stores them
+func (b *JetStreamBus) Listen(ctx context.Context, subject string, handler Handler) (Subscription, error) {
+	listenCtx, cancel := context.WithCancel(ctx)
+	sub, err := b.nc.Subscribe(subject, func(m *nats.Msg) {
+		msg := &Msg{Subject: m.Subject, Data: m.Data, Header: m.Header}
+		if msg.Header == nil {
+			msg.Header = nats.Header{}
+		}
+		handler(listenCtx, msg)
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("listen %s: %w", subject, err)
+	}
+	go func() {
+		<-listenCtx.Done()
+		_ = sub.Unsubscribe()
+	}()
+	return natsListener{sub: sub, cancel: cancel}, nil
+}
+
+type natsListener struct {
+	sub    *nats.Subscription
+	cancel context.CancelFunc
+}
+
+func (l natsListener) Unsubscribe() error {
+	l.cancel()
+	if err := l.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrBadSubscription) && !errors.Is(err, nats.ErrConnectionClosed) {
+		return err
+	}
+	return nil
+}
+
+// DeleteConsumer removes the durable consumer from the stream
+func (b *JetStreamBus) DeleteConsumer(ctx context.Context, stream, durable string) error {
+	err := b.js.DeleteConsumer(stream, durable, nats.Context(ctx))
+	if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("delete consumer %s: %w", durable, err)
+	}
+	return nil
+}
+
+// ensureConsumer creates the durable pull consumer. A push consumer left by
+// an older release under the same name is replaced.
+func (b *JetStreamBus) ensureConsumer(stream, subject string, cfg ConsumerConfig) error {
+	info, err := b.js.ConsumerInfo(stream, cfg.Durable)
+	if err == nil {
+		if info.Config.DeliverSubject == "" {
+			return nil
+		}
+		log.Warn().Str("consumer", cfg.Durable).Msg("Replacing push consumer with pull consumer")
+		if err := b.js.DeleteConsumer(stream, cfg.Durable); err != nil {
+			return fmt.Errorf("delete push consumer %s: %w", cfg.Durable, err)
+		}
+	} else if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("consumer info %s: %w", cfg.Durable, err)
+	}
+
+	maxDeliver := cfg.MaxDeliver
+	if maxDeliver <= 0 {
+		maxDeliver = -1
+	}
+	_, err = b.js.AddConsumer(stream, &nats.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: subject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       cfg.ackWait(),
+		MaxDeliver:    maxDeliver,
+		DeliverPolicy: nats.DeliverAllPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("create consumer %s: %w", cfg.Durable, err)
+	}
+	return nil
+}
+
+func fetchLoop(ctx context.Context, sub *nats.Subscription, handler Handler) {
+	for ctx.Err() == nil {
+		msgs, err := sub.Fetch(fetchBatch, nats.MaxWait(fetchWait))
+		switch {
+		case err == nil, errors.Is(err, nats.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		case errors.Is(err, nats.ErrConnectionClosed), errors.Is(err, nats.ErrBadSubscription):
+			return
+		default:
+			log.Warn().Err(err).Str("subject", sub.Subject).Msg("JetStream fetch failed")
+			select {
+			case <-ctx.Done():
+			case <-time.After(fetchWait):
+			}
+			continue
+		}
+
+		for _, m := range msgs {
+			if ctx.Err() != nil {
+				// Unhandled messages are redelivered after AckWait
+				return
+			}
+			handler(ctx, fromNATS(m))
+		}
+	}
+}
+
+func fromNATS(m *nats.Msg) *Msg {
+	msg := &Msg{Subject: m.Subject, Data: m.Data, Header: m.Header, acker: natsAck{m}}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	if meta, err := m.Metadata(); err == nil {
+		msg.Sequence = meta.Sequence.Stream
+		msg.Delivered = int(meta.NumDelivered)
+	}
+	return msg
+}
+
+type natsAck struct{ m *nats.Msg }
+
+func (a natsAck) ack() error { return a.m.Ack() }
+func (a natsAck) nak() error { return a.m.Nak() }
+
+// Unsubscribe stops fetching and waits for the handler to return. Durable
+// consumers are kept on the server.
+func (s *jsSub) Unsubscribe() error {
+	s.cancel()
+	<-s.done
+	return s.sub.Unsubscribe()
+}
+
+// Close stops every subscription made through the bus
+func (b *JetStreamBus) Close() error {
+	b.mu.Lock()
+	subs := make([]*jsSub, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	var errs []error
+	for _, s := range subs {
+		if err := s.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
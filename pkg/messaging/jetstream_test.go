@@ -0,0 +1,190 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func newEmbeddedBus(t *testing.T) *JetStreamBus {
+	t.Helper()
+	ns, err := StartEmbeddedServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ns.Shutdown)
+
+	nc, err := NewNATSConn(Config{InProcess: ns, EnableJetStream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	bus, err := NewJetStreamBus(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+
+	if err := bus.CreateStream(context.Background(), StreamConfig{
+		Name:      "CANDLES",
+		Subjects:  []string{"candles.>"},
+		MaxAge:    time.Hour,
+		Retention: WorkQueue,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return bus
+}
+
+func TestJetStreamBusDurableRedelivers(t *testing.T) {
+	bus := newEmbeddedBus(t)
+	publish(t, bus, "candles.1m.BTCUSDT", 2)
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc", AckWait: time.Second}, func(m *Msg) {
+		if m.Sequence == 1 && m.Delivered == 1 {
+			m.Nak()
+			return
+		}
+		m.Ack()
+	})
+
+	seen := map[uint64]int{}
+	for i := 0; i < 3; i++ {
+		msg := next(t, ch)
+		seen[msg.Sequence] = msg.Delivered
+	}
+	if seen[1] != 2 || seen[2] != 1 {
+		t.Fatalf("deliveries = %v", seen)
+	}
+}
+
+func TestJetStreamBusDeduplicatesMsgIDs(t *testing.T) {
+	bus := newEmbeddedBus(t)
+	id := CandleMsgID("BTCUSDT", time.Unix(60, 0))
+	publishWithIDs(t, bus, "candles.1m.BTCUSDT", id, id, "other")
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) { m.Ack() })
+	if first, second := next(t, ch), next(t, ch); string(first.Data) != "0" || string(second.Data) != "2" {
+		t.Fatalf("stored %q and %q, want the first and third messages", first.Data, second.Data)
+	}
+	none(t, ch, 100*time.Millisecond)
+}
+
+func TestJetStreamBusListen(t *testing.T) {
+	bus := newEmbeddedBus(t)
+
+	ch := make(chan *Msg, 10)
+	sub, err := bus.Listen(context.Background(), "candles.1m.*", func(ctx context.Context, m *Msg) { ch <- m })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	out := NewMsg("candles.1m.BTCUSDT", []byte("1"), nil)
+	SetTimestamp(out.Header, HeaderCollectorPublished, time.Now())
+	if err := bus.Publish(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	msg := next(t, ch)
+	if _, ok := Timestamp(msg.Header, HeaderCollectorPublished); !ok || string(msg.Data) != "1" {
+		t.Fatalf("listened message = %q %v", msg.Data, msg.Header)
+	}
+}
+
+func TestJetStreamBusRecreatesWorkQueueAlertsStream(t *testing.T) {
+	bus := newEmbeddedBus(t)
+	ctx := context.Background()
+
+	// Deployments created ALERTS as a work queue before clients replayed it
+	old := AlertsStream
+	old.Retention = WorkQueue
+	if err := bus.CreateStream(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, bus, "alerts.triggered", 1)
+
+	// Services refuse to start rather than delete the stream
+	if err := bus.CreateStream(ctx, AlertsStream); !errors.Is(err, ErrRetentionMismatch) {
+		t.Fatalf("CreateStream on work-queue ALERTS = %v, want ErrRetentionMismatch", err)
+	}
+	if info, err := bus.js.StreamInfo("ALERTS"); err != nil || info.State.Msgs != 1 {
+		t.Fatalf("ALERTS after refused create = %v, %v", info, err)
+	}
+
+	if replaced, err := bus.RecreateStream(ctx, AlertsStream); !replaced || err != nil {
+		t.Fatalf("RecreateStream = %v, %v", replaced, err)
+	}
+	info, err := bus.js.StreamInfo("ALERTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.Retention != nats.LimitsPolicy || info.Config.Duplicates != AlertsStream.Duplicates {
+		t.Fatalf("ALERTS retention = %v, duplicates = %v", info.Config.Retention, info.Config.Duplicates)
+	}
+
+	// The gateway replays alerts with ordered consumers, which work-queue
+	// streams reject
+	sub, err := bus.js.SubscribeSync("alerts.>", nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		t.Fatalf("ordered consumer on ALERTS: %v", err)
+	}
+	defer sub.Unsubscribe()
+	publish(t, bus, "alerts.triggered", 1)
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil || string(msg.Data) != "0" {
+		t.Fatalf("replayed alert = %v, %v", msg, err)
+	}
+
+	// Streams that already have the right retention are left alone
+	if replaced, err := bus.RecreateStream(ctx, AlertsStream); replaced || err != nil {
+		t.Fatalf("second RecreateStream = %v, %v", replaced, err)
+	}
+	if err := bus.CreateStream(ctx, AlertsStream); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := bus.js.StreamInfo("ALERTS"); err != nil || info.State.Msgs != 1 {
+		t.Fatalf("ALERTS after second recreate = %v, %v", info, err)
+	}
+}
+
+func TestJetStreamLeases(t *testing.T) {
+	bus := newEmbeddedBus(t)
+	ctx := context.Background()
+	leases, err := bus.Leases(ctx, "test-leases", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := leases.Acquire(ctx, "partition.1", "a"); !ok || err != nil {
+		t.Fatalf("first acquire = %v, %v", ok, err)
+	}
+	if ok, err := leases.Acquire(ctx, "partition.1", "a"); !ok || err != nil {
+		t.Fatalf("renew = %v, %v", ok, err)
+	}
+	if ok, err := leases.Acquire(ctx, "partition.1", "b"); ok || err != nil {
+		t.Fatalf("acquire held lease = %v, %v", ok, err)
+	}
+	if err := leases.Release(ctx, "partition.1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leases.Acquire(ctx, "member.a", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	holders, err := leases.Holders(ctx, "partition.")
+	if err != nil || len(holders) != 1 || holders["partition.1"] != "a" {
+		t.Fatalf("holders = %v, %v", holders, err)
+	}
+
+	// Released leases are free for anyone
+	if err := leases.Release(ctx, "partition.1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := leases.Acquire(ctx, "partition.1", "b"); !ok || err != nil {
+		t.Fatalf("acquire released lease = %v, %v", ok, err)
+	}
+}
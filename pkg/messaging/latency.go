@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Pipeline timestamp headers. Each service copies the headers of the message
+// it consumed onto the message it publishes and adds its own stamp, so every
+// message downstream carries its origin times. Values are Unix milliseconds.
+const (
+	HeaderBinanceEventTime    = "Pipeline-Binance-Event"
+	HeaderCollectorPublished  = "Pipeline-Collector-Published"
+	HeaderCalculatorPublished = "Pipeline-Calculator-Published"
+	HeaderEnginePublished     = "Pipeline-Engine-Published"
+	HeaderWebhookDelivered    = "Pipeline-Webhook-Delivered"
+)
+
+// pipelineHeaders lists the stamps in pipeline order
+var pipelineHeaders = []string{
+	HeaderBinanceEventTime,
+	HeaderCollectorPublished,
+	HeaderCalculatorPublished,
+	HeaderEnginePublished,
+	HeaderWebhookDelivered,
+}
+
+// NewMsg creates a message for subject carrying the pipeline stamps of parent,
+// which may be nil for messages that start the pipeline
+func NewMsg(subject string, data []byte, parent nats.Header) *Msg {
+	msg := &Msg{Subject: subject, Data: data, Header: nats.Header{}}
+	for _, name := range pipelineHeaders {
+		if v := parent.Get(name); v != "" {
+			msg.Header.Set(name, v)
+		}
+	}
+	return msg
+}
+
+// SetTimestamp stamps header name on h with t
+func SetTimestamp(h nats.Header, name string, t time.Time) {
+	h.Set(name, strconv.FormatInt(t.UnixMilli(), 10))
+}
+
+// Timestamp reads the pipeline stamp name from h
+func Timestamp(h nats.Header, name string) (time.Time, bool) {
+	v := h.Get(name)
+	if v == "" {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// Since returns the time elapsed between the stamp name on h and now
+func Since(h nats.Header, name string, now time.Time) (time.Duration, bool) {
+	t, ok := Timestamp(h, name)
+	if !ok {
+		return 0, false
+	}
+	return now.Sub(t), true
+}
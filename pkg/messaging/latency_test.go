@@ -0,0 +1,38 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestPipelineStampsPropagate(t *testing.T) {
+	event := time.UnixMilli(1770206400000)
+
+	candle := NewMsg("candles.1m.BTCUSDT", []byte("{}"), nil)
+	SetTimestamp(candle.Header, HeaderBinanceEventTime, event)
+	SetTimestamp(candle.Header, HeaderCollectorPublished, event.Add(40*time.Millisecond))
+	candle.Header.Set("Unrelated", "x")
+
+	metrics := NewMsg("metrics.calculated", []byte("{}"), candle.Header)
+	if metrics.Header.Get("Unrelated") != "" {
+		t.Error("non-pipeline header was copied")
+	}
+	got, ok := Timestamp(metrics.Header, HeaderBinanceEventTime)
+	if !ok || !got.Equal(event) {
+		t.Errorf("event time = %s, %v", got, ok)
+	}
+
+	lag, ok := Since(metrics.Header, HeaderCollectorPublished, event.Add(100*time.Millisecond))
+	if !ok || lag != 60*time.Millisecond {
+		t.Errorf("lag = %s, %v", lag, ok)
+	}
+
+	if _, ok := Timestamp(nil, HeaderEnginePublished); ok {
+		t.Error("missing header reported as present")
+	}
+	if _, ok := Timestamp(nats.Header{HeaderEnginePublished: {"soon"}}, HeaderEnginePublished); ok {
+		t.Error("malformed header reported as present")
+	}
+}
@@ -0,0 +1,230 @@
+package messaging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Leases grants time-limited ownership of named keys so replicas can split
+// work between them. A lease expires after the store's TTL unless its owner
+// renews it by acquiring it again.
+type Leases interface {
+	// Acquire takes key for owner, or renews it if owner already holds it.
+	// It reports false if another owner holds the key.
+	Acquire(ctx context.Context, key, owner string) (bool, error)
+
+	// Release gives up key if owner holds it
+	Release(ctx context.Context, key, owner string) error
+
+	// Holder returns the owner of key and whether it is held
+	Holder(ctx context.Context, key string) (string, bool, error)
+
+	// Holders returns the owner of every held key starting with prefix
+	Holders(ctx context.Context, prefix string) (map[string]string, error)
+}
+
+// InstanceID returns an owner name for this process: the hostname plus a
+// random suffix, so a restarted replica does not inherit its predecessor's
+// leases. It is a valid lease key token.
+func InstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "instance"
+	}
+	host = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, host)
+
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// kvLeases keeps leases in a JetStream key-value bucket whose TTL expires
+// them. Revision checks make Acquire and Release safe against other owners.
+type kvLeases struct {
+	kv nats.KeyValue
+}
+
+// Leases returns the leases in bucket, creating it with ttl if needed. An
+// existing bucket keeps its TTL.
+func (b *JetStreamBus) Leases(ctx context.Context, bucket string, ttl time.Duration) (Leases, error) {
+	kv, err := b.js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = b.js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, TTL: ttl, History: 1})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lease bucket %s: %w", bucket, err)
+	}
+	return &kvLeases{kv: kv}, nil
+}
+
+func (l *kvLeases) Acquire(ctx context.Context, key, owner string) (bool, error) {
+	entry, err := l.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		if _, err := l.kv.Create(key, []byte(owner)); err != nil {
+			if errors.Is(err, nats.ErrKeyExists) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(entry.Value()) != owner {
+		return false, nil
+	}
+
+	// Rewriting the key restarts its TTL
+	if _, err := l.kv.Update(key, []byte(owner), entry.Revision()); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *kvLeases) Release(ctx context.Context, key, owner string) error {
+	entry, err := l.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(entry.Value()) != owner {
+		return nil
+	}
+	if err := l.kv.Delete(key, nats.LastRevision(entry.Revision())); err != nil && !errors.Is(err, nats.ErrKeyExists) {
+		return err
+	}
+	return nil
+}
+
+func (l *kvLeases) Holder(ctx context.Context, key string) (string, bool, error) {
+	entry, err := l.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(entry.Value()), true, nil
+}
+
+func (l *kvLeases) Holders(ctx context.Context, prefix string) (map[string]string, error) {
+	keys, err := l.kv.Keys(nats.Context(ctx))
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	holders := make(map[string]string)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry, err := l.kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		holders[key] = string(entry.Value())
+	}
+	return holders, nil
+}
+
+// memLeases keeps leases in process for MemoryBus
+type memLeases struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	leases map[string]memLease
+}
+
+type memLease struct {
+	owner   string
+	expires time.Time
+}
+
+// Leases returns the leases in bucket, creating it with ttl if needed.
+// Leases of the same bucket are shared by everything using the bus.
+func (b *MemoryBus) Leases(ctx context.Context, bucket string, ttl time.Duration) (Leases, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.New("bus closed")
+	}
+	l, ok := b.leases[bucket]
+	if !ok {
+		l = &memLeases{ttl: ttl, leases: make(map[string]memLease)}
+		b.leases[bucket] = l
+	}
+	return l, nil
+}
+
+func (l *memLeases) Acquire(ctx context.Context, key, owner string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if lease, ok := l.leases[key]; ok && lease.owner != owner && lease.expires.After(now) {
+		return false, nil
+	}
+	l.leases[key] = memLease{owner: owner, expires: now.Add(l.ttl)}
+	return true, nil
+}
+
+func (l *memLeases) Release(ctx context.Context, key, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lease, ok := l.leases[key]; ok && lease.owner == owner {
+		delete(l.leases, key)
+	}
+	return nil
+}
+
+func (l *memLeases) Holder(ctx context.Context, key string) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lease, ok := l.leases[key]
+	if !ok || !lease.expires.After(time.Now()) {
+		return "", false, nil
+	}
+	return lease.owner, true, nil
+}
+
+func (l *memLeases) Holders(ctx context.Context, prefix string) (map[string]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	holders := make(map[string]string)
+	for key, lease := range l.leases {
+		if !lease.expires.After(now) {
+			delete(l.leases, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			holders[key] = lease.owner
+		}
+	}
+	return holders, nil
+}
@@ -0,0 +1,510 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// MemoryBus is an in-process Bus with JetStream delivery semantics: each
+// consumer sees its stream in order, unacked messages are redelivered after
+// AckWait or on Nak, durable consumers keep their position across
+// subscriptions, work-queue streams drop messages once acked, and message IDs
+// are deduplicated within each stream's duplicate window.
+type MemoryBus struct {
+	mu        sync.Mutex
+	streams   map[string]*memStream
+	subs      map[*memSub]struct{}
+	listeners map[*memListener]struct{}
+	leases    map[string]*memLeases
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type memStream struct {
+	cfg       StreamConfig
+	msgs      map[uint64]*memMsg
+	first     uint64 // lowest sequence that may still be stored
+	last      uint64
+	consumers map[string]*memConsumer
+	ephemeral int
+	ids       map[string]time.Time // message IDs stored within the duplicate window
+	idOrder   []memID
+}
+
+type memID struct {
+	id     string
+	stored time.Time
+}
+
+type memMsg struct {
+	subject string
+	data    []byte
+	header  nats.Header
+	stored  time.Time
+}
+
+type memConsumer struct {
+	bus     *MemoryBus
+	stream  *memStream
+	name    string
+	filter  string
+	cfg     ConsumerConfig
+	durable bool
+	next    uint64 // next stream sequence to deliver for the first time
+	pending map[uint64]*memPending
+	active  int
+	changed chan struct{} // closed and replaced whenever delivery state changes
+}
+
+// memPending is a delivered, unacked message
+type memPending struct {
+	deadline  time.Time
+	delivered int
+}
+
+type memSub struct {
+	consumer *memConsumer
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// listenBuffer is how many messages a listener may fall behind before new
+// ones are dropped, as NATS does for slow core subscribers
+const listenBuffer = 256
+
+type memListener struct {
+	subject string
+	ch      chan *Msg
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+var _ Bus = (*MemoryBus)(nil)
+
+// NewMemoryBus creates an empty in-process bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		streams:   make(map[string]*memStream),
+		subs:      make(map[*memSub]struct{}),
+		listeners: make(map[*memListener]struct{}),
+		leases:    make(map[string]*memLeases),
+	}
+}
+
+// CreateStream creates the stream unless one with the same name exists
+func (b *MemoryBus) CreateStream(ctx context.Context, cfg StreamConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("bus closed")
+	}
+	if _, ok := b.streams[cfg.Name]; ok {
+		return nil
+	}
+	b.streams[cfg.Name] = &memStream{
+		cfg:       cfg,
+		msgs:      make(map[uint64]*memMsg),
+		first:     1,
+		consumers: make(map[string]*memConsumer),
+		ids:       make(map[string]time.Time),
+	}
+	return nil
+}
+
+// duplicateLocked forgets the message IDs older than the duplicate window and
+// reports whether id is one of those left
+func (s *memStream) duplicateLocked(id string, now time.Time) bool {
+	cutoff := now.Add(-s.cfg.duplicates())
+	n := 0
+	for n < len(s.idOrder) && !s.idOrder[n].stored.After(cutoff) {
+		delete(s.ids, s.idOrder[n].id)
+		n++
+	}
+	s.idOrder = s.idOrder[n:]
+	_, ok := s.ids[id]
+	return ok
+}
+
+// Publish stores msg in the stream capturing its subject
+func (b *MemoryBus) Publish(ctx context.Context, msg *Msg) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("bus closed")
+	}
+	s := b.streamForLocked(msg.Subject)
+	if s == nil {
+		return fmt.Errorf("%w: %s", ErrNoStream, msg.Subject)
+	}
+
+	now := time.Now()
+	s.expireLocked(now)
+	if id := MsgID(msg); id != "" {
+		if s.duplicateLocked(id, now) {
+			// Like JetStream, a duplicate is acknowledged but not stored
+			return nil
+		}
+		s.ids[id] = now
+		s.idOrder = append(s.idOrder, memID{id: id, stored: now})
+	}
+	s.last++
+	s.msgs[s.last] = &memMsg{
+		subject: msg.Subject,
+		data:    append([]byte(nil), msg.Data...),
+		header:  cloneHeader(msg.Header),
+		stored:  now,
+	}
+	for _, c := range s.consumers {
+		c.notifyLocked()
+	}
+	b.notifyListenersLocked(s.msgs[s.last])
+	return nil
+}
+
+func (b *MemoryBus) notifyListenersLocked(m *memMsg) {
+	for l := range b.listeners {
+		if !subjectMatches(l.subject, m.subject) {
+			continue
+		}
+		select {
+		case l.ch <- &Msg{Subject: m.subject, Data: append([]byte(nil), m.data...), Header: cloneHeader(m.header)}:
+		default:
+		}
+	}
+}
+
+// Subscribe starts a delivery goroutine for subject on the durable consumer
+// named in cfg, creating the consumer on first use
+func (b *MemoryBus) Subscribe(ctx context.Context, subject string, cfg ConsumerConfig, handler Handler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.New("bus closed")
+	}
+
+	var s *memStream
+	for _, candidate := range b.streams {
+		for _, pattern := range candidate.cfg.Subjects {
+			if subjectCovers(pattern, subject) {
+				s = candidate
+			}
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoStream, subject)
+	}
+
+	c := s.consumers[cfg.Durable]
+	if c == nil || cfg.Durable == "" {
+		name := cfg.Durable
+		if name == "" {
+			s.ephemeral++
+			name = fmt.Sprintf("_ephemeral_%d", s.ephemeral)
+		}
+		c = &memConsumer{
+			bus:     b,
+			stream:  s,
+			name:    name,
+			filter:  subject,
+			cfg:     cfg,
+			durable: cfg.Durable != "",
+			next:    s.first,
+			pending: make(map[uint64]*memPending),
+			changed: make(chan struct{}),
+		}
+		s.consumers[name] = c
+	} else if c.filter != subject {
+		return nil, fmt.Errorf("consumer %s filters %s, not %s", c.name, c.filter, subject)
+	}
+	c.active++
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &memSub{consumer: c, cancel: cancel, done: make(chan struct{})}
+	b.subs[sub] = struct{}{}
+	b.wg.Add(1)
+	go b.deliver(subCtx, sub, handler)
+	return sub, nil
+}
+
+// Listen starts a goroutine passing messages published on subject to handler
+func (b *MemoryBus) Listen(ctx context.Context, subject string, handler Handler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.New("bus closed")
+	}
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	l := &memListener{
+		subject: subject,
+		ch:      make(chan *Msg, listenBuffer),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	b.listeners[l] = struct{}{}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer close(l.done)
+		defer func() {
+			b.mu.Lock()
+			delete(b.listeners, l)
+			b.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-listenCtx.Done():
+				return
+			case msg := <-l.ch:
+				handler(listenCtx, msg)
+			}
+		}
+	}()
+	return l, nil
+}
+
+// Unsubscribe stops the listener and waits for the handler to return
+func (l *memListener) Unsubscribe() error {
+	l.cancel()
+	<-l.done
+	return nil
+}
+
+// DeleteConsumer removes the durable consumer unless it is in use
+func (b *MemoryBus) DeleteConsumer(ctx context.Context, stream, durable string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[stream]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoStream, stream)
+	}
+	c, ok := s.consumers[durable]
+	if !ok {
+		return nil
+	}
+	if c.active > 0 {
+		return fmt.Errorf("consumer %s is in use", durable)
+	}
+	delete(s.consumers, durable)
+	return nil
+}
+
+// Close stops all subscriptions and rejects further use of the bus
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for sub := range b.subs {
+		sub.cancel()
+	}
+	for l := range b.listeners {
+		l.cancel()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+// Unsubscribe stops delivery and waits for the handler to return
+func (s *memSub) Unsubscribe() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// deliver runs one subscription: it hands the consumer's next message to
+// handler, or sleeps until a message is published, acked, naked or due for
+// redelivery
+func (b *MemoryBus) deliver(ctx context.Context, sub *memSub, handler Handler) {
+	defer b.wg.Done()
+	defer close(sub.done)
+	c := sub.consumer
+	defer func() {
+		b.mu.Lock()
+		c.active--
+		if !c.durable && c.active == 0 {
+			delete(c.stream.consumers, c.name)
+		}
+		delete(b.subs, sub)
+		b.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		b.mu.Lock()
+		msg, wait := c.nextLocked(time.Now())
+		changed := c.changed
+		b.mu.Unlock()
+
+		if msg != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			handler(ctx, msg)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-timer.C:
+		}
+	}
+}
+
+// nextLocked returns the next message to deliver, preferring redeliveries
+// that are due, or how long to wait before one may become due
+func (c *memConsumer) nextLocked(now time.Time) (*Msg, time.Duration) {
+	s := c.stream
+	s.expireLocked(now)
+
+	wait := time.Hour
+	var due uint64
+	for seq, p := range c.pending {
+		if _, ok := s.msgs[seq]; !ok {
+			delete(c.pending, seq)
+			continue
+		}
+		if !p.deadline.After(now) {
+			if due == 0 || seq < due {
+				due = seq
+			}
+		} else if d := p.deadline.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if due != 0 {
+		p := c.pending[due]
+		if c.cfg.MaxDeliver > 0 && p.delivered >= c.cfg.MaxDeliver {
+			// Out of attempts: the consumer gives up but the stream keeps it
+			delete(c.pending, due)
+			return c.nextLocked(now)
+		}
+		return c.deliverLocked(due, now), 0
+	}
+
+	if c.next < s.first {
+		c.next = s.first
+	}
+	for ; c.next <= s.last; c.next++ {
+		m, ok := s.msgs[c.next]
+		if !ok || !subjectMatches(c.filter, m.subject) {
+			continue
+		}
+		seq := c.next
+		c.next++
+		return c.deliverLocked(seq, now), 0
+	}
+	return nil, wait
+}
+
+func (c *memConsumer) deliverLocked(seq uint64, now time.Time) *Msg {
+	p := c.pending[seq]
+	if p == nil {
+		p = &memPending{}
+		c.pending[seq] = p
+	}
+	p.delivered++
+	p.deadline = now.Add(c.cfg.ackWait())
+
+	m := c.stream.msgs[seq]
+	return &Msg{
+		Subject:   m.subject,
+		Data:      append([]byte(nil), m.data...),
+		Header:    cloneHeader(m.header),
+		Sequence:  seq,
+		Delivered: p.delivered,
+		acker:     &memAck{consumer: c, seq: seq, delivered: p.delivered},
+	}
+}
+
+func (c *memConsumer) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// memAck acks or naks one delivery
+type memAck struct {
+	consumer  *memConsumer
+	seq       uint64
+	delivered int
+}
+
+func (a *memAck) ack() error {
+	c := a.consumer
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+
+	delete(c.pending, a.seq)
+	if c.stream.cfg.Retention == WorkQueue {
+		delete(c.stream.msgs, a.seq)
+	}
+	c.notifyLocked()
+	return nil
+}
+
+func (a *memAck) nak() error {
+	c := a.consumer
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+
+	// A nak for an earlier delivery must not cut short a newer one
+	if p, ok := c.pending[a.seq]; ok && p.delivered == a.delivered {
+		p.deadline = time.Time{}
+		c.notifyLocked()
+	}
+	return nil
+}
+
+// streamForLocked returns the stream capturing subject
+func (b *MemoryBus) streamForLocked(subject string) *memStream {
+	for _, s := range b.streams {
+		for _, pattern := range s.cfg.Subjects {
+			if subjectMatches(pattern, subject) {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// expireLocked drops messages older than the stream's MaxAge
+func (s *memStream) expireLocked(now time.Time) {
+	if s.cfg.MaxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.cfg.MaxAge)
+	for ; s.first <= s.last; s.first++ {
+		m, ok := s.msgs[s.first]
+		if ok && m.stored.After(cutoff) {
+			return
+		}
+		delete(s.msgs, s.first)
+	}
+}
+
+func cloneHeader(h nats.Header) nats.Header {
+	out := nats.Header{}
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
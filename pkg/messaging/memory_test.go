@@ -0,0 +1,384 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestBus(t *testing.T, retention Retention) *MemoryBus {
+	t.Helper()
+	bus := NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	err := bus.CreateStream(context.Background(), StreamConfig{
+		Name:      "CANDLES",
+		Subjects:  []string{"candles.>"},
+		MaxAge:    time.Hour,
+		Retention: retention,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bus
+}
+
+func publish(t *testing.T, bus Bus, subject string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := bus.Publish(context.Background(), NewMsg(subject, []byte(fmt.Sprint(i)), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// collect subscribes with handler and returns delivered messages on a channel
+func collect(t *testing.T, bus Bus, subject string, cfg ConsumerConfig, handler func(*Msg)) (<-chan *Msg, Subscription) {
+	t.Helper()
+	ch := make(chan *Msg, 100)
+	sub, err := bus.Subscribe(context.Background(), subject, cfg, func(ctx context.Context, msg *Msg) {
+		if handler != nil {
+			handler(msg)
+		}
+		ch <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch, sub
+}
+
+func next(t *testing.T, ch <-chan *Msg) *Msg {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func none(t *testing.T, ch <-chan *Msg, wait time.Duration) {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected delivery of seq %d (attempt %d)", msg.Sequence, msg.Delivered)
+	case <-time.After(wait):
+	}
+}
+
+func TestMemoryBusDeliversInOrder(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 5)
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) { m.Ack() })
+	for i := 0; i < 5; i++ {
+		msg := next(t, ch)
+		if string(msg.Data) != fmt.Sprint(i) || msg.Sequence != uint64(i+1) || msg.Delivered != 1 {
+			t.Fatalf("message %d: data=%s seq=%d delivered=%d", i, msg.Data, msg.Sequence, msg.Delivered)
+		}
+	}
+}
+
+func TestMemoryBusFiltersSubjects(t *testing.T) {
+	bus := newTestBus(t, Limits)
+	publish(t, bus, "candles.1m.ETHUSDT", 1)
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+
+	ch, _ := collect(t, bus, "candles.1m.BTCUSDT", ConsumerConfig{}, func(m *Msg) { m.Ack() })
+	if msg := next(t, ch); msg.Subject != "candles.1m.BTCUSDT" {
+		t.Fatalf("subject = %s", msg.Subject)
+	}
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryBusRedeliversAfterAckWait(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc", AckWait: 50 * time.Millisecond}, nil)
+	first := next(t, ch)
+	second := next(t, ch)
+	if first.Sequence != second.Sequence || second.Delivered != 2 {
+		t.Fatalf("redelivery: seq %d then %d, attempt %d", first.Sequence, second.Sequence, second.Delivered)
+	}
+	second.Ack()
+	none(t, ch, 150*time.Millisecond)
+}
+
+func TestMemoryBusNakRedeliversImmediately(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) {
+		if m.Delivered == 1 {
+			m.Nak()
+		} else {
+			m.Ack()
+		}
+	})
+	next(t, ch)
+	if msg := next(t, ch); msg.Delivered != 2 {
+		t.Fatalf("delivered = %d, want 2", msg.Delivered)
+	}
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryBusRedeliveryKeepsOrder(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 3)
+
+	// The first message is naked once; it is redelivered before the third
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) {
+		if m.Sequence == 1 && m.Delivered == 1 {
+			m.Nak()
+			return
+		}
+		m.Ack()
+	})
+	var got []uint64
+	for i := 0; i < 4; i++ {
+		got = append(got, next(t, ch).Sequence)
+	}
+	if fmt.Sprint(got) != "[1 1 2 3]" {
+		t.Fatalf("delivery order = %v", got)
+	}
+}
+
+func TestMemoryBusMaxDeliver(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc", MaxDeliver: 2}, func(m *Msg) { m.Nak() })
+	next(t, ch)
+	next(t, ch)
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryBusDurableResumes(t *testing.T) {
+	bus := newTestBus(t, Limits)
+	publish(t, bus, "candles.1m.BTCUSDT", 2)
+
+	cfg := ConsumerConfig{Durable: "calc", AckWait: 50 * time.Millisecond}
+	ch, sub := collect(t, bus, "candles.1m.>", cfg, func(m *Msg) {
+		if m.Sequence == 1 {
+			m.Ack()
+		}
+	})
+	next(t, ch)
+	next(t, ch)
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+	time.Sleep(cfg.AckWait)
+
+	// The unacked second message comes back, then the new one; the acked
+	// first message does not
+	ch, _ = collect(t, bus, "candles.1m.>", cfg, func(m *Msg) { m.Ack() })
+	if msg := next(t, ch); msg.Sequence != 2 || msg.Delivered != 2 {
+		t.Fatalf("resumed at seq %d attempt %d", msg.Sequence, msg.Delivered)
+	}
+	if msg := next(t, ch); msg.Sequence != 3 {
+		t.Fatalf("then seq %d, want 3", msg.Sequence)
+	}
+}
+
+func TestMemoryBusSharedDurableSplitsMessages(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	ch := make(chan *Msg, 100)
+	for i := 0; i < 2; i++ {
+		_, err := bus.Subscribe(context.Background(), "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(ctx context.Context, m *Msg) {
+			m.Ack()
+			ch <- m
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(t, bus, "candles.1m.BTCUSDT", 20)
+
+	seen := make(map[uint64]bool)
+	for i := 0; i < 20; i++ {
+		msg := next(t, ch)
+		if seen[msg.Sequence] {
+			t.Fatalf("seq %d delivered twice", msg.Sequence)
+		}
+		seen[msg.Sequence] = true
+	}
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryBusWorkQueueRemovesAcked(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 2)
+
+	ch, sub := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) { m.Ack() })
+	next(t, ch)
+	next(t, ch)
+	sub.Unsubscribe()
+
+	// A consumer created later finds nothing left
+	ch, _ = collect(t, bus, "candles.1m.>", ConsumerConfig{}, nil)
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryBusLimitsReplaysToNewConsumers(t *testing.T) {
+	bus := newTestBus(t, Limits)
+	publish(t, bus, "candles.1m.BTCUSDT", 2)
+
+	for _, name := range []string{"gateway-1", "gateway-2"} {
+		ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: name}, func(m *Msg) { m.Ack() })
+		next(t, ch)
+		next(t, ch)
+	}
+}
+
+// publishWithIDs publishes one message per ID, in order
+func publishWithIDs(t *testing.T, bus Bus, subject string, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		msg := NewMsg(subject, []byte(fmt.Sprint(i)), nil)
+		SetMsgID(msg, id)
+		if err := bus.Publish(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryBusDeduplicatesMsgIDs(t *testing.T) {
+	bus := NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+	err := bus.CreateStream(context.Background(), StreamConfig{
+		Name:       "CANDLES",
+		Subjects:   []string{"candles.>"},
+		Retention:  WorkQueue,
+		Duplicates: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := CandleMsgID("BTCUSDT", time.Unix(60, 0))
+	publishWithIDs(t, bus, "candles.1m.BTCUSDT", id, id, "other")
+	ch, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) { m.Ack() })
+	if first, second := next(t, ch), next(t, ch); string(first.Data) != "0" || string(second.Data) != "2" {
+		t.Fatalf("stored %q and %q, want the first and third messages", first.Data, second.Data)
+	}
+	none(t, ch, 50*time.Millisecond)
+
+	// Outside the window the ID is stored again
+	time.Sleep(150 * time.Millisecond)
+	publishWithIDs(t, bus, "candles.1m.BTCUSDT", id)
+	if msg := next(t, ch); MsgID(msg) != id {
+		t.Fatalf("msg id = %q", MsgID(msg))
+	}
+}
+
+func TestMemoryBusErrors(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	ctx := context.Background()
+
+	if err := bus.Publish(ctx, NewMsg("metrics.calculated", nil, nil)); !errors.Is(err, ErrNoStream) {
+		t.Errorf("publish without stream: %v", err)
+	}
+	if _, err := bus.Subscribe(ctx, "metrics.>", ConsumerConfig{}, func(context.Context, *Msg) {}); !errors.Is(err, ErrNoStream) {
+		t.Errorf("subscribe without stream: %v", err)
+	}
+	if _, err := bus.Subscribe(ctx, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(context.Context, *Msg) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Subscribe(ctx, "candles.5m.>", ConsumerConfig{Durable: "calc"}, func(context.Context, *Msg) {}); err == nil {
+		t.Error("durable reused with a different filter")
+	}
+}
+
+func TestSubjectMatching(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		match            bool
+	}{
+		{"candles.>", "candles.1m.BTCUSDT", true},
+		{"candles.>", "candles", false},
+		{"candles.*.BTCUSDT", "candles.1m.BTCUSDT", true},
+		{"candles.*", "candles.1m.BTCUSDT", false},
+		{"metrics.calculated", "metrics.calculated", true},
+		{"metrics.calculated", "metrics.calculated.x", false},
+	}
+	for _, tt := range tests {
+		if got := subjectMatches(tt.pattern, tt.subject); got != tt.match {
+			t.Errorf("subjectMatches(%q, %q) = %v", tt.pattern, tt.subject, got)
+		}
+	}
+
+	if !subjectCovers("candles.>", "candles.1m.>") || subjectCovers("candles.1m.*", "candles.>") {
+		t.Error("subjectCovers")
+	}
+}
+
+func TestMemoryBusListenSeesLiveMessages(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+
+	ch := make(chan *Msg, 10)
+	sub, err := bus.Listen(context.Background(), "candles.1m.*", func(ctx context.Context, m *Msg) { ch <- m })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Listeners see only what is published after they start, and do not
+	// consume it from the work queue
+	publish(t, bus, "candles.1m.ETHUSDT", 1)
+	if msg := next(t, ch); msg.Subject != "candles.1m.ETHUSDT" {
+		t.Fatalf("subject = %s", msg.Subject)
+	}
+	none(t, ch, 50*time.Millisecond)
+
+	consumed, _ := collect(t, bus, "candles.1m.>", ConsumerConfig{Durable: "calc"}, func(m *Msg) { m.Ack() })
+	next(t, consumed)
+	next(t, consumed)
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, bus, "candles.1m.BTCUSDT", 1)
+	none(t, ch, 50*time.Millisecond)
+}
+
+func TestMemoryLeasesExpire(t *testing.T) {
+	bus := newTestBus(t, WorkQueue)
+	ctx := context.Background()
+	leases, err := bus.Leases(ctx, "test-leases", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := leases.Acquire(ctx, "partition.1", "a"); !ok {
+		t.Fatal("first acquire failed")
+	}
+	if ok, _ := leases.Acquire(ctx, "partition.1", "b"); ok {
+		t.Fatal("acquired a held lease")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if holders, _ := leases.Holders(ctx, "partition."); len(holders) != 0 {
+		t.Fatalf("expired lease still held: %v", holders)
+	}
+	if ok, _ := leases.Acquire(ctx, "partition.1", "b"); !ok {
+		t.Fatal("expired lease not free")
+	}
+}
+
+func TestCandleSubject(t *testing.T) {
+	if got := CandleSubject("BTCUSDT", 1); got != "candles.1m.0.BTCUSDT" {
+		t.Errorf("single partition subject = %s", got)
+	}
+	p := CandlePartition("BTCUSDT", 16)
+	if p < 0 || p >= 16 || p != CandlePartition("BTCUSDT", 16) {
+		t.Errorf("partition = %d", p)
+	}
+	if !subjectMatches(CandlePartitionSubject(p), CandleSubject("BTCUSDT", 16)) {
+		t.Error("partition subject does not match the symbol's subject")
+	}
+}
@@ -1,6 +1,7 @@
 package messaging
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,6 +15,9 @@ type Config struct {
 	MaxReconnects   int
 	ReconnectWait   time.Duration
 	EnableJetStream bool
+
+	// InProcess connects to an embedded server instead of URL
+	InProcess nats.InProcessConnProvider
 }
 
 // NewNATSConn creates a new NATS connection
@@ -42,6 +46,9 @@ func NewNATSConn(cfg Config) (*nats.Conn, error) {
 	if cfg.ReconnectWait == 0 {
 		cfg.ReconnectWait = 2 * time.Second
 	}
+	if cfg.InProcess != nil {
+		opts = append(opts, nats.InProcessServer(cfg.InProcess))
+	}
 
 	nc, err := nats.Connect(cfg.URL, opts...)
 	if err != nil {
@@ -68,31 +75,50 @@ func NewJetStream(nc *nats.Conn) (nats.JetStreamContext, error) {
 	return js, nil
 }
 
-// CreateStream creates a JetStream stream if it doesn't exist
-func CreateStream(js nats.JetStreamContext, name string, subjects []string, maxAge time.Duration) error {
+// ErrRetentionMismatch is returned for an existing stream whose retention
+// policy differs from the one requested. Retention cannot be changed in
+// place, so services never replace a stream on startup; RecreateStream does.
+var ErrRetentionMismatch = errors.New("stream has a different retention policy")
+
+// ensureStream creates the stream described by cfg if it doesn't exist. An
+// existing stream gets cfg's duplicate window, if set; its other settings are
+// left alone. A stream with another retention policy is an
+// ErrRetentionMismatch.
+func ensureStream(js nats.JetStreamContext, cfg *nats.StreamConfig) error {
 	// Check if stream exists
-	_, err := js.StreamInfo(name)
+	info, err := js.StreamInfo(cfg.Name)
 	if err == nil {
-		log.Info().Str("stream", name).Msg("Stream already exists")
+		if info.Config.Retention != cfg.Retention {
+			return fmt.Errorf("%w: %s has %s retention, want %s; run migrate-streams to recreate it",
+				ErrRetentionMismatch, cfg.Name, info.Config.Retention, cfg.Retention)
+		}
+		log.Info().Str("stream", cfg.Name).Msg("Stream already exists")
+
+		if cfg.Duplicates > 0 && info.Config.Duplicates != cfg.Duplicates {
+			update := info.Config
+			update.Duplicates = cfg.Duplicates
+			if _, err := js.UpdateStream(&update); err != nil {
+				return fmt.Errorf("failed to update duplicate window of stream %s: %w", cfg.Name, err)
+			}
+			log.Info().
+				Str("stream", cfg.Name).
+				Dur("duplicates", cfg.Duplicates).
+				Msg("Updated stream duplicate window")
+		}
 		return nil
 	}
 
 	// Create stream
-	_, err = js.AddStream(&nats.StreamConfig{
-		Name:      name,
-		Subjects:  subjects,
-		Retention: nats.WorkQueuePolicy,
-		MaxAge:    maxAge,
-		Storage:   nats.FileStorage,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create stream %s: %w", name, err)
+	if _, err := js.AddStream(cfg); err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
 	}
 
 	log.Info().
-		Str("stream", name).
-		Strs("subjects", subjects).
-		Dur("max_age", maxAge).
+		Str("stream", cfg.Name).
+		Strs("subjects", cfg.Subjects).
+		Dur("max_age", cfg.MaxAge).
+		Dur("duplicates", cfg.Duplicates).
+		Str("retention", cfg.Retention.String()).
 		Msg("Created JetStream stream")
 
 	return nil
@@ -0,0 +1,45 @@
+package messaging
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// DefaultCandlePartitions is how many partitions candles are spread over
+// unless configured otherwise. Publishers and consumers must agree on it.
+const DefaultCandlePartitions = 16
+
+// CandlePartition returns the partition symbol's candles are published to
+func CandlePartition(symbol string, partitions int) int {
+	if partitions <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(symbol))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// CandleSubject returns the subject symbol's 1m candles are published on:
+// candles.1m.<partition>.<symbol>
+func CandleSubject(symbol string, partitions int) string {
+	return fmt.Sprintf("candles.1m.%d.%s", CandlePartition(symbol, partitions), symbol)
+}
+
+// CandlePartitionSubject matches the 1m candles of every symbol in partition
+func CandlePartitionSubject(partition int) string {
+	return fmt.Sprintf("candles.1m.%d.*", partition)
+}
+
+// QuarantineSubjects matches the candles the collector held back as suspect.
+// They stay on the CANDLES stream until it expires them, but no calculator
+// consumer matches them.
+const QuarantineSubjects = "candles.quarantine.>"
+
+// HeaderQuarantineReason says why a candle was quarantined
+const HeaderQuarantineReason = "Candle-Quarantine-Reason"
+
+// QuarantineSubject returns the subject symbol's suspect candles are
+// published on: candles.quarantine.<symbol>
+func QuarantineSubject(symbol string) string {
+	return "candles.quarantine." + symbol
+}
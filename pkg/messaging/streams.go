@@ -0,0 +1,48 @@
+package messaging
+
+import "time"
+
+// Pipeline streams. Each service creates the stream it publishes to.
+//
+// Publishers set deterministic message IDs, so the duplicate windows drop the
+// copies that publish retries after a reconnect and consumers handling a
+// redelivered message again would otherwise store.
+var (
+	// CandlesStream carries closed 1m candles from the data collector
+	CandlesStream = StreamConfig{
+		Name:       "CANDLES",
+		Subjects:   []string{"candles.>"},
+		MaxAge:     1 * time.Hour,
+		Retention:  WorkQueue,
+		Duplicates: 10 * time.Minute,
+	}
+
+	// MetricsStream carries calculated metrics to the alert engine
+	MetricsStream = StreamConfig{
+		Name:       "METRICS",
+		Subjects:   []string{"metrics.>"},
+		MaxAge:     1 * time.Hour,
+		Retention:  WorkQueue,
+		Duplicates: 10 * time.Minute,
+	}
+
+	// AlertsStream keeps the last hour of triggered alerts available for
+	// API Gateway clients resuming their WebSocket or event stream
+	AlertsStream = StreamConfig{
+		Name:       "ALERTS",
+		Subjects:   []string{"alerts.>"},
+		MaxAge:     1 * time.Hour,
+		Retention:  Limits,
+		Duplicates: 10 * time.Minute,
+	}
+
+	// RulesStream carries alert rule changes from the API Gateway; alert
+	// engines listen for them to reload their rules
+	RulesStream = StreamConfig{
+		Name:       "RULES",
+		Subjects:   []string{"rules.>"},
+		MaxAge:     1 * time.Hour,
+		Retention:  Limits,
+		Duplicates: 10 * time.Minute,
+	}
+)
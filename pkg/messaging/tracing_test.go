@@ -0,0 +1,36 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextPropagates(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+
+	candle := NewMsg("candles.1m.BTCUSDT", []byte("{}"), nil)
+	InjectTrace(ctx, candle)
+	if candle.Header.Get("traceparent") == "" {
+		t.Fatal("traceparent header not set")
+	}
+
+	got := trace.SpanContextFromContext(ExtractTrace(context.Background(), candle.Header))
+	if got.TraceID() != parent.TraceID() || got.SpanID() != parent.SpanID() || !got.IsRemote() {
+		t.Errorf("extracted span context = %+v, want remote %+v", got, parent)
+	}
+
+	if sc := trace.SpanContextFromContext(ExtractTrace(context.Background(), nil)); sc.IsValid() {
+		t.Error("span context extracted from nil header")
+	}
+}
@@ -0,0 +1,89 @@
+package observability
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pipeline stages recorded under MetricPipelineStageLatency
+const (
+	StageCollector  = "collector"  // Binance event -> collector publish
+	StageCalculator = "calculator" // collector publish -> calculator publish
+	StageEngine     = "engine"     // calculator publish -> engine publish
+	StageWebhook    = "webhook"    // engine publish -> webhook delivered
+	StageEndToEnd   = "end_to_end" // Binance event -> webhook delivered
+	StageGateway    = "gateway"    // Binance event -> API gateway receipt
+)
+
+// PipelineBuckets cover pipeline lag from 10ms to two minutes
+var PipelineBuckets = []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// RecordStage records the latency of one pipeline stage. Negative values from
+// clock skew between hosts are recorded as zero.
+func (m *MetricsCollector) RecordStage(stage string, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	m.HistogramWith(MetricPipelineStageLatency, Labels{"stage": stage}).Observe(d.Seconds())
+}
+
+// LatencyWindow keeps the latency samples of the last window to report
+// current percentiles, which cumulative histograms cannot
+type LatencyWindow struct {
+	window  time.Duration
+	max     int
+	samples []latencySample
+	mu      sync.Mutex
+}
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// NewLatencyWindow creates a window holding at most max samples of the last window
+func NewLatencyWindow(window time.Duration, max int) *LatencyWindow {
+	return &LatencyWindow{window: window, max: max}
+}
+
+// Record adds a sample observed at now
+func (lw *LatencyWindow) Record(now time.Time, d time.Duration) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.samples = append(lw.samples, latencySample{at: now, d: d})
+	if len(lw.samples) > lw.max {
+		lw.samples = lw.samples[len(lw.samples)-lw.max:]
+	}
+}
+
+// Quantiles returns the requested quantiles of the samples inside the window
+// ending at now, and the number of samples they were computed from
+func (lw *LatencyWindow) Quantiles(now time.Time, qs ...float64) ([]time.Duration, int) {
+	lw.mu.Lock()
+	cutoff := now.Add(-lw.window)
+	i := sort.Search(len(lw.samples), func(i int) bool { return !lw.samples[i].at.Before(cutoff) })
+	lw.samples = lw.samples[i:]
+	values := make([]time.Duration, len(lw.samples))
+	for j, s := range lw.samples {
+		values[j] = s.d
+	}
+	lw.mu.Unlock()
+
+	out := make([]time.Duration, len(qs))
+	if len(values) == 0 {
+		return out, 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for j, q := range qs {
+		idx := int(q*float64(len(values)-1) + 0.5)
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(values) {
+			idx = len(values) - 1
+		}
+		out[j] = values[idx]
+	}
+	return out, len(values)
+}
@@ -0,0 +1,41 @@
+package observability
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyWindowQuantiles(t *testing.T) {
+	lw := NewLatencyWindow(time.Minute, 1000)
+	now := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	// Old samples fall out of the window
+	lw.Record(now.Add(-2*time.Minute), time.Hour)
+	for i := 1; i <= 100; i++ {
+		lw.Record(now.Add(-30*time.Second), time.Duration(i)*time.Millisecond)
+	}
+
+	qs, n := lw.Quantiles(now, 0.5, 0.99)
+	if n != 100 {
+		t.Fatalf("samples = %d, want 100", n)
+	}
+	if qs[0] != 51*time.Millisecond || qs[1] != 99*time.Millisecond {
+		t.Errorf("p50 = %s, p99 = %s", qs[0], qs[1])
+	}
+
+	if qs, n := NewLatencyWindow(time.Minute, 10).Quantiles(now, 0.5); n != 0 || qs[0] != 0 {
+		t.Errorf("empty window returned %v from %d samples", qs, n)
+	}
+}
+
+func TestLatencyWindowMaxSamples(t *testing.T) {
+	lw := NewLatencyWindow(time.Hour, 3)
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		lw.Record(now, time.Duration(i)*time.Second)
+	}
+	qs, n := lw.Quantiles(now, 0)
+	if n != 3 || qs[0] != 3*time.Second {
+		t.Errorf("kept %d samples with minimum %s, want the 3 newest", n, qs[0])
+	}
+}
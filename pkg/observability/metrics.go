@@ -2,17 +2,53 @@ package observability
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// MetricsCollector provides Prometheus-style metrics in a simple format
+// MetricsCollector provides Prometheus-style metrics in the text exposition format.
+// Every metric name is a family of series distinguished by their labels.
 type MetricsCollector struct {
-	counters   map[string]*Counter
-	gauges     map[string]*Gauge
-	histograms map[string]*Histogram
-	mu         sync.RWMutex
+	families map[string]*metricFamily
+	buckets  map[string][]float64
+	mu       sync.RWMutex
+}
+
+// Labels identifies a single series within a metric family
+type Labels map[string]string
+
+// DefaultBuckets are histogram upper bounds in seconds, suited to request and
+// evaluation latencies from one millisecond to ten seconds
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// metricFamily holds all series of one metric name
+type metricFamily struct {
+	kind   string
+	series map[string]*metricSeries
+}
+
+// metricSeries is one labeled series. labels are kept sorted by name so the
+// rendered series key is stable.
+type metricSeries struct {
+	labels []labelPair
+	metric interface{}
+}
+
+type labelPair struct {
+	name  string
+	value string
 }
 
 // Counter tracks cumulative values
@@ -27,11 +63,13 @@ type Gauge struct {
 	mu    sync.Mutex
 }
 
-// Histogram tracks distribution of values
+// Histogram tracks the distribution of values in cumulative buckets
 type Histogram struct {
-	sum   float64
-	count uint64
-	mu    sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, last entry is +Inf
+	sum    float64
+	count  uint64
+	mu     sync.Mutex
 }
 
 var (
@@ -42,15 +80,22 @@ var (
 // GetCollector returns the singleton metrics collector
 func GetCollector() *MetricsCollector {
 	once.Do(func() {
-		defaultCollector = &MetricsCollector{
-			counters:   make(map[string]*Counter),
-			gauges:     make(map[string]*Gauge),
-			histograms: make(map[string]*Histogram),
-		}
+		defaultCollector = NewMetricsCollector()
 	})
 	return defaultCollector
 }
 
+// NewMetricsCollector creates an empty collector. Services use the singleton
+// from GetCollector; separate collectors are useful in tests.
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		families: make(map[string]*metricFamily),
+		buckets: map[string][]float64{
+			MetricPipelineStageLatency: PipelineBuckets,
+		},
+	}
+}
+
 // Counter methods
 func (c *Counter) Inc() {
 	c.Add(1)
@@ -95,9 +140,21 @@ func (g *Gauge) Value() float64 {
 	return g.value
 }
 
+// newHistogram creates a histogram with the given sorted upper bounds
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
 // Histogram methods
 func (h *Histogram) Observe(val float64) {
 	h.mu.Lock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(h.bounds)+1)
+	}
+	h.counts[sort.SearchFloat64s(h.bounds, val)]++
 	h.sum += val
 	h.count++
 	h.mu.Unlock()
@@ -124,109 +181,262 @@ func (h *Histogram) Avg() float64 {
 	return h.sum / float64(h.count)
 }
 
+// snapshot returns cumulative bucket counts along with sum and count
+func (h *Histogram) snapshot() ([]uint64, float64, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cumulative := make([]uint64, len(h.bounds)+1)
+	var total uint64
+	for i := range cumulative {
+		if i < len(h.counts) {
+			total += h.counts[i]
+		}
+		cumulative[i] = total
+	}
+	return cumulative, h.sum, h.count
+}
+
 // MetricsCollector methods
+
+// Counter returns the unlabeled counter with the given name
 func (m *MetricsCollector) Counter(name string) *Counter {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if c, ok := m.counters[name]; ok {
-		return c
-	}
-	c := &Counter{}
-	m.counters[name] = c
-	return c
+	return m.CounterWith(name, nil)
 }
 
+// CounterWith returns the counter series of name with the given labels
+func (m *MetricsCollector) CounterWith(name string, labels Labels) *Counter {
+	return m.series(name, kindCounter, labels, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Gauge returns the unlabeled gauge with the given name
 func (m *MetricsCollector) Gauge(name string) *Gauge {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if g, ok := m.gauges[name]; ok {
-		return g
-	}
-	g := &Gauge{}
-	m.gauges[name] = g
-	return g
+	return m.GaugeWith(name, nil)
+}
+
+// GaugeWith returns the gauge series of name with the given labels
+func (m *MetricsCollector) GaugeWith(name string, labels Labels) *Gauge {
+	return m.series(name, kindGauge, labels, func() interface{} { return &Gauge{} }).(*Gauge)
 }
 
+// Histogram returns the unlabeled histogram with the given name
 func (m *MetricsCollector) Histogram(name string) *Histogram {
+	return m.HistogramWith(name, nil)
+}
+
+// HistogramWith returns the histogram series of name with the given labels.
+// Buckets come from SetBuckets, or DefaultBuckets if none were set.
+func (m *MetricsCollector) HistogramWith(name string, labels Labels) *Histogram {
+	return m.series(name, kindHistogram, labels, func() interface{} {
+		bounds, ok := m.buckets[name]
+		if !ok {
+			bounds = DefaultBuckets
+		}
+		return newHistogram(bounds)
+	}).(*Histogram)
+}
+
+// SetBuckets sets the upper bounds used by histograms of name. It must be
+// called before the first observation; existing series keep their buckets.
+func (m *MetricsCollector) SetBuckets(name string, buckets []float64) {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	m.mu.Lock()
+	m.buckets[name] = bounds
+	m.mu.Unlock()
+}
+
+// series returns the series of name with labels, creating it if needed. A name
+// already registered as another kind yields a detached metric that is not
+// exported, rather than corrupting the exposition output.
+func (m *MetricsCollector) series(name, kind string, labels Labels, create func() interface{}) interface{} {
+	pairs := sortedLabels(labels)
+	key := renderLabels(pairs)
+
+	m.mu.RLock()
+	if f, ok := m.families[name]; ok && f.kind == kind {
+		if s, ok := f.series[key]; ok {
+			m.mu.RUnlock()
+			return s.metric
+		}
+	}
+	m.mu.RUnlock()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if h, ok := m.histograms[name]; ok {
-		return h
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		m.families[name] = f
+	}
+	if f.kind != kind {
+		return create()
 	}
-	h := &Histogram{}
-	m.histograms[name] = h
-	return h
+	if s, ok := f.series[key]; ok {
+		return s.metric
+	}
+	s := &metricSeries{labels: pairs, metric: create()}
+	f.series[key] = s
+	return s.metric
 }
 
 // Timer measures duration and records to histogram
 func (m *MetricsCollector) Timer(name string) func() {
+	return m.TimerWith(name, nil)
+}
+
+// TimerWith measures duration and records it to the labeled histogram series
+func (m *MetricsCollector) TimerWith(name string, labels Labels) func() {
 	start := time.Now()
 	return func() {
-		duration := time.Since(start).Seconds()
-		m.Histogram(name).Observe(duration)
+		m.HistogramWith(name, labels).Observe(time.Since(start).Seconds())
 	}
 }
 
 // Handler returns HTTP handler for /metrics endpoint
 func (m *MetricsCollector) Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.writeText(w)
+	}
+}
 
-		m.mu.RLock()
-		defer m.mu.RUnlock()
+// writeText writes every metric family in the Prometheus text format, ordered
+// by name and labels so scrapes are stable
+func (m *MetricsCollector) writeText(w io.Writer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-		// Write counters
-		for name, counter := range m.counters {
-			fmt.Fprintf(w, "# TYPE %s counter\n", name)
-			fmt.Fprintf(w, "%s %.2f\n", name, counter.Value())
-		}
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		// Write gauges
-		for name, gauge := range m.gauges {
-			fmt.Fprintf(w, "# TYPE %s gauge\n", name)
-			fmt.Fprintf(w, "%s %.2f\n", name, gauge.Value())
+	for _, name := range names {
+		f := m.families[name]
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
 		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+		for _, key := range keys {
+			s := f.series[key]
+			switch metric := s.metric.(type) {
+			case *Counter:
+				fmt.Fprintf(w, "%s%s %s\n", name, key, formatValue(metric.Value()))
+			case *Gauge:
+				fmt.Fprintf(w, "%s%s %s\n", name, key, formatValue(metric.Value()))
+			case *Histogram:
+				cumulative, sum, count := metric.snapshot()
+				for i, bound := range metric.bounds {
+					le := renderLabels(append(s.labels[:len(s.labels):len(s.labels)], labelPair{"le", formatValue(bound)}))
+					fmt.Fprintf(w, "%s_bucket%s %d\n", name, le, cumulative[i])
+				}
+				le := renderLabels(append(s.labels[:len(s.labels):len(s.labels)], labelPair{"le", "+Inf"}))
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, le, cumulative[len(cumulative)-1])
+				fmt.Fprintf(w, "%s_sum%s %s\n", name, key, formatValue(sum))
+				fmt.Fprintf(w, "%s_count%s %d\n", name, key, count)
+			}
+		}
+	}
+}
 
-		// Write histograms
-		for name, histogram := range m.histograms {
-			fmt.Fprintf(w, "# TYPE %s histogram\n", name)
-			fmt.Fprintf(w, "%s_sum %.6f\n", name, histogram.Sum())
-			fmt.Fprintf(w, "%s_count %d\n", name, histogram.Count())
-			fmt.Fprintf(w, "%s_avg %.6f\n", name, histogram.Avg())
+func sortedLabels(labels Labels) []labelPair {
+	pairs := make([]labelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, labelPair{name, value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].name < pairs[j].name })
+	return pairs
+}
+
+// renderLabels formats pairs as {a="1",b="2"}, or "" when there are none
+func renderLabels(pairs []labelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, p := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
 		}
+		b.WriteString(p.name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(p.value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
 	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
 }
 
 // Predefined metric names
 const (
 	// Data Collector metrics
-	MetricCandlesReceived     = "data_collector_candles_received_total"
-	MetricCandlesPublished    = "data_collector_candles_published_total"
-	MetricWSConnections       = "data_collector_websocket_connections"
-	MetricWSReconnects        = "data_collector_websocket_reconnects_total"
-	MetricWSErrors            = "data_collector_websocket_errors_total"
+	MetricCandlesReceived    = "data_collector_candles_received_total"
+	MetricCandlesPublished   = "data_collector_candles_published_total"
+	MetricWSConnections      = "data_collector_websocket_connections"
+	MetricWSReconnects       = "data_collector_websocket_reconnects_total"
+	MetricWSErrors           = "data_collector_websocket_errors_total"
+	MetricCandlesQuarantined = "data_collector_candles_quarantined_total" // symbol, reason
 
 	// Metrics Calculator metrics
-	MetricCandlesProcessed      = "metrics_calculator_candles_processed_total"
-	MetricMetricsCalculated     = "metrics_calculator_metrics_calculated_total"
-	MetricDBInsertDuration      = "metrics_calculator_db_insert_duration_seconds"
-	MetricCalculationDuration   = "metrics_calculator_calculation_duration_seconds"
-	MetricRingBufferSize        = "metrics_calculator_ring_buffer_size"
-
-	// Alert Engine metrics
-	MetricAlertsEvaluated       = "alert_engine_alerts_evaluated_total"
-	MetricAlertsTriggered       = "alert_engine_alerts_triggered_total"
-	MetricAlertsDuplicated      = "alert_engine_alerts_duplicated_total"
-	MetricEvaluationDuration    = "alert_engine_evaluation_duration_seconds"
-	MetricWebhooksSent          = "alert_engine_webhooks_sent_total"
-	MetricWebhooksFailed        = "alert_engine_webhooks_failed_total"
+	MetricCandlesProcessed    = "metrics_calculator_candles_processed_total"
+	MetricMetricsCalculated   = "metrics_calculator_metrics_calculated_total"
+	MetricDBInsertDuration    = "metrics_calculator_db_insert_duration_seconds"
+	MetricCalculationDuration = "metrics_calculator_calculation_duration_seconds"
+	MetricRingBufferSize      = "metrics_calculator_ring_buffer_size"
+	MetricPartitionsOwned     = "metrics_calculator_partitions_owned"
+
+	// Calculator write queues, labeled by table
+	MetricPersistQueueDepth    = "metrics_calculator_persist_queue_depth"
+	MetricPersistQueueFull     = "metrics_calculator_persist_queue_full_total" // writes that waited for room
+	MetricPersistBatchesFailed = "metrics_calculator_persist_batches_failed_total"
+
+	// Calculator ring buffer snapshots
+	MetricSnapshotDuration = "metrics_calculator_snapshot_duration_seconds" // op: save, restore, fill
+	MetricCandlesRestored  = "metrics_calculator_candles_restored_total"    // source: snapshot, database
+
+	// Alert Engine metrics (labeled by rule_type where noted)
+	MetricAlertsEvaluated    = "alert_engine_alerts_evaluated_total"      // source
+	MetricAlertsTriggered    = "alert_engine_alerts_triggered_total"      // rule_type
+	MetricAlertsDuplicated   = "alert_engine_alerts_duplicated_total"     // rule_type
+	MetricEvaluationDuration = "alert_engine_evaluation_duration_seconds" // rule_type
+	MetricWebhooksSent       = "alert_engine_webhooks_sent_total"         // rule_type
+	MetricWebhooksFailed     = "alert_engine_webhooks_failed_total"       // rule_type
+	MetricAlertsStale        = "alert_engine_alerts_stale_total"          // rule_type
+	MetricShadowHits         = "alert_engine_shadow_hits_total"           // rule_type
+	MetricEngineLeader       = "alert_engine_leader"                      // 1 while running periodic evaluation
+
+	// Archiver metrics, labeled by table
+	MetricArchivedRows    = "archiver_rows_total"
+	MetricArchiveFailures = "archiver_failures_total"
 
 	// API Gateway metrics
-	MetricHTTPRequests          = "api_gateway_http_requests_total"
-	MetricHTTPDuration          = "api_gateway_http_duration_seconds"
-	MetricWSClientConnections   = "api_gateway_websocket_connections"
-	MetricWSMessagesSent        = "api_gateway_websocket_messages_sent_total"
-	MetricWSMessagesFailed      = "api_gateway_websocket_messages_failed_total"
+	MetricHTTPRequests        = "api_gateway_http_requests_total"
+	MetricHTTPDuration        = "api_gateway_http_duration_seconds"
+	MetricWSClientConnections = "api_gateway_websocket_connections"
+	MetricWSMessagesSent      = "api_gateway_websocket_messages_sent_total"
+	MetricWSMessagesFailed    = "api_gateway_websocket_messages_failed_total"
+
+	// Pipeline latency, labeled by stage (see latency.go)
+	MetricPipelineStageLatency = "pipeline_stage_latency_seconds"
 
 	// NATS metrics
 	MetricNATSMessagesPublished = "nats_messages_published_total"
@@ -234,7 +444,7 @@ const (
 	MetricNATSPublishErrors     = "nats_publish_errors_total"
 
 	// Database metrics
-	MetricDBQueries             = "database_queries_total"
-	MetricDBErrors              = "database_errors_total"
-	MetricDBConnectionPool      = "database_connection_pool_size"
+	MetricDBQueries        = "database_queries_total"
+	MetricDBErrors         = "database_errors_total"
+	MetricDBConnectionPool = "database_connection_pool_size"
 )
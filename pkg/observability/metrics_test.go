@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetricsCollector()
+	m.SetBuckets("eval_seconds", []float64{0.5, 0.1})
+
+	m.Counter("requests_total").Add(3)
+	m.CounterWith("alerts_total", Labels{"rule_type": "big_bull_60", "direction": "bull"}).Inc()
+	m.CounterWith("alerts_total", Labels{"direction": "bull", "rule_type": "big_bull_60"}).Inc()
+	m.GaugeWith("queue_depth", Labels{"queue": `say "hi"`}).Set(1.5)
+
+	h := m.HistogramWith("eval_seconds", Labels{"rule_type": "top_hunter"})
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		h.Observe(v)
+	}
+
+	var b strings.Builder
+	m.writeText(&b)
+	got := b.String()
+
+	want := `# TYPE alerts_total counter
+alerts_total{direction="bull",rule_type="big_bull_60"} 2
+# TYPE eval_seconds histogram
+eval_seconds_bucket{rule_type="top_hunter",le="0.1"} 2
+eval_seconds_bucket{rule_type="top_hunter",le="0.5"} 3
+eval_seconds_bucket{rule_type="top_hunter",le="+Inf"} 4
+eval_seconds_sum{rule_type="top_hunter"} 2.45
+eval_seconds_count{rule_type="top_hunter"} 4
+# TYPE queue_depth gauge
+queue_depth{queue="say \"hi\""} 1.5
+# TYPE requests_total counter
+requests_total 3
+`
+	if got != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricKindConflict(t *testing.T) {
+	m := NewMetricsCollector()
+	m.Counter("things").Inc()
+
+	// Using the same name as a gauge must not corrupt the counter family
+	m.Gauge("things").Set(42)
+
+	var b strings.Builder
+	m.writeText(&b)
+	if got := b.String(); got != "# TYPE things counter\nthings 1\n" {
+		t.Errorf("unexpected exposition: %q", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
 	"github.com/jackc/pgx/v5"
 	"github.com/nats-io/nats.go"
 	"github.com/redis/go-redis/v9"
@@ -81,7 +82,7 @@ func TestFullPipeline(t *testing.T) {
 			}
 
 			data, _ := json.Marshal(candle)
-			subject := fmt.Sprintf("candles.1m.%s", symbol)
+			subject := messaging.CandleSubject(symbol, messaging.DefaultCandlePartitions)
 			
 			if _, err := js.Publish(subject, data); err != nil {
 				t.Fatalf("publish candle %d: %v", i, err)
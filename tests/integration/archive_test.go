@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bl8ckfz/crypto-screener-backend/internal/archive"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/database"
+	"github.com/rs/zerolog"
+)
+
+// TestArchiveToMinIO archives a day of candles from TimescaleDB to the MinIO
+// bucket of docker-compose.yml and reads it back with the loader
+func TestArchiveToMinIO(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	db, err := database.NewPostgresPool(ctx, config.DefaultDatabaseURL)
+	if err != nil {
+		t.Fatalf("Failed to connect to TimescaleDB: %v", err)
+	}
+	defer db.Close()
+
+	// A closed day still inside the candles_1m retention
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	if now.Sub(day) < 24*time.Hour+15*time.Minute {
+		t.Skip("yesterday is not closed yet")
+	}
+	const symbol = "ARCHIVETESTUSDT"
+	for i := 0; i < 3; i++ {
+		_, err := db.Exec(ctx, `
+			INSERT INTO candles_1m (time, symbol, open, high, low, close, volume, quote_volume, trades)
+			VALUES ($1, $2, 1, 2, 0.5, $3, 10, 15, 3)
+			ON CONFLICT DO NOTHING`, day.Add(time.Duration(i)*time.Minute), symbol, float64(i))
+		if err != nil {
+			t.Fatalf("Failed to insert candle: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec(context.Background(), `DELETE FROM candles_1m WHERE symbol = $1`, symbol)
+	})
+
+	// A prefix of its own keeps the run from seeing earlier manifests
+	store, err := archive.NewStore(ctx, config.Archive{
+		S3Endpoint:  "localhost:9000",
+		S3Bucket:    "crypto-archive",
+		S3Prefix:    fmt.Sprintf("integration/%d", now.UnixNano()),
+		S3AccessKey: "minioadmin",
+		S3SecretKey: "minioadmin",
+	})
+	if err != nil {
+		t.Fatalf("Failed to open MinIO bucket: %v", err)
+	}
+
+	if err := archive.NewArchiver(db, store, zerolog.Nop()).ArchiveClosedDays(ctx, now); err != nil {
+		t.Fatalf("Archive run failed: %v", err)
+	}
+
+	loader, err := archive.NewLoader(ctx, store)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	files := loader.Files(archive.TableCandles, day, day.Add(24*time.Hour))
+	if len(files) != 1 || files[0].Rows < 3 {
+		t.Fatalf("Manifest lists %+v for %s", files, day.Format("2006-01-02"))
+	}
+	candles, err := loader.Candles(ctx, day, day.Add(24*time.Hour), symbol)
+	if err != nil {
+		t.Fatalf("Failed to load candles: %v", err)
+	}
+	if len(candles) != 3 || candles[2].Close != 2 || !candles[0].OpenTime.Equal(day) {
+		t.Fatalf("Loaded %+v", candles)
+	}
+}
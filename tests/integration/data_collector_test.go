@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bl8ckfz/crypto-screener-backend/internal/binance"
+	"github.com/bl8ckfz/crypto-screener-backend/pkg/config"
 	"github.com/bl8ckfz/crypto-screener-backend/pkg/messaging"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -41,7 +42,11 @@ func TestDataCollectorIntegration(t *testing.T) {
 	}
 
 	// Ensure CANDLES stream exists
-	if err := messaging.CreateStream(js, "CANDLES", []string{"candles.>"}, 1*time.Hour); err != nil {
+	bus, err := messaging.NewJetStreamBus(nc)
+	if err != nil {
+		t.Fatalf("Failed to create bus: %v", err)
+	}
+	if err := bus.CreateStream(ctx, messaging.CandlesStream); err != nil {
 		t.Fatalf("Failed to create stream: %v", err)
 	}
 
@@ -49,7 +54,7 @@ func TestDataCollectorIntegration(t *testing.T) {
 	client := binance.NewClient(logger)
 
 	// Fetch active symbols (just use first 3 for testing)
-	symbols, err := client.GetActiveSymbols(ctx)
+	symbols, err := client.GetActiveSymbols(ctx, 150)
 	if err != nil {
 		t.Fatalf("Failed to fetch symbols: %v", err)
 	}
@@ -66,7 +71,7 @@ func TestDataCollectorIntegration(t *testing.T) {
 	subscriptions := make([]*nats.Subscription, 0)
 
 	for _, symbol := range testSymbols {
-		subject := "candles.1m." + symbol
+		subject := messaging.CandleSubject(symbol, messaging.DefaultCandlePartitions)
 		sub, err := js.Subscribe(subject, func(msg *nats.Msg) {
 			var candle binance.Candle
 			if err := json.Unmarshal(msg.Data, &candle); err != nil {
@@ -83,7 +88,7 @@ func TestDataCollectorIntegration(t *testing.T) {
 	}
 
 	// Start WebSocket manager
-	wsManager := binance.NewConnectionManager(testSymbols, js, logger)
+	wsManager := binance.NewConnectionManager(testSymbols, bus, config.Collector{CandlePartitions: messaging.DefaultCandlePartitions}, logger)
 
 	go func() {
 		if err := wsManager.Start(ctx); err != nil {
@@ -78,22 +78,15 @@ func main() {
 	defer messaging.Close(nc)
 
 	// Test JetStream
-	js, err := messaging.NewJetStream(nc)
+	bus, err := messaging.NewJetStreamBus(nc)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create JetStream context")
 	}
 
-	// Create test streams
-	streams := map[string][]string{
-		"CANDLES": {"candles.1m.>"},
-		"METRICS": {"metrics.calculated"},
-		"ALERTS":  {"alerts.triggered"},
-	}
-
-	for name, subjects := range streams {
-		err = messaging.CreateStream(js, name, subjects, 1*time.Hour)
-		if err != nil {
-			log.Fatal().Err(err).Str("stream", name).Msg("Failed to create stream")
+	// Create the pipeline streams as the services do
+	for _, stream := range []messaging.StreamConfig{messaging.CandlesStream, messaging.MetricsStream, messaging.AlertsStream} {
+		if err := bus.CreateStream(ctx, stream); err != nil {
+			log.Fatal().Err(err).Str("stream", stream.Name).Msg("Failed to create stream")
 		}
 	}
 